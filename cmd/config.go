@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/camilocot/cassandra-crd/pkg/operator"
+)
+
+// loadConfig returns the operator configuration of the YAML file merged over
+// the default one, the default configuration when there is no file.
+func loadConfig(filename string) (operator.Config, error) {
+	cfg := operator.DefaultConfig()
+	if filename == "" {
+		return cfg, nil
+	}
+
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, fmt.Errorf("could not read configuration: %s", err)
+	}
+	js, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return cfg, fmt.Errorf("could not decode configuration %s: %s", filename, err)
+	}
+
+	// Unknown fields are refused, a typo would be silently ignored otherwise.
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("could not decode configuration %s: %s", filename, err)
+	}
+	return cfg, nil
+}
@@ -6,8 +6,10 @@ import (
 	"path/filepath"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/homedir"
 
+	"github.com/camilocot/cassandra-crd/pkg/log"
 	"github.com/camilocot/cassandra-crd/pkg/operator"
 )
 
@@ -15,16 +17,52 @@ import (
 type Flags struct {
 	flagSet *flag.FlagSet
 
+	ConfigFile  string
 	ResyncSec   int
 	KubeConfig  string
 	Development bool
+	Namespace   string
+	Workers     int
+	DryRun      bool
+	LogLevel    string
+	LogFormat   string
 }
 
-// OperatorConfig converts the command line flag arguments to operator configuration.
-func (f *Flags) OperatorConfig() operator.Config {
-	return operator.Config{
-		ResyncPeriod: time.Duration(f.ResyncSec) * time.Second,
+// OperatorConfig returns the operator configuration of the configuration file
+// with the flags set in the command line overriding its values.
+func (f *Flags) OperatorConfig() (operator.Config, error) {
+	cfg, err := loadConfig(f.ConfigFile)
+	if err != nil {
+		return cfg, err
 	}
+
+	f.flagSet.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "resync-seconds":
+			cfg.ResyncPeriod = metav1.Duration{Duration: time.Duration(f.ResyncSec) * time.Second}
+		case "namespace":
+			cfg.Namespace = f.Namespace
+		case "workers":
+			cfg.Workers = f.Workers
+		case "dry-run":
+			cfg.DryRun = f.DryRun
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+// Logger returns the logger configured by the log flags.
+func (f *Flags) Logger() (log.Logger, error) {
+	level, err := log.ParseLevel(f.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	format, err := log.ParseFormat(f.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(os.Stderr, level, format), nil
 }
 
 // NewFlags returns a new Flags.
@@ -36,9 +74,16 @@ func NewFlags() *Flags {
 	kubehome := filepath.Join(homedir.HomeDir(), ".kube", "config")
 
 	// Init flags.
+	f.flagSet.StringVar(&f.ConfigFile, "config", "", "YAML configuration file of the operator, the flags set override its values")
 	f.flagSet.IntVar(&f.ResyncSec, "resync-seconds", 30, "The number of seconds the controller will resync the resources")
 	f.flagSet.StringVar(&f.KubeConfig, "kubeconfig", kubehome, "kubernetes configuration path, only used when development mode enabled")
 	f.flagSet.BoolVar(&f.Development, "development", false, "development flag will allow to run the operator outside a kubernetes cluster")
+	f.flagSet.IntVar(&f.Workers, "workers", 1, "number of cassandra clusters reconciled concurrently")
+	f.flagSet.StringVar(&f.Namespace, "namespace", "", "namespace watched by the operator, all the namespaces when empty")
+	f.flagSet.BoolVar(&f.DryRun, "dry-run", false, "log the changes the operator would apply instead of applying them")
+
+	f.flagSet.StringVar(&f.LogLevel, "log-level", "info", "minimum level of the logged messages: debug, info, warning or error")
+	f.flagSet.StringVar(&f.LogFormat, "log-format", "text", "format of the logged messages: text or json")
 
 	f.flagSet.Parse(os.Args[1:])
 
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"text/template"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+// installCommand is the name of the subcommand printing the manifests
+// required to run the operator.
+const installCommand = "install"
+
+// InstallFlags are the install subcommand flags.
+type InstallFlags struct {
+	flagSet *flag.FlagSet
+
+	Namespace      string
+	WatchNamespace string
+	Image          string
+}
+
+// NewInstallFlags returns a new InstallFlags parsed from args.
+func NewInstallFlags(args []string) *InstallFlags {
+	f := &InstallFlags{
+		flagSet: flag.NewFlagSet(installCommand, flag.ExitOnError),
+	}
+
+	f.flagSet.StringVar(&f.Namespace, "namespace", "default", "namespace the operator is deployed in")
+	f.flagSet.StringVar(&f.WatchNamespace, "watch-namespace", "", "namespace watched by the operator, all the namespaces when empty")
+	f.flagSet.StringVar(&f.Image, "image", "cassandra-crd:latest", "operator image, as built by hack/build/docker_build.sh")
+
+	f.flagSet.Parse(args)
+
+	return f
+}
+
+// installValues are the values of the install manifests template.
+type installValues struct {
+	Name           string
+	Namespace      string
+	WatchNamespace string
+	Image          string
+
+	Group    string
+	Version  string
+	Cluster  installNames
+	Role     installNames
+	Keyspace installNames
+	Backup   installNames
+	Restore  installNames
+	Task     installNames
+}
+
+// installNames are the names of a kind of the CRDs.
+type installNames struct {
+	Kind     string
+	Plural   string
+	Singular string
+}
+
+// install prints the manifests of the CRDs, the RBAC rules and the deployment
+// required to run the operator. When a watch namespace is set the operator is
+// only granted access to the cassandra resources of that namespace.
+func install(args []string, out io.Writer) error {
+	f := NewInstallFlags(args)
+
+	values := installValues{
+		Name:           "cassandra-crd",
+		Namespace:      f.Namespace,
+		WatchNamespace: f.WatchNamespace,
+		Image:          f.Image,
+		Group:          cassandrav1alpha1.SchemeGroupVersion.Group,
+		Version:        cassandrav1alpha1.SchemeGroupVersion.Version,
+		Cluster: installNames{
+			Kind:     cassandrav1alpha1.CCKind,
+			Plural:   cassandrav1alpha1.CCNamePlural,
+			Singular: cassandrav1alpha1.CCName,
+		},
+		Role: installNames{
+			Kind:     cassandrav1alpha1.RoleKind,
+			Plural:   cassandrav1alpha1.RoleNamePlural,
+			Singular: cassandrav1alpha1.RoleName,
+		},
+		Keyspace: installNames{
+			Kind:     cassandrav1alpha1.KeyspaceKind,
+			Plural:   cassandrav1alpha1.KeyspaceNamePlural,
+			Singular: cassandrav1alpha1.KeyspaceName,
+		},
+		Backup: installNames{
+			Kind:     cassandrav1alpha1.BackupKind,
+			Plural:   cassandrav1alpha1.BackupNamePlural,
+			Singular: cassandrav1alpha1.BackupName,
+		},
+		Restore: installNames{
+			Kind:     cassandrav1alpha1.RestoreKind,
+			Plural:   cassandrav1alpha1.RestoreNamePlural,
+			Singular: cassandrav1alpha1.RestoreName,
+		},
+		Task: installNames{
+			Kind:     cassandrav1alpha1.TaskKind,
+			Plural:   cassandrav1alpha1.TaskNamePlural,
+			Singular: cassandrav1alpha1.TaskName,
+		},
+	}
+	return installTemplate.Execute(out, values)
+}
+
+var installTemplate = template.Must(template.New(installCommand).Parse(strings.TrimLeft(`
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Cluster.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Cluster.Kind}}
+    listKind: {{.Cluster.Kind}}List
+    plural: {{.Cluster.Plural}}
+    singular: {{.Cluster.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - statefulsetName
+          properties:
+            statefulsetName:
+              type: string
+              minLength: 1
+            replicas:
+              type: integer
+              minimum: 0
+            image:
+              type: string
+            resources:
+              type: object
+            storage:
+              type: object
+              required:
+              - size
+              properties:
+                storageClassName:
+                  type: string
+            racks:
+              type: array
+              items:
+                type: object
+                required:
+                - name
+                properties:
+                  name:
+                    type: string
+                    pattern: '^[a-z0-9]([-a-z0-9]*[a-z0-9])?$'
+                    maxLength: 63
+                  replicas:
+                    type: integer
+                    minimum: 0
+                  affinity:
+                    type: object
+                  tolerations:
+                    type: array
+                  nodeSelector:
+                    type: object
+                  priorityClassName:
+                    type: string
+            affinity:
+              type: object
+            tolerations:
+              type: array
+            nodeSelector:
+              type: object
+            priorityClassName:
+              type: string
+            podTemplate:
+              type: object
+            adoptExisting:
+              type: boolean
+            paused:
+              type: boolean
+            auth:
+              type: object
+              properties:
+                superuserSecretName:
+                  type: string
+            tls:
+              type: object
+              properties:
+                internode:
+                  type: boolean
+                client:
+                  type: boolean
+                caSecretName:
+                  type: string
+                nodeSecretName:
+                  type: string
+            jmx:
+              type: object
+              properties:
+                secretName:
+                  type: string
+                localOnly:
+                  type: boolean
+                jolokia:
+                  type: object
+                  required:
+                  - image
+                  properties:
+                    image:
+                      type: string
+                    resources:
+                      type: object
+            repair:
+              type: object
+              required:
+              - schedule
+              properties:
+                schedule:
+                  type: string
+                  minLength: 1
+                incremental:
+                  type: boolean
+                parallelism:
+                  type: integer
+                  minimum: 0
+                intensity:
+                  type: string
+                keyspaces:
+                  type: array
+                  items:
+                    type: string
+                excludedKeyspaces:
+                  type: array
+                  items:
+                    type: string
+            initialTokensConfigMap:
+              type: string
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Role.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Role.Kind}}
+    listKind: {{.Role.Kind}}List
+    plural: {{.Role.Plural}}
+    singular: {{.Role.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - clusterName
+          properties:
+            clusterName:
+              type: string
+              minLength: 1
+            roleName:
+              type: string
+            login:
+              type: boolean
+            superuser:
+              type: boolean
+            passwordSecretRef:
+              type: object
+              required:
+              - name
+              - key
+              properties:
+                name:
+                  type: string
+                key:
+                  type: string
+            grants:
+              type: array
+              items:
+                type: object
+                required:
+                - keyspace
+                - permissions
+                properties:
+                  keyspace:
+                    type: string
+                    minLength: 1
+                  table:
+                    type: string
+                  permissions:
+                    type: array
+                    items:
+                      type: string
+                      enum: ["ALL", "CREATE", "ALTER", "DROP", "SELECT", "MODIFY", "AUTHORIZE"]
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Keyspace.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Keyspace.Kind}}
+    listKind: {{.Keyspace.Kind}}List
+    plural: {{.Keyspace.Plural}}
+    singular: {{.Keyspace.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - clusterName
+          - replication
+          properties:
+            clusterName:
+              type: string
+              minLength: 1
+            keyspaceName:
+              type: string
+            replication:
+              type: object
+              properties:
+                strategy:
+                  type: string
+                  enum: ["NetworkTopologyStrategy", "SimpleStrategy"]
+                replicationFactor:
+                  type: integer
+                  minimum: 1
+                datacenters:
+                  type: object
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Backup.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Backup.Kind}}
+    listKind: {{.Backup.Kind}}List
+    plural: {{.Backup.Plural}}
+    singular: {{.Backup.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - clusterName
+          - destination
+          properties:
+            clusterName:
+              type: string
+              minLength: 1
+            keyspaces:
+              type: array
+              items:
+                type: string
+            schedule:
+              type: string
+            destination:
+              type: object
+              properties:
+                s3:
+                  type: object
+                  required:
+                  - bucket
+                  - credentialsSecretName
+                  properties:
+                    endpoint:
+                      type: string
+                      pattern: '^https?://[A-Za-z0-9.-]+(:[0-9]+)?/?$'
+                    bucket:
+                      type: string
+                      pattern: '^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$'
+                    prefix:
+                      type: string
+                      pattern: '^[A-Za-z0-9._/-]*$'
+                    region:
+                      type: string
+                    credentialsSecretName:
+                      type: string
+                persistentVolumeClaim:
+                  type: object
+                  required:
+                  - claimName
+                  properties:
+                    claimName:
+                      type: string
+                    path:
+                      type: string
+                      pattern: '^[A-Za-z0-9._/-]*$'
+            retention:
+              type: integer
+              minimum: 0
+            image:
+              type: string
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Restore.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Restore.Kind}}
+    listKind: {{.Restore.Kind}}List
+    plural: {{.Restore.Plural}}
+    singular: {{.Restore.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - backupName
+          - clusterName
+          properties:
+            backupName:
+              type: string
+              minLength: 1
+            backup:
+              type: string
+            clusterName:
+              type: string
+              minLength: 1
+            clusterTemplate:
+              type: object
+            keyspaces:
+              type: array
+              items:
+                type: string
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: {{.Task.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  names:
+    kind: {{.Task.Kind}}
+    listKind: {{.Task.Kind}}List
+    plural: {{.Task.Plural}}
+    singular: {{.Task.Singular}}
+  scope: Namespaced
+  subresources:
+    status: {}
+  validation:
+    openAPIV3Schema:
+      properties:
+        spec:
+          type: object
+          required:
+          - clusterName
+          - operation
+          properties:
+            clusterName:
+              type: string
+              minLength: 1
+            operation:
+              type: string
+              enum:
+              - Cleanup
+              - Compaction
+              - GarbageCollect
+              - Flush
+              - Rebuild
+            arguments:
+              type: array
+              items:
+                type: string
+            datacenter:
+              type: string
+            rack:
+              type: string
+            concurrency:
+              type: integer
+              minimum: 0
+            ttlSecondsAfterFinished:
+              type: integer
+              minimum: 0
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+---
+# The CRDs are cluster scoped, they're registered by the operator when missing.
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{.Name}}-crds
+rules:
+- apiGroups: ["apiextensions.k8s.io"]
+  resources: ["customresourcedefinitions"]
+  verbs: ["get", "create"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{.Name}}-crds
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{.Name}}-crds
+subjects:
+- kind: ServiceAccount
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+{{- if .WatchNamespace}}
+kind: Role
+metadata:
+  name: {{.Name}}
+  namespace: {{.WatchNamespace}}
+{{- else}}
+kind: ClusterRole
+metadata:
+  name: {{.Name}}
+{{- end}}
+rules:
+- apiGroups: ["{{.Group}}"]
+  resources: ["{{.Cluster.Plural}}", "{{.Role.Plural}}", "{{.Keyspace.Plural}}", "{{.Backup.Plural}}", "{{.Restore.Plural}}", "{{.Task.Plural}}"]
+  verbs: ["get", "list", "watch", "update"]
+- apiGroups: ["{{.Group}}"]
+  resources: ["{{.Cluster.Plural}}/status", "{{.Role.Plural}}/status", "{{.Keyspace.Plural}}/status", "{{.Backup.Plural}}/status", "{{.Restore.Plural}}/status", "{{.Task.Plural}}/status"]
+  verbs: ["update"]
+# The restores create the clusters they restore into when missing.
+- apiGroups: ["{{.Group}}"]
+  resources: ["{{.Cluster.Plural}}"]
+  verbs: ["create"]
+# The finished tasks are deleted once their TTL elapses.
+- apiGroups: ["{{.Group}}"]
+  resources: ["{{.Task.Plural}}"]
+  verbs: ["delete"]
+# The statefulsets of the removed racks are deleted once scaled to zero.
+- apiGroups: ["apps"]
+  resources: ["statefulsets"]
+  verbs: ["get", "list", "watch", "create", "update", "delete"]
+- apiGroups: [""]
+  resources: ["services"]
+  verbs: ["get", "list", "watch", "create", "update"]
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get", "create", "update"]
+# The keyspaces are repaired, the backups snapshotted and the tasks run with
+# nodetool on the cassandra pods.
+- apiGroups: [""]
+  resources: ["pods/exec"]
+  verbs: ["create"]
+# The manifests of the backups, the tokens and files of the restores and the
+# progress of the repairs.
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["get", "create", "update", "delete"]
+# The backups are uploaded and pruned by jobs, and downloaded by the
+# restores.
+- apiGroups: ["batch"]
+  resources: ["jobs"]
+  verbs: ["list", "create", "delete"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+{{- if .WatchNamespace}}
+kind: RoleBinding
+metadata:
+  name: {{.Name}}
+  namespace: {{.WatchNamespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: {{.Name}}
+{{- else}}
+kind: ClusterRoleBinding
+metadata:
+  name: {{.Name}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{.Name}}
+{{- end}}
+subjects:
+- kind: ServiceAccount
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app: {{.Name}}
+spec:
+  # A single replica, the operator has no leader election.
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+    spec:
+      serviceAccountName: {{.Name}}
+      containers:
+      - name: {{.Name}}
+        image: {{.Image}}
+        command:
+        - cassandra-crd
+        {{- if .WatchNamespace}}
+        - -namespace={{.WatchNamespace}}
+        {{- end}}
+        resources:
+          requests:
+            cpu: 100m
+            memory: 64Mi
+          limits:
+            memory: 128Mi
+`, "\n")))
@@ -2,13 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/spotahome/kooper/client/crd"
-	applogger "github.com/spotahome/kooper/log"
 	apiextensionscli "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
@@ -29,27 +29,39 @@ type Main struct {
 }
 
 // New returns the main application.
-func New(logger log.Logger) *Main {
+func New() (*Main, error) {
 	f := NewFlags()
+	logger, err := f.Logger()
+	if err != nil {
+		return nil, err
+	}
+	config, err := f.OperatorConfig()
+	if err != nil {
+		return nil, err
+	}
 	return &Main{
 		flags:  f,
-		config: f.OperatorConfig(),
+		config: config,
 		logger: logger,
-	}
+	}, nil
 }
 
 // Run runs the app.
 func (m *Main) Run(stopC <-chan struct{}) error {
-	m.logger.Infof("initializing pod termination operator")
+	m.logger.Infof("initializing cassandra operator")
 
 	// Get kubernetes rest client.
-	ptCli, crdCli, k8sCli, err := m.getKubernetesClients()
+	cfg, err := m.getKubernetesConfig()
+	if err != nil {
+		return err
+	}
+	ptCli, crdCli, k8sCli, err := m.getKubernetesClients(cfg)
 	if err != nil {
 		return err
 	}
 
 	// Create kubernetes service.
-	k8sservice := k8s.New(k8sCli, m.logger)
+	k8sservice := k8s.New(k8sCli, cfg, m.logger)
 
 	// Create the operator and run
 	op, err := operator.New(m.config, ptCli, k8sservice, crdCli, k8sCli, m.logger)
@@ -60,25 +72,28 @@ func (m *Main) Run(stopC <-chan struct{}) error {
 	return op.Run(stopC)
 }
 
-// getKubernetesClients returns all the required clients to communicate with
-// kubernetes cluster: CRD type client, pod terminator types client, kubernetes core types client.
-func (m *Main) getKubernetesClients() (cassandracli.Interface, crd.Interface, kubernetes.Interface, error) {
-	var err error
-	var cfg *rest.Config
-
+// getKubernetesConfig returns the configuration to communicate with the
+// kubernetes cluster.
+func (m *Main) getKubernetesConfig() (*rest.Config, error) {
 	// If devel mode then use configuration flag path.
 	if m.flags.Development {
-		cfg, err = clientcmd.BuildConfigFromFlags("", m.flags.KubeConfig)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("could not load configuration: %s", err)
-		}
-	} else {
-		cfg, err = rest.InClusterConfig()
+		cfg, err := clientcmd.BuildConfigFromFlags("", m.flags.KubeConfig)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("error loading kubernetes configuration inside cluster, check app is running outside kubernetes cluster or run in development mode: %s", err)
+			return nil, fmt.Errorf("could not load configuration: %s", err)
 		}
+		return cfg, nil
 	}
 
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes configuration inside cluster, check app is running outside kubernetes cluster or run in development mode: %s", err)
+	}
+	return cfg, nil
+}
+
+// getKubernetesClients returns all the required clients to communicate with
+// kubernetes cluster: CRD type client, pod terminator types client, kubernetes core types client.
+func (m *Main) getKubernetesClients(cfg *rest.Config) (cassandracli.Interface, crd.Interface, kubernetes.Interface, error) {
 	// Create clients.
 	k8sCli, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
@@ -101,14 +116,33 @@ func (m *Main) getKubernetesClients() (cassandracli.Interface, crd.Interface, ku
 	return ccCli, crdCli, k8sCli, nil
 }
 
+// subcommands are the commands printing manifests instead of running the
+// operator, they receive the arguments following the command name.
+var subcommands = map[string]func(args []string, out io.Writer) error{
+	renderCommand:  render,
+	installCommand: install,
+}
+
 func main() {
-	logger := &applogger.Std{}
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			if err := command(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "error running %s: %s\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
 	stopC := make(chan struct{})
 	finishC := make(chan error)
 	signalC := make(chan os.Signal, 1)
 	signal.Notify(signalC, syscall.SIGTERM, syscall.SIGINT)
-	m := New(logger)
+	m, err := New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error configuring operator: %s\n", err)
+		os.Exit(1)
+	}
 
 	// Run in background the operator.
 	go func() {
@@ -122,7 +156,7 @@ func main() {
 			os.Exit(1)
 		}
 	case <-signalC:
-		logger.Infof("Signal captured, exiting...")
+		m.logger.Infof("Signal captured, exiting...")
 	}
 	close(stopC)
 	time.Sleep(5 * time.Second)
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// renderCommand is the name of the subcommand printing the resources
+// generated for a CassandraCluster.
+const renderCommand = "render"
+
+// RenderFlags are the render subcommand flags.
+type RenderFlags struct {
+	flagSet *flag.FlagSet
+
+	Filename   string
+	Namespace  string
+	ConfigFile string
+}
+
+// NewRenderFlags returns a new RenderFlags parsed from args.
+func NewRenderFlags(args []string) *RenderFlags {
+	f := &RenderFlags{
+		flagSet: flag.NewFlagSet(renderCommand, flag.ExitOnError),
+	}
+
+	f.flagSet.StringVar(&f.Filename, "f", "-", "CassandraCluster manifest to render, - reads it from the standard input")
+	f.flagSet.StringVar(&f.ConfigFile, "config", "", "YAML configuration file of the operator whose defaults are rendered")
+	f.flagSet.StringVar(&f.Namespace, "namespace", metav1.NamespaceDefault, "namespace of the CassandraCluster when its manifest doesn't set it")
+	f.flagSet.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", renderCommand)
+		fmt.Fprintln(os.Stderr, "Prints the headless Services and the StatefulSets generated for a CassandraCluster. The operator creates no PodDisruptionBudget, and the ConfigMaps and Secrets it creates hold the state of its operations or generated credentials, so they're not rendered.")
+		f.flagSet.PrintDefaults()
+	}
+
+	f.flagSet.Parse(args)
+
+	return f
+}
+
+// render prints the manifests of the resources the operator generates for
+// the CassandraCluster manifest, no kubernetes cluster is required. Only the
+// services and statefulsets are generated from the manifest alone.
+func render(args []string, out io.Writer) error {
+	f := NewRenderFlags(args)
+
+	cfg, err := loadConfig(f.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	cc, err := readCassandraCluster(f.Filename)
+	if err != nil {
+		return err
+	}
+	if cc.Namespace == "" {
+		cc.Namespace = f.Namespace
+	}
+	if cc.Spec.StatefulSetName == "" {
+		return fmt.Errorf("%s/%s: statefulset name must be specified", cc.Namespace, cc.Name)
+	}
+
+	objs, err := ccsvc.GenerateResources(cc, cfg.ServiceConfig())
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		raw, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCassandraCluster reads a CassandraCluster manifest from a file, or from
+// the standard input when the filename is -.
+func readCassandraCluster(filename string) (*cassandrav1alpha1.CassandraCluster, error) {
+	var raw []byte
+	var err error
+	if filename == "-" {
+		raw, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		raw, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %s", filename, err)
+	}
+
+	cc := &cassandrav1alpha1.CassandraCluster{}
+	if err := yaml.Unmarshal(raw, cc); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %s", filename, err)
+	}
+	if cc.Kind != cassandrav1alpha1.CCKind {
+		return nil, fmt.Errorf("%s is a %q, a %s is required", filename, cc.Kind, cassandrav1alpha1.CCKind)
+	}
+	return cc, nil
+}
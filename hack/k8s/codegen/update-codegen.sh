@@ -6,6 +6,6 @@ set -o pipefail
 
 CODEGEN_PKG=./../../../../../../../..${GOPATH}/src/k8s.io/code-generator
 
-${CODEGEN_PKG}/generate-groups.sh "deepcopy,client" \
+${CODEGEN_PKG}/generate-groups.sh "deepcopy,client,informer,lister" \
   github.com/camilocot/cassandra-crd/pkg/client github.com/camilocot/cassandra-crd/pkg/apis \
   cassandra:v1alpha1
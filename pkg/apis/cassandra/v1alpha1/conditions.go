@@ -0,0 +1,198 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraClusterStatus) GetCondition(conditionType CassandraClusterConditionType) *CassandraClusterCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraClusterStatus) SetCondition(conditionType CassandraClusterConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraClusterCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraClusterStatus) IsConditionTrue(conditionType CassandraClusterConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraRoleStatus) GetCondition(conditionType CassandraRoleConditionType) *CassandraRoleCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraRoleStatus) SetCondition(conditionType CassandraRoleConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraRoleCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraRoleStatus) IsConditionTrue(conditionType CassandraRoleConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraKeyspaceStatus) GetCondition(conditionType CassandraKeyspaceConditionType) *CassandraKeyspaceCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraKeyspaceStatus) SetCondition(conditionType CassandraKeyspaceConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraKeyspaceCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraKeyspaceStatus) IsConditionTrue(conditionType CassandraKeyspaceConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraBackupStatus) GetCondition(conditionType CassandraBackupConditionType) *CassandraBackupCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraBackupStatus) SetCondition(conditionType CassandraBackupConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraBackupCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraBackupStatus) IsConditionTrue(conditionType CassandraBackupConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraRestoreStatus) GetCondition(conditionType CassandraRestoreConditionType) *CassandraRestoreCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraRestoreStatus) SetCondition(conditionType CassandraRestoreConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraRestoreCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraRestoreStatus) IsConditionTrue(conditionType CassandraRestoreConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// GetCondition returns the condition of the given type, nil if not present.
+func (s *CassandraTaskStatus) GetCondition(conditionType CassandraTaskConditionType) *CassandraTaskCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the given type. The last
+// transition time is only updated when the condition status changes.
+func (s *CassandraTaskStatus) SetCondition(conditionType CassandraTaskConditionType, status corev1.ConditionStatus, reason, message string) {
+	condition := s.GetCondition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, CassandraTaskCondition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// IsConditionTrue returns true when the condition of the given type is present and true.
+func (s *CassandraTaskStatus) IsConditionTrue(conditionType CassandraTaskConditionType) bool {
+	condition := s.GetCondition(conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
@@ -19,6 +19,31 @@ const (
 	CCName       = "cassandracluster"
 	CCNamePlural = "cassandraclusters"
 	CCScope      = apiextensionsv1beta1.NamespaceScoped
+
+	RoleKind       = "CassandraRole"
+	RoleName       = "cassandrarole"
+	RoleNamePlural = "cassandraroles"
+	RoleScope      = apiextensionsv1beta1.NamespaceScoped
+
+	KeyspaceKind       = "CassandraKeyspace"
+	KeyspaceName       = "cassandrakeyspace"
+	KeyspaceNamePlural = "cassandrakeyspaces"
+	KeyspaceScope      = apiextensionsv1beta1.NamespaceScoped
+
+	BackupKind       = "CassandraBackup"
+	BackupName       = "cassandrabackup"
+	BackupNamePlural = "cassandrabackups"
+	BackupScope      = apiextensionsv1beta1.NamespaceScoped
+
+	RestoreKind       = "CassandraRestore"
+	RestoreName       = "cassandrarestore"
+	RestoreNamePlural = "cassandrarestores"
+	RestoreScope      = apiextensionsv1beta1.NamespaceScoped
+
+	TaskKind       = "CassandraTask"
+	TaskName       = "cassandratask"
+	TaskNamePlural = "cassandratasks"
+	TaskScope      = apiextensionsv1beta1.NamespaceScoped
 )
 
 // SchemeGroupVersion is group version used to register these objects
@@ -49,6 +74,16 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&CassandraCluster{},
 		&CassandraClusterList{},
+		&CassandraRole{},
+		&CassandraRoleList{},
+		&CassandraKeyspace{},
+		&CassandraKeyspaceList{},
+		&CassandraBackup{},
+		&CassandraBackupList{},
+		&CassandraRestore{},
+		&CassandraRestoreList{},
+		&CassandraTask{},
+		&CassandraTaskList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
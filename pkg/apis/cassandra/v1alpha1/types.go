@@ -1,6 +1,8 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -19,12 +21,201 @@ type CassandraCluster struct {
 // CassandraClusterSpec is the spec for a CassandraCluster resource
 type CassandraClusterSpec struct {
 	StatefulSetName string `json:"statefulsetName"`
-	Replicas        *int32 `json:"replicas"`
+	Replicas        *int32 `json:"replicas,omitempty"`
+
+	// Image of the cassandra containers, defaults to the operator one.
+	Image string `json:"image,omitempty"`
+	// Resources of the cassandra containers, default to the operator ones.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Storage of the cassandra data, the data is lost with the pods when
+	// not set. It can't be changed once the cluster is created.
+	Storage *StorageSpec `json:"storage,omitempty"`
+
+	// Scheduling constraints applied to the pods of every rack.
+	SchedulingSpec `json:",inline"`
+
+	// Racks splits the cluster in one StatefulSet per rack, named
+	// <statefulsetName>-<rack>, and tells the nodes their rack. When empty a
+	// single StatefulSet named after StatefulSetName is used. The racks
+	// can't be added to an existing cluster without racks.
+	Racks []RackSpec `json:"racks,omitempty"`
+
+	// PodTemplate is strategically merged on top of the pod template
+	// generated by the operator. Overrides that change the cassandra
+	// container ports or the selector labels are refused.
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+
+	// AdoptExisting allows the operator to take control of existing
+	// resources with the names it generates that have no controller, like
+	// hand-made cassandra StatefulSets.
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+
+	// Paused stops the operator from mutating the resources of the cluster
+	// and from syncing its roles and keyspaces, backing it up, restoring it,
+	// repairing it or running tasks on it. Its status is still refreshed.
+	Paused bool `json:"paused,omitempty"`
+
+	// Auth enables the authentication and authorization of the clients,
+	// everyone is allowed when not set.
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// TLS encrypts the traffic of the nodes with certificates signed by the
+	// cluster CA, it's plaintext when not set.
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// JMX requires the credentials of a managed user to connect to the JMX
+	// of the nodes, it's open to anyone reaching them when not set.
+	JMX *JMXSpec `json:"jmx,omitempty"`
+
+	// Repair schedules the anti-entropy repairs of the cluster, it's only
+	// repaired by hand when not set.
+	Repair *RepairSpec `json:"repair,omitempty"`
+
+	// InitialTokensConfigMap is the ConfigMap with the comma separated
+	// tokens the nodes bootstrap with, keyed by the name of their pods. It's
+	// set on the clusters created by a CassandraRestore, so the snapshots of
+	// the backed up nodes can be loaded on the ones with their tokens.
+	InitialTokensConfigMap string `json:"initialTokensConfigMap,omitempty"`
+}
+
+// AuthSpec is the spec of the authentication of a CassandraCluster resource
+type AuthSpec struct {
+	// SuperuserSecretName is the Secret with the username and password keys
+	// of the superuser that replaces the default cassandra one. It's
+	// generated when it doesn't exist, defaults to <statefulsetName>-superuser.
+	SuperuserSecretName string `json:"superuserSecretName,omitempty"`
+}
+
+// TLSSpec is the spec of the encryption of a CassandraCluster resource
+type TLSSpec struct {
+	// Internode encrypts the traffic between the nodes. It can't change
+	// while the cluster runs nodes, they must be scaled to zero before.
+	Internode bool `json:"internode,omitempty"`
+	// Client encrypts the CQL connections of the clients.
+	Client bool `json:"client,omitempty"`
+	// CASecretName is the kubernetes.io/tls Secret with the certificate and
+	// key of the CA signing the certificates of the nodes. It's generated
+	// when it doesn't exist, defaults to <statefulsetName>-ca.
+	CASecretName string `json:"caSecretName,omitempty"`
+	// NodeSecretName is a Secret provided instead of the generated
+	// certificates, with the CA certificate in ca.crt and the certificate and
+	// key of every node in <pod>.crt and <pod>.key. It's never modified.
+	NodeSecretName string `json:"nodeSecretName,omitempty"`
+}
+
+// JMXSpec is the spec of the JMX access of a CassandraCluster resource
+type JMXSpec struct {
+	// SecretName is the Secret with the username and password keys of the
+	// JMX user. It's generated when it doesn't exist, defaults to
+	// <statefulsetName>-jmx.
+	SecretName string `json:"secretName,omitempty"`
+	// LocalOnly binds JMX to the loopback interface of the nodes, so only
+	// the containers of their pods, like the nodetool commands of the
+	// operator, can connect to it.
+	LocalOnly bool `json:"localOnly,omitempty"`
+	// Jolokia runs a Jolokia proxy sidecar next to the nodes, giving HTTP
+	// access to their JMX, local-only or not.
+	Jolokia *JolokiaSpec `json:"jolokia,omitempty"`
+}
+
+// JolokiaSpec is the spec of the Jolokia sidecar of a CassandraCluster resource
+type JolokiaSpec struct {
+	// Image of the Jolokia proxy serving on the jolokia port. It's given the
+	// JMX service URL of the node in JMX_URL and the JMX credentials in
+	// JMX_USERNAME and JMX_PASSWORD.
+	Image string `json:"image"`
+	// Resources of the sidecar container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// RepairSpec is the spec of the scheduled repairs of a CassandraCluster resource
+type RepairSpec struct {
+	// Schedule in cron format of the repair runs, every node repairs its
+	// primary token ranges once per run.
+	Schedule string `json:"schedule"`
+	// Incremental repairs only the data not repaired yet, each node repairs
+	// its primary ranges at once. Otherwise the nodes run full repairs of
+	// their ranges one subrange at a time.
+	Incremental bool `json:"incremental,omitempty"`
+	// Parallelism is the number of subranges of a node repaired at the same
+	// time, defaults to 1.
+	Parallelism int32 `json:"parallelism,omitempty"`
+	// Intensity is the fraction of the time spent repairing, between 0 and
+	// 1. The runs pause between the subranges the rest of the time, so a 0.5
+	// intensity pauses as long as the last subranges took. Defaults to 1.
+	Intensity string `json:"intensity,omitempty"`
+	// Keyspaces repaired, defaults to all of them but the local ones.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+	// ExcludedKeyspaces are never repaired.
+	ExcludedKeyspaces []string `json:"excludedKeyspaces,omitempty"`
+}
+
+// RackSpec is the spec for a rack of a CassandraCluster resource
+type RackSpec struct {
+	// Name of the rack, a DNS label.
+	Name string `json:"name"`
+	// Replicas of the rack, defaults to its share of the cluster replicas
+	// not set on the other racks.
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Scheduling constraints of the rack, merged over the cluster ones.
+	SchedulingSpec `json:",inline"`
+}
+
+// StorageSpec is the spec of the persistent volume claimed by every cassandra node
+type StorageSpec struct {
+	// StorageClassName of the claims, defaults to the operator one.
+	StorageClassName *string           `json:"storageClassName,omitempty"`
+	Size             resource.Quantity `json:"size"`
+}
+
+// SchedulingSpec holds the pod scheduling constraints of the cassandra pods
+type SchedulingSpec struct {
+	// Affinity of the pods. When not set the pods of a cluster are spread
+	// across nodes with a required pod anti-affinity on the hostname.
+	Affinity          *corev1.Affinity    `json:"affinity,omitempty"`
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	PriorityClassName string              `json:"priorityClassName,omitempty"`
 }
 
 // CassandraClusterStatus is the status for a CassandraCluster resource
 type CassandraClusterStatus struct {
 	CurrentReplicas int32 `json:"currentReplicas"`
+
+	// EffectiveSpec is the spec applied on the last reconciliation, with the
+	// operator defaults merged under the spec of the cluster.
+	EffectiveSpec *CassandraClusterSpec `json:"effectiveSpec,omitempty"`
+
+	Conditions []CassandraClusterCondition `json:"conditions,omitempty"`
+}
+
+// CassandraClusterConditionType is the type of a CassandraCluster condition
+type CassandraClusterConditionType string
+
+const (
+	// ClusterResourceConflict is true when a resource of the cluster exists
+	// and is not controlled by the CassandraCluster.
+	ClusterResourceConflict CassandraClusterConditionType = "ResourceConflict"
+	// ClusterPaused is true when the reconciliation of the cluster is paused.
+	ClusterPaused CassandraClusterConditionType = "Paused"
+	// ClusterAuthReady is true when the superuser of the cluster replaced
+	// the default one and the system_auth keyspace is replicated across the
+	// cluster.
+	ClusterAuthReady CassandraClusterConditionType = "AuthReady"
+	// ClusterRepairOverdue is true when a keyspace repaired on schedule was
+	// not fully repaired within the gc_grace_seconds of its tables, its
+	// deleted data may reappear.
+	ClusterRepairOverdue CassandraClusterConditionType = "RepairOverdue"
+)
+
+// CassandraClusterCondition describes the state of a CassandraCluster at a certain point
+type CassandraClusterCondition struct {
+	Type               CassandraClusterConditionType `json:"type"`
+	Status             corev1.ConditionStatus        `json:"status"`
+	LastTransitionTime metav1.Time                   `json:"lastTransitionTime,omitempty"`
+	Reason             string                        `json:"reason,omitempty"`
+	Message            string                        `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -36,3 +227,520 @@ type CassandraClusterList struct {
 
 	Items []CassandraCluster `json:"items"`
 }
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraRole is a specification for a CassandraRole resource, a role of a
+// CassandraCluster along with its permissions
+type CassandraRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraRoleSpec   `json:"spec"`
+	Status CassandraRoleStatus `json:"status"`
+}
+
+// CassandraRoleSpec is the spec for a CassandraRole resource
+type CassandraRoleSpec struct {
+	// ClusterName is the CassandraCluster of the namespace the role belongs
+	// to, it must have the authentication enabled.
+	ClusterName string `json:"clusterName"`
+	// RoleName is the name of the role in cassandra, defaults to the name
+	// of the resource.
+	RoleName string `json:"roleName,omitempty"`
+
+	Login     bool `json:"login,omitempty"`
+	Superuser bool `json:"superuser,omitempty"`
+	// PasswordSecretRef selects the key of a Secret of the namespace with
+	// the password of the role, the role has no password when not set.
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+
+	// Grants are the permissions of the role on keyspaces and tables, the
+	// ones not listed are revoked.
+	Grants []GrantSpec `json:"grants,omitempty"`
+}
+
+// GrantSpec is the spec of the permissions of a role on a keyspace or table
+type GrantSpec struct {
+	Keyspace string `json:"keyspace"`
+	// Table of the keyspace, the permissions apply to the whole keyspace
+	// when not set.
+	Table string `json:"table,omitempty"`
+	// Permissions granted, ALL or any of CREATE, ALTER, DROP, SELECT,
+	// MODIFY and AUTHORIZE. CREATE only applies to keyspaces.
+	Permissions []string `json:"permissions"`
+}
+
+// CassandraRoleStatus is the status for a CassandraRole resource
+type CassandraRoleStatus struct {
+	// ObservedGeneration is the generation of the spec last synced.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	Conditions []CassandraRoleCondition `json:"conditions,omitempty"`
+}
+
+// CassandraRoleConditionType is the type of a CassandraRole condition
+type CassandraRoleConditionType string
+
+const (
+	// RoleSynced is true when the role and its permissions are the ones of
+	// the spec.
+	RoleSynced CassandraRoleConditionType = "Synced"
+)
+
+// CassandraRoleCondition describes the state of a CassandraRole at a certain point
+type CassandraRoleCondition struct {
+	Type               CassandraRoleConditionType `json:"type"`
+	Status             corev1.ConditionStatus     `json:"status"`
+	LastTransitionTime metav1.Time                `json:"lastTransitionTime,omitempty"`
+	Reason             string                     `json:"reason,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraRoleList is a list of CassandraRole resources
+type CassandraRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CassandraRole `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraKeyspace is a specification for a CassandraKeyspace resource, a
+// keyspace of a CassandraCluster along with its replication
+type CassandraKeyspace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraKeyspaceSpec   `json:"spec"`
+	Status CassandraKeyspaceStatus `json:"status"`
+}
+
+// CassandraKeyspaceSpec is the spec for a CassandraKeyspace resource
+type CassandraKeyspaceSpec struct {
+	// ClusterName is the CassandraCluster of the namespace the keyspace
+	// belongs to.
+	ClusterName string `json:"clusterName"`
+	// KeyspaceName is the name of the keyspace in cassandra, defaults to the
+	// name of the resource.
+	KeyspaceName string `json:"keyspaceName,omitempty"`
+
+	Replication ReplicationSpec `json:"replication"`
+}
+
+// ReplicationSpec is the spec of the replication of a keyspace
+type ReplicationSpec struct {
+	// Strategy is the replication strategy, NetworkTopologyStrategy or
+	// SimpleStrategy. Defaults to NetworkTopologyStrategy.
+	Strategy string `json:"strategy,omitempty"`
+	// ReplicationFactor of the SimpleStrategy.
+	ReplicationFactor *int32 `json:"replicationFactor,omitempty"`
+	// Datacenters are the replication factors per datacenter of the
+	// NetworkTopologyStrategy.
+	Datacenters map[string]int32 `json:"datacenters,omitempty"`
+}
+
+// CassandraKeyspaceStatus is the status for a CassandraKeyspace resource
+type CassandraKeyspaceStatus struct {
+	// ObservedGeneration is the generation of the spec last synced.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// PendingRepairs are the pods that still have to repair the keyspace
+	// after its replication factor increased.
+	PendingRepairs []string `json:"pendingRepairs,omitempty"`
+	// PendingRepairsReplication is the replication increasing the
+	// replication factor that the pending repairs were recorded for, they're
+	// recorded before the keyspace is altered.
+	PendingRepairsReplication *ReplicationSpec `json:"pendingRepairsReplication,omitempty"`
+
+	Conditions []CassandraKeyspaceCondition `json:"conditions,omitempty"`
+}
+
+// CassandraKeyspaceConditionType is the type of a CassandraKeyspace condition
+type CassandraKeyspaceConditionType string
+
+const (
+	// KeyspaceSynced is true when the keyspace exists with the replication
+	// of the spec.
+	KeyspaceSynced CassandraKeyspaceConditionType = "Synced"
+	// KeyspaceRepaired is false while the nodes repair the keyspace after
+	// its replication factor increased.
+	KeyspaceRepaired CassandraKeyspaceConditionType = "Repaired"
+)
+
+// CassandraKeyspaceCondition describes the state of a CassandraKeyspace at a certain point
+type CassandraKeyspaceCondition struct {
+	Type               CassandraKeyspaceConditionType `json:"type"`
+	Status             corev1.ConditionStatus         `json:"status"`
+	LastTransitionTime metav1.Time                    `json:"lastTransitionTime,omitempty"`
+	Reason             string                         `json:"reason,omitempty"`
+	Message            string                         `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraKeyspaceList is a list of CassandraKeyspace resources
+type CassandraKeyspaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CassandraKeyspace `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraBackup is a specification for a CassandraBackup resource, the
+// scheduled backups of a CassandraCluster shipped to a destination
+type CassandraBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraBackupSpec   `json:"spec"`
+	Status CassandraBackupStatus `json:"status"`
+}
+
+// CassandraBackupSpec is the spec for a CassandraBackup resource
+type CassandraBackupSpec struct {
+	// ClusterName is the CassandraCluster of the namespace to back up.
+	ClusterName string `json:"clusterName"`
+	// Keyspaces to back up, all of them when empty.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+	// Schedule of the backups in cron syntax, like "0 3 * * *". The backup
+	// is taken once when empty.
+	Schedule string `json:"schedule,omitempty"`
+
+	Destination BackupDestination `json:"destination"`
+	// Retention is the number of completed backups kept at the destination,
+	// the older ones are pruned. All of them are kept when 0, only the last
+	// 100 are recorded on the status and can be restored by name.
+	Retention int32 `json:"retention,omitempty"`
+
+	// Image of the jobs uploading and pruning the backups, it must have a
+	// shell and the aws cli for the S3 destinations. Defaults to
+	// amazon/aws-cli.
+	Image string `json:"image,omitempty"`
+}
+
+// BackupDestination is where the backups are shipped, exactly one of its
+// fields must be set
+type BackupDestination struct {
+	// S3 is a bucket of AWS S3 or an S3-compatible service like MinIO.
+	S3 *S3Destination `json:"s3,omitempty"`
+	// PersistentVolumeClaim is a volume mountable by the jobs on any node,
+	// like a ReadWriteMany one.
+	PersistentVolumeClaim *PersistentVolumeClaimDestination `json:"persistentVolumeClaim,omitempty"`
+}
+
+// S3Destination is an S3 bucket backup destination
+type S3Destination struct {
+	// Endpoint of the S3-compatible service, AWS S3 when empty.
+	Endpoint string `json:"endpoint,omitempty"`
+	Bucket   string `json:"bucket"`
+	// Prefix of the keys of the backups in the bucket.
+	Prefix string `json:"prefix,omitempty"`
+	Region string `json:"region,omitempty"`
+	// CredentialsSecretName is the Secret with the accessKeyId and
+	// secretAccessKey keys of the bucket.
+	CredentialsSecretName string `json:"credentialsSecretName"`
+}
+
+// PersistentVolumeClaimDestination is a volume backup destination
+type PersistentVolumeClaimDestination struct {
+	ClaimName string `json:"claimName"`
+	// Path of the volume the backups are written under.
+	Path string `json:"path,omitempty"`
+}
+
+// CassandraBackupStatus is the status for a CassandraBackup resource
+type CassandraBackupStatus struct {
+	// ObservedGeneration is the generation of the spec last scheduled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastScheduleTime is when the last backup was started.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// Current is the backup in progress.
+	Current *BackupRecord `json:"current,omitempty"`
+	// Backups are the finished backups kept at the destination, the oldest
+	// first, up to the last 100 without retention.
+	Backups []BackupRecord `json:"backups,omitempty"`
+
+	Conditions []CassandraBackupCondition `json:"conditions,omitempty"`
+}
+
+// BackupPhase is the phase of a backup
+type BackupPhase string
+
+const (
+	// BackupSnapshotting is the phase of a backup whose snapshots are being
+	// taken on the nodes.
+	BackupSnapshotting BackupPhase = "Snapshotting"
+	// BackupUploading is the phase of a backup whose snapshots are being
+	// uploaded.
+	BackupUploading BackupPhase = "Uploading"
+	// BackupCompleted is the phase of a backup uploaded with its manifest.
+	BackupCompleted BackupPhase = "Completed"
+	// BackupFailed is the phase of a backup some of whose snapshots couldn't
+	// be uploaded.
+	BackupFailed BackupPhase = "Failed"
+)
+
+// BackupRecord is a backup taken by a CassandraBackup
+type BackupRecord struct {
+	// Name of the backup, the tag of its snapshots on the nodes and its
+	// directory at the destination. Its manifest is kept on the
+	// <name>-manifest ConfigMap.
+	Name           string       `json:"name"`
+	Phase          BackupPhase  `json:"phase"`
+	StartTime      metav1.Time  `json:"startTime"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// CassandraBackupConditionType is the type of a CassandraBackup condition
+type CassandraBackupConditionType string
+
+const (
+	// BackupScheduled is true when the backups of the spec are being taken.
+	BackupScheduled CassandraBackupConditionType = "Scheduled"
+	// BackupSucceeded is true when the last backup completed.
+	BackupSucceeded CassandraBackupConditionType = "Succeeded"
+)
+
+// CassandraBackupCondition describes the state of a CassandraBackup at a certain point
+type CassandraBackupCondition struct {
+	Type               CassandraBackupConditionType `json:"type"`
+	Status             corev1.ConditionStatus       `json:"status"`
+	LastTransitionTime metav1.Time                  `json:"lastTransitionTime,omitempty"`
+	Reason             string                       `json:"reason,omitempty"`
+	Message            string                       `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraBackupList is a list of CassandraBackup resources
+type CassandraBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CassandraBackup `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraRestore is a specification for a CassandraRestore resource, the
+// restore of a backup taken by a CassandraBackup into a CassandraCluster
+type CassandraRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraRestoreSpec   `json:"spec"`
+	Status CassandraRestoreStatus `json:"status"`
+}
+
+// CassandraRestoreSpec is the spec for a CassandraRestore resource
+type CassandraRestoreSpec struct {
+	// BackupName is the CassandraBackup of the namespace that took the
+	// backup, it's downloaded from its destination.
+	BackupName string `json:"backupName"`
+	// Backup is the name of the restored backup, one of the completed
+	// backups of the CassandraBackup. Defaults to its last completed one.
+	Backup string `json:"backup,omitempty"`
+	// ClusterName is the CassandraCluster of the namespace the backup is
+	// restored into, it must have as many nodes as the backed up one. When
+	// it doesn't exist it's created from ClusterTemplate, its nodes
+	// bootstrap with the tokens of the backed up ones.
+	ClusterName string `json:"clusterName"`
+	// ClusterTemplate is the spec of the cluster created when it doesn't
+	// exist. Defaults to the spec of the backed up cluster with ClusterName
+	// as statefulsetName.
+	ClusterTemplate *CassandraClusterSpec `json:"clusterTemplate,omitempty"`
+	// Keyspaces to restore, all the keyspaces of the backup when empty.
+	// Their tables are truncated before the backup is loaded.
+	Keyspaces []string `json:"keyspaces,omitempty"`
+}
+
+// CassandraRestoreStatus is the status for a CassandraRestore resource
+type CassandraRestoreStatus struct {
+	// Backup is the name of the backup being restored.
+	Backup         string       `json:"backup,omitempty"`
+	Phase          RestorePhase `json:"phase,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	Conditions []CassandraRestoreCondition `json:"conditions,omitempty"`
+}
+
+// RestorePhase is the phase of a restore
+type RestorePhase string
+
+const (
+	// RestoreBootstrapping is the phase of a restore waiting for the nodes
+	// of its cluster, created with the tokens of the backup when it didn't
+	// exist.
+	RestoreBootstrapping RestorePhase = "Bootstrapping"
+	// RestorePreparing is the phase of a restore creating the schema of the
+	// backup.
+	RestorePreparing RestorePhase = "Preparing"
+	// RestoreDownloading is the phase of a restore whose backup is being
+	// downloaded on the data volumes of the nodes, next to their tables.
+	RestoreDownloading RestorePhase = "Downloading"
+	// RestoreTruncating is the phase of a restore truncating its tables once
+	// the backup is downloaded on every node.
+	RestoreTruncating RestorePhase = "Truncating"
+	// RestoreRefreshing is the phase of a restore moving the downloaded
+	// backup into the tables of the nodes and loading them.
+	RestoreRefreshing RestorePhase = "Refreshing"
+	// RestoreCompleted is the phase of a restore whose backup is loaded, the
+	// clients can reach the cluster again.
+	RestoreCompleted RestorePhase = "Completed"
+	// RestoreFailed is the phase of a restore that couldn't download the
+	// backup, or whose cluster doesn't hold the tokens of the backup. Its
+	// tables are left untouched and the clients can reach it again.
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// CassandraRestoreConditionType is the type of a CassandraRestore condition
+type CassandraRestoreConditionType string
+
+const (
+	// RestoreSucceeded is true when the backup is restored.
+	RestoreSucceeded CassandraRestoreConditionType = "Succeeded"
+)
+
+// CassandraRestoreCondition describes the state of a CassandraRestore at a certain point
+type CassandraRestoreCondition struct {
+	Type               CassandraRestoreConditionType `json:"type"`
+	Status             corev1.ConditionStatus        `json:"status"`
+	LastTransitionTime metav1.Time                   `json:"lastTransitionTime,omitempty"`
+	Reason             string                        `json:"reason,omitempty"`
+	Message            string                        `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraRestoreList is a list of CassandraRestore resources
+type CassandraRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CassandraRestore `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraTask is a specification for a CassandraTask resource, an ad-hoc
+// operation run on the nodes of a CassandraCluster
+type CassandraTask struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CassandraTaskSpec   `json:"spec"`
+	Status CassandraTaskStatus `json:"status"`
+}
+
+// CassandraTaskSpec is the spec for a CassandraTask resource
+type CassandraTaskSpec struct {
+	// ClusterName is the CassandraCluster of the namespace whose nodes run
+	// the operation.
+	ClusterName string `json:"clusterName"`
+	// Operation run on the nodes with nodetool.
+	Operation TaskOperation `json:"operation"`
+	// Arguments of the operation, like the keyspace and tables of a cleanup,
+	// compaction, garbage collect or flush, or the source datacenter of a
+	// rebuild. Options are refused.
+	Arguments []string `json:"arguments,omitempty"`
+	// Datacenter restricts the operation to the nodes of the datacenter.
+	Datacenter string `json:"datacenter,omitempty"`
+	// Rack restricts the operation to the nodes of the rack of the cluster.
+	Rack string `json:"rack,omitempty"`
+	// Concurrency is the number of nodes running the operation at the same
+	// time, defaults to 1.
+	Concurrency int32 `json:"concurrency,omitempty"`
+	// TTLSecondsAfterFinished deletes the task once it finished for that
+	// long, it's kept when not set.
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// TaskOperation is the operation of a CassandraTask
+type TaskOperation string
+
+const (
+	// TaskCleanup removes the data of the ranges the nodes no longer own.
+	TaskCleanup TaskOperation = "Cleanup"
+	// TaskCompaction forces a major compaction of the tables.
+	TaskCompaction TaskOperation = "Compaction"
+	// TaskGarbageCollect removes the deleted data from the tables.
+	TaskGarbageCollect TaskOperation = "GarbageCollect"
+	// TaskFlush flushes the memtables to disk.
+	TaskFlush TaskOperation = "Flush"
+	// TaskRebuild streams the data of the nodes from another datacenter.
+	TaskRebuild TaskOperation = "Rebuild"
+)
+
+// CassandraTaskStatus is the status for a CassandraTask resource
+type CassandraTaskStatus struct {
+	Phase          TaskPhase    `json:"phase,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Nodes are the results of the operation on the targeted nodes.
+	Nodes []TaskNodeStatus `json:"nodes,omitempty"`
+
+	Conditions []CassandraTaskCondition `json:"conditions,omitempty"`
+}
+
+// TaskNodeStatus is the result of the operation of a task on a node
+type TaskNodeStatus struct {
+	Pod            string       `json:"pod"`
+	Phase          TaskPhase    `json:"phase"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message is the end of the output of the operation, or its error.
+	Message string `json:"message,omitempty"`
+}
+
+// TaskPhase is the phase of a task or of its operation on a node
+type TaskPhase string
+
+const (
+	// TaskPending is the phase of the nodes waiting to run the operation.
+	TaskPending TaskPhase = "Pending"
+	// TaskRunning is the phase of a task whose nodes run the operation.
+	TaskRunning TaskPhase = "Running"
+	// TaskSucceeded is the phase of a task whose operation succeeded on
+	// every node.
+	TaskSucceeded TaskPhase = "Succeeded"
+	// TaskFailed is the phase of a task whose operation failed on a node.
+	TaskFailed TaskPhase = "Failed"
+)
+
+// CassandraTaskConditionType is the type of a CassandraTask condition
+type CassandraTaskConditionType string
+
+const (
+	// TaskComplete is true when the operation ran on every node.
+	TaskComplete CassandraTaskConditionType = "Complete"
+)
+
+// CassandraTaskCondition describes the state of a CassandraTask at a certain point
+type CassandraTaskCondition struct {
+	Type               CassandraTaskConditionType `json:"type"`
+	Status             corev1.ConditionStatus     `json:"status"`
+	LastTransitionTime metav1.Time                `json:"lastTransitionTime,omitempty"`
+	Reason             string                     `json:"reason,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CassandraTaskList is a list of CassandraTask resources
+type CassandraTaskList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CassandraTask `json:"items"`
+}
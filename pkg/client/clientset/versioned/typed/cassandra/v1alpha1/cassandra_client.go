@@ -28,6 +28,11 @@ import (
 type CassandraV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	CassandraClustersGetter
+	CassandraTasksGetter
+	CassandraRestoresGetter
+	CassandraBackupsGetter
+	CassandraKeyspacesGetter
+	CassandraRolesGetter
 }
 
 // CassandraV1alpha1Client is used to interact with features provided by the cassandra.camilocot group.
@@ -39,6 +44,26 @@ func (c *CassandraV1alpha1Client) CassandraClusters(namespace string) CassandraC
 	return newCassandraClusters(c, namespace)
 }
 
+func (c *CassandraV1alpha1Client) CassandraRoles(namespace string) CassandraRoleInterface {
+	return newCassandraRoles(c, namespace)
+}
+
+func (c *CassandraV1alpha1Client) CassandraKeyspaces(namespace string) CassandraKeyspaceInterface {
+	return newCassandraKeyspaces(c, namespace)
+}
+
+func (c *CassandraV1alpha1Client) CassandraBackups(namespace string) CassandraBackupInterface {
+	return newCassandraBackups(c, namespace)
+}
+
+func (c *CassandraV1alpha1Client) CassandraRestores(namespace string) CassandraRestoreInterface {
+	return newCassandraRestores(c, namespace)
+}
+
+func (c *CassandraV1alpha1Client) CassandraTasks(namespace string) CassandraTaskInterface {
+	return newCassandraTasks(c, namespace)
+}
+
 // NewForConfig creates a new CassandraV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*CassandraV1alpha1Client, error) {
 	config := *c
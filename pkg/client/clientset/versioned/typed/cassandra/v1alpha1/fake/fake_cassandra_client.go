@@ -32,6 +32,26 @@ func (c *FakeCassandraV1alpha1) CassandraClusters(namespace string) v1alpha1.Cas
 	return &FakeCassandraClusters{c, namespace}
 }
 
+func (c *FakeCassandraV1alpha1) CassandraRoles(namespace string) v1alpha1.CassandraRoleInterface {
+	return &FakeCassandraRoles{c, namespace}
+}
+
+func (c *FakeCassandraV1alpha1) CassandraKeyspaces(namespace string) v1alpha1.CassandraKeyspaceInterface {
+	return &FakeCassandraKeyspaces{c, namespace}
+}
+
+func (c *FakeCassandraV1alpha1) CassandraBackups(namespace string) v1alpha1.CassandraBackupInterface {
+	return &FakeCassandraBackups{c, namespace}
+}
+
+func (c *FakeCassandraV1alpha1) CassandraRestores(namespace string) v1alpha1.CassandraRestoreInterface {
+	return &FakeCassandraRestores{c, namespace}
+}
+
+func (c *FakeCassandraV1alpha1) CassandraTasks(namespace string) v1alpha1.CassandraTaskInterface {
+	return &FakeCassandraTasks{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeCassandraV1alpha1) RESTClient() rest.Interface {
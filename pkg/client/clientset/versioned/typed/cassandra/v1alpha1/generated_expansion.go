@@ -19,3 +19,13 @@ limitations under the License.
 package v1alpha1
 
 type CassandraClusterExpansion interface{}
+
+type CassandraRoleExpansion interface{}
+
+type CassandraKeyspaceExpansion interface{}
+
+type CassandraBackupExpansion interface{}
+
+type CassandraRestoreExpansion interface{}
+
+type CassandraTaskExpansion interface{}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The cassandra-crd Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+)
+
+// RequeueAfterError is returned by a handler to sync its resource again once
+// the delay elapses, without reporting an error or taking a worker
+// meanwhile.
+type RequeueAfterError struct {
+	After time.Duration
+}
+
+func (e *RequeueAfterError) Error() string {
+	return fmt.Sprintf("requeued after %s", e.After)
+}
+
+// RequeueAfter returns the error syncing the resource again after the delay.
+func RequeueAfter(after time.Duration) error {
+	return &RequeueAfterError{After: after}
+}
+
+// queue hands the namespace/name keys of the resources to sync to a pool of
+// workers, retrying the keys that fail after a back-off period.
+type queue struct {
+	// workqueue is a rate limited work queue. This is used to queue work to be
+	// processed instead of performing it as soon as a change happens. This
+	// means we can ensure we only process a fixed amount of resources at a
+	// time, and makes it easy to ensure we are never processing the same item
+	// simultaneously in two different workers.
+	workqueue workqueue.RateLimitingInterface
+	// sync converges the resource of the key to its desired state.
+	sync   func(key string) error
+	logger log.Logger
+}
+
+// newQueue returns a queue named name syncing its keys with sync.
+func newQueue(name string, sync func(key string) error, logger log.Logger) *queue {
+	return &queue{
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name),
+		sync:      sync,
+		logger:    logger,
+	}
+}
+
+// add takes a resource and converts it into a namespace/name string which is
+// then put onto the work queue.
+func (q *queue) add(obj interface{}) {
+	var key string
+	var err error
+	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	q.workqueue.Add(key)
+}
+
+// run starts the workers and blocks until stopCh is closed, at which point it
+// will shutdown the workqueue and wait for workers to finish processing their
+// current work items.
+func (q *queue) run(workers int, stopCh <-chan struct{}) {
+	defer q.workqueue.ShutDown()
+
+	// The workqueue never hands the same key to two workers, a slow
+	// resource only blocks its own worker and the events received
+	// meanwhile for it are processed once it's done.
+	q.logger.Infof("Starting %d workers", workers)
+	for i := 0; i < workers; i++ {
+		go wait.Until(q.runWorker, time.Second, stopCh)
+	}
+
+	q.logger.Infof("Started workers")
+	<-stopCh
+	q.logger.Infof("Shutting down workers")
+}
+
+// runWorker is a long-running function that will continually call the
+// processNextWorkItem function in order to read and process a message on the
+// workqueue.
+func (q *queue) runWorker() {
+	for q.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem will read a single work item off the workqueue and
+// attempt to process it, by calling the sync function.
+func (q *queue) processNextWorkItem() bool {
+	obj, shutdown := q.workqueue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	// We wrap this block in a func so we can defer q.workqueue.Done.
+	err := func(obj interface{}) error {
+		// We call Done here so the workqueue knows we have finished
+		// processing this item. We also must remember to call Forget if we
+		// do not want this work item being re-queued. For example, we do
+		// not call Forget if a transient error occurs, instead the item is
+		// put back on the workqueue and attempted again after a back-off
+		// period.
+		defer q.workqueue.Done(obj)
+		var key string
+		var ok bool
+		// We expect strings to come off the workqueue. These are of the
+		// form namespace/name. We do this as the delayed nature of the
+		// workqueue means the items in the informer cache may actually be
+		// more up to date that when the item was initially put onto the
+		// workqueue.
+		if key, ok = obj.(string); !ok {
+			// As the item in the workqueue is actually invalid, we call
+			// Forget here else we'd go into a loop of attempting to
+			// process a work item that is invalid.
+			q.workqueue.Forget(obj)
+			runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+		// Run the sync function, passing it the namespace/name string of the
+		// resource to be synced.
+		err := q.sync(key)
+		if requeue, ok := err.(*RequeueAfterError); ok {
+			// The item is synced again once the delay elapses, its
+			// back-off is reset as it didn't fail.
+			q.workqueue.Forget(obj)
+			q.workqueue.AddAfter(key, requeue.After)
+			q.logger.Debugf("Requeued '%s' after %s", key, requeue.After)
+			return nil
+		}
+		if err != nil {
+			// Put the item back on the workqueue so it is retried after a
+			// back-off period.
+			q.workqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
+		}
+		// Finally, if no error occurs we Forget this item so it does not
+		// get queued again until another change happens.
+		q.workqueue.Forget(obj)
+		q.logger.Debugf("Successfully synced '%s'", key)
+		return nil
+	}(obj)
+
+	if err != nil {
+		q.logger.Errorf("%s", err)
+		return true
+	}
+
+	return true
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The cassandra-crd Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	"github.com/spotahome/kooper/operator/handler"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	cassandraapi "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	informers "github.com/camilocot/cassandra-crd/pkg/client/informers/externalversions"
+	"github.com/camilocot/cassandra-crd/pkg/log"
+)
+
+// ClusterNameFunc returns the CassandraCluster a resource belongs to.
+type ClusterNameFunc func(obj interface{}) string
+
+// ResourceController is the controller implementation for the resources
+// that belong to a CassandraCluster of their namespace, like the
+// CassandraRoles. It watches the resources and their CassandraClusters, and
+// hands the resources to the handler that converges them to the desired
+// state.
+type ResourceController struct {
+	// kind of the resources, like CassandraRole.
+	kind                     string
+	cassandraInformerFactory informers.SharedInformerFactory
+
+	informer                cache.SharedIndexInformer
+	clusterName             ClusterNameFunc
+	cassandraclustersSynced cache.InformerSynced
+
+	// handler ensures the state of the resources taken from the workqueue.
+	handler handler.Handler
+	// workers is the number of resources processed concurrently.
+	workers int
+
+	queue  *queue
+	logger log.Logger
+}
+
+// NewResourceController returns a new controller of the resources of kind
+// watched by informer, an informer of cassandraInformerFactory.
+func NewResourceController(
+	kind string,
+	informer cache.SharedIndexInformer,
+	clusterName ClusterNameFunc,
+	cassandraInformerFactory informers.SharedInformerFactory,
+	handler handler.Handler,
+	workers int,
+	logger log.Logger) *ResourceController {
+
+	cassandraclusterInformer := cassandraInformerFactory.Cassandra().V1alpha1().CassandraClusters()
+
+	controller := &ResourceController{
+		kind:                     kind,
+		cassandraInformerFactory: cassandraInformerFactory,
+		informer:                 informer,
+		clusterName:              clusterName,
+		cassandraclustersSynced:  cassandraclusterInformer.Informer().HasSynced,
+		handler:                  handler,
+		workers:                  workers,
+		logger:                   logger,
+	}
+	controller.queue = newQueue(kind+"s", controller.syncHandler, logger)
+
+	logger.Infof("Setting up %s event handlers", kind)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.queue.add,
+		UpdateFunc: func(old, new interface{}) {
+			controller.queue.add(new)
+		},
+		DeleteFunc: controller.queue.add,
+	})
+	// The resources usually wait for their cluster to be ready, they are
+	// requeued when their cluster changes.
+	cassandraclusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueClusterResources,
+		UpdateFunc: func(old, new interface{}) {
+			// The resources are resynced on their own, the periodic resync
+			// of the clusters is ignored.
+			if new.(metav1.Object).GetResourceVersion() == old.(metav1.Object).GetResourceVersion() {
+				return
+			}
+			controller.enqueueClusterResources(new)
+		},
+	})
+
+	return controller
+}
+
+// Run will start the informer factory and the workers. It will block until
+// stopCh is closed. Satisfies kooper controller.Controller interface.
+func (c *ResourceController) Run(stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+
+	c.logger.Infof("Starting %s controller", c.kind)
+	c.cassandraInformerFactory.Start(stopCh)
+
+	c.logger.Infof("Waiting for %s informer caches to sync", c.kind)
+	if ok := cache.WaitForCacheSync(stopCh, c.informer.HasSynced, c.cassandraclustersSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	c.queue.run(c.workers, stopCh)
+	return nil
+}
+
+// syncHandler gets the resource of the key from the cache and passes it to
+// the handler, which converges the actual state with the desired one.
+func (c *ResourceController) syncHandler(key string) error {
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return c.handler.Delete(key)
+	}
+
+	if c.clusterName(obj) == "" {
+		utilruntime.HandleError(fmt.Errorf("%s: cluster name must be specified", key))
+		return nil
+	}
+
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	return c.handler.Add(obj.(runtime.Object).DeepCopyObject())
+}
+
+// enqueueClusterResources enqueues the resources of a CassandraCluster.
+func (c *ResourceController) enqueueClusterResources(obj interface{}) {
+	cassandracluster, ok := obj.(*cassandraapi.CassandraCluster)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+		return
+	}
+
+	objs, err := c.informer.GetIndexer().ByIndex(cache.NamespaceIndex, cassandracluster.Namespace)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		if c.clusterName(obj) == cassandracluster.Name {
+			c.queue.add(obj)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package cql
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+)
+
+// sessionIdleTimeout is how long a pooled session is kept open without
+// queries, like the sessions of replaced credentials.
+const sessionIdleTimeout = 10 * time.Minute
+
+// pooledSession is the session of a cluster configuration.
+type pooledSession struct {
+	key string
+	// ready is closed once the session is dialed, with session or err set.
+	ready   chan struct{}
+	session closableSession
+	err     error
+	// inFlight are the dials and queries using the session, it's only
+	// closed without them. closing closes it once the last one is done.
+	inFlight int
+	closing  bool
+	lastUsed time.Time
+}
+
+// closableSession is a Session the pool closes once it's no longer used.
+type closableSession interface {
+	Session
+	Close()
+}
+
+// dialFunc dials the session to the nodes of a cluster.
+type dialFunc func(cluster Cluster) (closableSession, error)
+
+// PooledClient is the Client implementation using gocql. It keeps a session
+// per cluster configuration, so the sessions of a cluster with other
+// credentials or hosts don't replace each other. The sessions are dialed
+// without holding the pool, and closed once idle.
+type PooledClient struct {
+	mu       sync.Mutex
+	sessions map[string]*pooledSession
+	dial     dialFunc
+	logger   log.Logger
+}
+
+// NewClient returns a new pooled Client.
+func NewClient(logger log.Logger) *PooledClient {
+	return newPooledClient(newSession, logger)
+}
+
+func newPooledClient(dial dialFunc, logger log.Logger) *PooledClient {
+	return &PooledClient{
+		sessions: map[string]*pooledSession{},
+		dial:     dial,
+		logger:   logger,
+	}
+}
+
+// Session satisfies Client interface. The queries of the session run on the
+// pooled session of the cluster, dialed again when it was closed while idle.
+func (c *PooledClient) Session(cluster Cluster) (Session, error) {
+	pooled, err := c.acquire(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c.release(pooled)
+	return &session{client: c, cluster: cluster}, nil
+}
+
+// Close satisfies Client interface. The sessions with queries in flight are
+// closed once they're done.
+func (c *PooledClient) Close(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, pooled := range c.sessions {
+		if pooled.key != key {
+			continue
+		}
+		delete(c.sessions, id)
+		pooled.closing = true
+		c.closeUnused(pooled)
+	}
+	c.logger.Debugf("cql sessions of %s closed", key)
+}
+
+// acquire returns the pooled session of the cluster configuration, dialing it
+// when there's none. The pool is not held while dialing, the callers of the
+// same configuration wait for the dial. The session must be released.
+func (c *PooledClient) acquire(cluster Cluster) (*pooledSession, error) {
+	id, err := sessionID(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.closeIdle(time.Now())
+	pooled, ok := c.sessions[id]
+	if !ok {
+		pooled = &pooledSession{key: cluster.Key, ready: make(chan struct{})}
+		c.sessions[id] = pooled
+	}
+	pooled.inFlight++
+	c.mu.Unlock()
+
+	if !ok {
+		pooled.session, pooled.err = c.dial(cluster)
+		if pooled.err == nil {
+			c.logger.Debugf("cql session to %s:%d created for %s", cluster.Host, cluster.Port, cluster.Key)
+		}
+		close(pooled.ready)
+	}
+	<-pooled.ready
+	if pooled.err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		pooled.inFlight--
+		if c.sessions[id] == pooled {
+			delete(c.sessions, id)
+		}
+		return nil, pooled.err
+	}
+	return pooled, nil
+}
+
+// release marks the end of a use of the session.
+func (c *PooledClient) release(pooled *pooledSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pooled.inFlight--
+	pooled.lastUsed = time.Now()
+	c.closeUnused(pooled)
+}
+
+// closeIdle closes the sessions without queries since the idle timeout. The
+// pool must be held.
+func (c *PooledClient) closeIdle(now time.Time) {
+	for id, pooled := range c.sessions {
+		if pooled.inFlight > 0 || now.Sub(pooled.lastUsed) < sessionIdleTimeout {
+			continue
+		}
+		delete(c.sessions, id)
+		pooled.closing = true
+		c.closeUnused(pooled)
+		c.logger.Debugf("idle cql session of %s closed", pooled.key)
+	}
+}
+
+// closeUnused closes the session being closed once nothing uses it. The pool
+// must be held.
+func (c *PooledClient) closeUnused(pooled *pooledSession) {
+	if pooled.closing && pooled.inFlight == 0 && pooled.session != nil {
+		pooled.session.Close()
+	}
+}
+
+// sessionID returns the ID of the session of the cluster configuration.
+func sessionID(cluster Cluster) (string, error) {
+	raw, err := json.Marshal(cluster)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%x", cluster.Key, sha256.Sum256(raw)), nil
+}
+
+// newSession returns a gocql session to the nodes of the cluster.
+func newSession(cluster Cluster) (closableSession, error) {
+	config := gocql.NewCluster(cluster.Host)
+	config.Port = cluster.Port
+	if config.Port == 0 {
+		config.Port = DefaultPort
+	}
+	config.ProtoVersion = 4
+	config.Timeout = DefaultTimeout
+	config.ConnectTimeout = DefaultTimeout
+	config.Consistency = gocql.Quorum
+	if cluster.Credentials.Username != "" {
+		config.Authenticator = gocql.PasswordAuthenticator{
+			Username: cluster.Credentials.Username,
+			Password: cluster.Credentials.Password,
+		}
+	}
+	if cluster.TLS != nil {
+		tlsConfig, err := newTLSConfig(cluster.Host, cluster.TLS)
+		if err != nil {
+			return nil, err
+		}
+		config.SslOpts = &gocql.SslOptions{Config: tlsConfig, EnableHostVerification: true}
+	}
+	session, err := config.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	return &gocqlSession{session: session}, nil
+}
+
+// gocqlSession adapts a gocql session to Session.
+type gocqlSession struct {
+	session *gocql.Session
+}
+
+func (s *gocqlSession) Query(statement string, values ...interface{}) Query {
+	return &gocqlQuery{query: s.session.Query(statement, values...)}
+}
+
+func (s *gocqlSession) Close() {
+	s.session.Close()
+}
+
+// gocqlQuery adapts a gocql query to Query.
+type gocqlQuery struct {
+	query *gocql.Query
+}
+
+func (q *gocqlQuery) Exec() error {
+	return q.query.Exec()
+}
+
+func (q *gocqlQuery) Scan(dest ...interface{}) error {
+	return q.query.Scan(dest...)
+}
+
+func (q *gocqlQuery) Iter() Iter {
+	return q.query.Iter()
+}
+
+// newTLSConfig returns the TLS configuration verifying the certificates of
+// the nodes with the CA certificate.
+func newTLSConfig(host string, conf *TLSConfig) (*tls.Config, error) {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(conf.CACert) {
+		return nil, fmt.Errorf("no valid CA certificate to verify the nodes of %s", host)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    roots,
+		ServerName: conf.ServerName,
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if len(conf.Cert) > 0 || len(conf.Key) > 0 {
+		cert, err := tls.X509KeyPair(conf.Cert, conf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate for %s: %s", host, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// session is the Session of a cluster configuration, its queries run on the
+// pooled session.
+type session struct {
+	client  *PooledClient
+	cluster Cluster
+}
+
+func (s *session) Query(statement string, values ...interface{}) Query {
+	return &query{session: s, statement: statement, values: values}
+}
+
+// query runs a statement on the pooled session of its cluster.
+type query struct {
+	session   *session
+	statement string
+	values    []interface{}
+}
+
+// run runs f with the query of the statement on the pooled session, which is
+// not closed meanwhile.
+func (q *query) run(f func(Query) error) error {
+	pooled, err := q.session.client.acquire(q.session.cluster)
+	if err != nil {
+		return err
+	}
+	defer q.session.client.release(pooled)
+	return f(pooled.session.Query(q.statement, q.values...))
+}
+
+func (q *query) Exec() error {
+	return q.run(func(query Query) error {
+		return query.Exec()
+	})
+}
+
+func (q *query) Scan(dest ...interface{}) error {
+	return q.run(func(query Query) error {
+		return query.Scan(dest...)
+	})
+}
+
+func (q *query) Iter() Iter {
+	client := q.session.client
+	pooled, err := client.acquire(q.session.cluster)
+	if err != nil {
+		return &iter{err: err}
+	}
+	return &iter{
+		iter:    pooled.session.Query(q.statement, q.values...).Iter(),
+		release: func() { client.release(pooled) },
+	}
+}
+
+// iter is the iterator of a query on the pooled session, which is released
+// when it's closed.
+type iter struct {
+	iter    Iter
+	err     error
+	release func()
+}
+
+func (i *iter) Scan(dest ...interface{}) bool {
+	if i.iter == nil {
+		return false
+	}
+	return i.iter.Scan(dest...)
+}
+
+func (i *iter) Close() error {
+	if i.iter == nil {
+		return i.err
+	}
+	err := i.iter.Close()
+	i.release()
+	i.iter, i.err = nil, err
+	return err
+}
@@ -0,0 +1,154 @@
+package cql
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+)
+
+// fakeDialer dials a FakeSession per call, recording them.
+type fakeDialer struct {
+	mu       sync.Mutex
+	sessions []*FakeSession
+	err      error
+}
+
+func (d *fakeDialer) dial(cluster Cluster) (closableSession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	session := NewFakeSession()
+	d.sessions = append(d.sessions, session)
+	return session, nil
+}
+
+func (d *fakeDialer) dialed() []*FakeSession {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*FakeSession(nil), d.sessions...)
+}
+
+func newTestClient(dialer *fakeDialer) *PooledClient {
+	return newPooledClient(dialer.dial, log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat))
+}
+
+func testCluster(username string) Cluster {
+	return Cluster{
+		Key:         "default/test",
+		Host:        "cassandra.default.svc.cluster.local",
+		Credentials: Credentials{Username: username, Password: "secret"},
+	}
+}
+
+func exec(t *testing.T, client *PooledClient, cluster Cluster, statement string) {
+	session, err := client.Session(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Query(statement).Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPooledClientSessions(t *testing.T) {
+	dialer := &fakeDialer{}
+	client := newTestClient(dialer)
+
+	// The callers of the same configuration share its session.
+	exec(t, client, testCluster("admin"), "CREATE ROLE a")
+	exec(t, client, testCluster("admin"), "CREATE ROLE b")
+	if dialed := dialer.dialed(); len(dialed) != 1 || len(dialed[0].Executed) != 2 {
+		t.Fatalf("got %d sessions, want one running both statements", len(dialed))
+	}
+
+	// Other credentials of the cluster get their own session, the first one
+	// is kept.
+	exec(t, client, testCluster("other"), "CREATE ROLE c")
+	dialed := dialer.dialed()
+	if len(dialed) != 2 {
+		t.Fatalf("got %d sessions, want one per configuration", len(dialed))
+	}
+	if dialed[0].Closed || len(dialed[1].Executed) != 1 {
+		t.Errorf("the session of the other credentials replaced the first one")
+	}
+
+	// The sessions of the cluster are closed together, and dialed again.
+	client.Close("default/test")
+	if !dialed[0].Closed || !dialed[1].Closed {
+		t.Errorf("the sessions of the cluster weren't closed")
+	}
+	exec(t, client, testCluster("admin"), "CREATE ROLE d")
+	if dialed := dialer.dialed(); len(dialed) != 3 || len(dialed[2].Executed) != 1 {
+		t.Errorf("got %d sessions, want the closed session dialed again", len(dialed))
+	}
+}
+
+func TestPooledClientDialError(t *testing.T) {
+	dialer := &fakeDialer{err: fmt.Errorf("connection refused")}
+	client := newTestClient(dialer)
+
+	if _, err := client.Session(testCluster("admin")); err == nil {
+		t.Fatal("got no error dialing an unreachable cluster")
+	}
+	// The failed dial is not pooled, the next caller dials again.
+	dialer.err = nil
+	exec(t, client, testCluster("admin"), "CREATE ROLE a")
+	if dialed := dialer.dialed(); len(dialed) != 1 {
+		t.Errorf("got %d sessions, want one", len(dialed))
+	}
+}
+
+// idle makes the sessions of the pool idle since the idle timeout.
+func idle(client *PooledClient) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for _, pooled := range client.sessions {
+		pooled.lastUsed = time.Now().Add(-sessionIdleTimeout)
+	}
+}
+
+func TestPooledClientIdleSessions(t *testing.T) {
+	dialer := &fakeDialer{}
+	client := newTestClient(dialer)
+
+	exec(t, client, testCluster("admin"), "CREATE ROLE a")
+	session, err := client.Session(testCluster("reader"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := session.Query("SELECT role FROM system_auth.roles").Iter()
+
+	// The idle sessions are closed when the pool is used, the ones with
+	// queries in flight are kept until they're done.
+	idle(client)
+	exec(t, client, testCluster("other"), "CREATE ROLE b")
+	dialed := dialer.dialed()
+	if !dialed[0].Closed {
+		t.Errorf("idle session not closed")
+	}
+	if dialed[1].Closed {
+		t.Errorf("session with a query in flight closed")
+	}
+	if dialed[2].Closed {
+		t.Errorf("session in use closed")
+	}
+
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	idle(client)
+	exec(t, client, testCluster("admin"), "CREATE ROLE c")
+	if !dialed[1].Closed || !dialed[2].Closed {
+		t.Errorf("idle sessions not closed once their queries are done")
+	}
+	// A closed idle session is dialed again.
+	if dialed := dialer.dialed(); len(dialed) != 4 || len(dialed[3].Executed) != 1 {
+		t.Errorf("got %d sessions, want the idle session dialed again", len(dialed))
+	}
+}
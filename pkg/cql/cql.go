@@ -0,0 +1,108 @@
+// Package cql connects the operator to the cassandra clusters through the
+// CQL native protocol.
+package cql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// UsernameKey is the key of the credential secrets with the username.
+	UsernameKey = "username"
+	// PasswordKey is the key of the credential secrets with the password.
+	PasswordKey = "password"
+
+	// DefaultPort is the CQL native protocol port of the cassandra nodes.
+	DefaultPort = 9042
+	// DefaultTimeout is the timeout of the connections and the queries.
+	DefaultTimeout = 10 * time.Second
+)
+
+// ErrNotFound is returned by Query.Scan when the query returns no row.
+var ErrNotFound = gocql.ErrNotFound
+
+// Credentials of a cassandra role. The sessions without username are not
+// authenticated.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// SecretCredentials returns the credentials of the username and password keys
+// of the secret.
+func SecretCredentials(secret *corev1.Secret) (Credentials, error) {
+	creds := Credentials{
+		Username: string(secret.Data[UsernameKey]),
+		Password: string(secret.Data[PasswordKey]),
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return Credentials{}, fmt.Errorf("secret %s/%s must have the %s and %s keys", secret.Namespace, secret.Name, UsernameKey, PasswordKey)
+	}
+	return creds, nil
+}
+
+// TLSConfig is the client encryption of the connections, with PEM encoded
+// certificates.
+type TLSConfig struct {
+	// CACert verifies the certificates of the nodes.
+	CACert []byte
+	// Cert and Key are the client certificate, required by the nodes that
+	// verify the clients.
+	Cert []byte
+	Key  []byte
+	// ServerName is the name verified on the certificates of the nodes, the
+	// host of the cluster when empty.
+	ServerName string
+}
+
+// Cluster is the cassandra cluster a session connects to.
+type Cluster struct {
+	// Key identifies the cluster, its sessions are closed together.
+	Key string
+	// Host resolves to the nodes of the cluster, like its headless service.
+	Host        string
+	Port        int
+	Credentials Credentials
+	// TLS encrypts the connections when set.
+	TLS *TLSConfig
+}
+
+// Session runs the queries on a cassandra cluster. It's safe for concurrent
+// use.
+type Session interface {
+	Query(statement string, values ...interface{}) Query
+}
+
+// Query is a CQL statement with its bound values.
+type Query interface {
+	// Exec runs the statement discarding its rows.
+	Exec() error
+	// Scan copies the columns of the first row into dest, it returns
+	// ErrNotFound without rows.
+	Scan(dest ...interface{}) error
+	// Iter runs the statement returning an iterator over its rows.
+	Iter() Iter
+}
+
+// Iter iterates over the rows of a query.
+type Iter interface {
+	// Scan copies the columns of the next row into dest, it returns false
+	// when there are no more rows or the query failed.
+	Scan(dest ...interface{}) bool
+	// Close returns the error of the query, if any.
+	Close() error
+}
+
+// Client returns the sessions to the cassandra clusters.
+type Client interface {
+	// Session returns the session to the cluster, shared with the other
+	// callers of the same cluster configuration, it must not be closed.
+	Session(cluster Cluster) (Session, error)
+	// Close closes the sessions of the cluster key, like when the cluster is
+	// deleted.
+	Close(key string)
+}
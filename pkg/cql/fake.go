@@ -0,0 +1,189 @@
+package cql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// FakeClient is a Client returning a FakeSession per cluster key, for the
+// tests of the operator.
+type FakeClient struct {
+	mu sync.Mutex
+	// Sessions are the sessions returned per cluster key, created empty on
+	// demand.
+	Sessions map[string]*FakeSession
+	// Err is returned instead of a session when set.
+	Err error
+}
+
+// NewFakeClient returns a new FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		Sessions: map[string]*FakeSession{},
+	}
+}
+
+// Session satisfies Client interface.
+func (c *FakeClient) Session(cluster Cluster) (Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	s, ok := c.Sessions[cluster.Key]
+	if !ok {
+		s = NewFakeSession()
+		c.Sessions[cluster.Key] = s
+	}
+	return s, nil
+}
+
+// Close satisfies Client interface.
+func (c *FakeClient) Close(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.Sessions[key]; ok {
+		s.Close()
+		delete(c.Sessions, key)
+	}
+}
+
+// FakeSession is a Session answering the queries with canned rows and
+// recording the executed statements.
+type FakeSession struct {
+	mu sync.Mutex
+	// Rows are the rows returned by the statements starting with each
+	// prefix, the longest matching prefix wins. The values of a row are
+	// assigned to the scan destinations in order.
+	Rows map[string][][]interface{}
+	// Errors are returned by the statements starting with each prefix.
+	Errors map[string]error
+	// Executed are the statements run with Exec, in order.
+	Executed []string
+	// Closed is set once the session is closed.
+	Closed bool
+}
+
+// NewFakeSession returns a new FakeSession without rows.
+func NewFakeSession() *FakeSession {
+	return &FakeSession{
+		Rows:   map[string][][]interface{}{},
+		Errors: map[string]error{},
+	}
+}
+
+// Query satisfies Session interface.
+func (s *FakeSession) Query(statement string, values ...interface{}) Query {
+	return &fakeQuery{session: s, statement: statement}
+}
+
+// Close marks the session closed, like the PooledClient does with the
+// sessions it no longer uses.
+func (s *FakeSession) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Closed = true
+}
+
+// result returns the rows and the error of the statement.
+func (s *FakeSession) result(statement string) ([][]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errPrefix, rowsPrefix := "", ""
+	for prefix := range s.Errors {
+		if strings.HasPrefix(statement, prefix) && len(prefix) > len(errPrefix) {
+			errPrefix = prefix
+		}
+	}
+	if err := s.Errors[errPrefix]; err != nil {
+		return nil, err
+	}
+	for prefix := range s.Rows {
+		if strings.HasPrefix(statement, prefix) && len(prefix) > len(rowsPrefix) {
+			rowsPrefix = prefix
+		}
+	}
+	return s.Rows[rowsPrefix], nil
+}
+
+func (s *FakeSession) exec(statement string) error {
+	if _, err := s.result(statement); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Executed = append(s.Executed, statement)
+	return nil
+}
+
+// fakeQuery is the Query of a FakeSession.
+type fakeQuery struct {
+	session   *FakeSession
+	statement string
+}
+
+func (q *fakeQuery) Exec() error {
+	return q.session.exec(q.statement)
+}
+
+func (q *fakeQuery) Scan(dest ...interface{}) error {
+	rows, err := q.session.result(q.statement)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return scanRow(rows[0], dest)
+}
+
+func (q *fakeQuery) Iter() Iter {
+	rows, err := q.session.result(q.statement)
+	return &fakeIter{rows: rows, err: err}
+}
+
+// fakeIter is the Iter of a FakeSession.
+type fakeIter struct {
+	rows [][]interface{}
+	err  error
+}
+
+func (i *fakeIter) Scan(dest ...interface{}) bool {
+	if i.err != nil || len(i.rows) == 0 {
+		return false
+	}
+	i.err = scanRow(i.rows[0], dest)
+	i.rows = i.rows[1:]
+	return i.err == nil
+}
+
+func (i *fakeIter) Close() error {
+	return i.err
+}
+
+// scanRow assigns the values of the row to the pointers of dest.
+func scanRow(row []interface{}, dest []interface{}) error {
+	if len(row) != len(dest) {
+		return fmt.Errorf("row has %d columns, %d destinations given", len(row), len(dest))
+	}
+	for i, value := range row {
+		target := reflect.ValueOf(dest[i])
+		if target.Kind() != reflect.Ptr || target.IsNil() {
+			return fmt.Errorf("destination %d is not a pointer", i)
+		}
+		if value == nil {
+			target.Elem().Set(reflect.Zero(target.Elem().Type()))
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if !v.Type().AssignableTo(target.Elem().Type()) {
+			return fmt.Errorf("column %d of type %s can't be scanned into %s", i, v.Type(), target.Elem().Type())
+		}
+		target.Elem().Set(v)
+	}
+	return nil
+}
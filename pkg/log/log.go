@@ -1,11 +1,205 @@
 package log
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/spotahome/kooper/log"
 )
 
-// Logger is the interface of the operator logger. This is an example
-// so our Loggger will be the same as the kooper one.
+// Logger is the interface of the operator logger. It satisfies the kooper
+// logger so it can be passed to the kooper components, and adds the debug
+// level and the key/value fields attached to every message.
 type Logger interface {
 	log.Logger
+	Debugf(format string, args ...interface{})
+	// With returns a logger adding the key/value pairs to the fields of
+	// this logger.
+	With(keyvals ...interface{}) Logger
+}
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	// DebugLevel logs the detailed progress of the operator.
+	DebugLevel Level = iota
+	// InfoLevel logs the changes done by the operator.
+	InfoLevel
+	// WarningLevel logs the unexpected states the operator recovers from.
+	WarningLevel
+	// ErrorLevel logs the errors.
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel:   "debug",
+	InfoLevel:    "info",
+	WarningLevel: "warning",
+	ErrorLevel:   "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of its name.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q, valid levels are debug, info, warning and error", name)
+}
+
+// Format is the format of the log lines.
+type Format string
+
+const (
+	// TextFormat writes the fields as key=value pairs.
+	TextFormat Format = "text"
+	// JSONFormat writes every line as a JSON object.
+	JSONFormat Format = "json"
+)
+
+// ParseFormat returns the format of its name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case TextFormat, JSONFormat:
+		return format, nil
+	}
+	return TextFormat, fmt.Errorf("unknown log format %q, valid formats are text and json", name)
+}
+
+// field is a key/value pair attached to the log lines.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// logger writes the messages with at least its level to out.
+type logger struct {
+	// mu serializes the writes of all the loggers sharing out.
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	format Format
+	fields []field
+}
+
+// New returns a logger writing the messages with at least the level to out.
+func New(out io.Writer, level Level, format Format) Logger {
+	return &logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		format: format,
+	}
+}
+
+func (l *logger) With(keyvals ...interface{}) Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+len(keyvals)/2+1)
+	copy(fields, l.fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		f := field{key: fmt.Sprint(keyvals[i]), value: "MISSING"}
+		if i+1 < len(keyvals) {
+			f.value = keyvals[i+1]
+		}
+		fields = append(fields, f)
+	}
+
+	with := *l
+	with.fields = fields
+	return &with
+}
+
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, format, args...)
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, format, args...)
+}
+
+func (l *logger) Warningf(format string, args ...interface{}) {
+	l.log(WarningLevel, format, args...)
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, format, args...)
+}
+
+func (l *logger) log(level Level, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+
+	fields := append([]field{
+		{key: "time", value: time.Now().UTC().Format(time.RFC3339)},
+		{key: "level", value: level.String()},
+		{key: "msg", value: fmt.Sprintf(format, args...)},
+	}, l.fields...)
+
+	var line []byte
+	if l.format == JSONFormat {
+		line = jsonLine(fields)
+	} else {
+		line = textLine(fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// textLine returns the fields as key=value pairs, quoting the values with
+// spaces or quotes.
+func textLine(fields []field) []byte {
+	var buf bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(f.key)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// jsonLine returns the fields as a JSON object keeping their order. The
+// values that can't be marshalled are written as strings.
+func jsonLine(fields []field) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err, ok := f.value.(error); ok {
+			f.value = err.Error()
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
 }
@@ -0,0 +1,292 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+const (
+	// StorageRequired is used as part of the Event 'reason' when the cluster of a CassandraBackup has no persistent storage
+	StorageRequired = "StorageRequired"
+	// BackupScheduled is used as part of the conditions of a scheduled CassandraBackup
+	BackupScheduled = "BackupScheduled"
+	// BackupStarted is used as part of the Event 'reason' when a backup of a CassandraBackup starts
+	BackupStarted = "BackupStarted"
+	// BackupCompleted is used as part of the Event 'reason' when a backup of a CassandraBackup completes
+	BackupCompleted = "BackupCompleted"
+	// BackupFailed is used as part of the Event 'reason' when a backup of a CassandraBackup fails
+	BackupFailed = "BackupFailed"
+	// BackupPruned is used as part of the Event 'reason' when a backup of a CassandraBackup is pruned
+	BackupPruned = "BackupPruned"
+
+	// MessageStorageRequired is the message used for conditions when the cluster of a CassandraBackup has no persistent storage
+	MessageStorageRequired = "CassandraCluster %q has no persistent storage to back up"
+	// MessageBackupScheduled is the message used for conditions when the next backup of a CassandraBackup is scheduled
+	MessageBackupScheduled = "Next backup of CassandraCluster %q at %s"
+	// MessageBackupTaken is the message used for conditions when the single backup of a CassandraBackup was taken
+	MessageBackupTaken = "Backup of CassandraCluster %q taken, it has no schedule"
+	// MessageBackupStarted is the message used for an Event fired when a backup of a CassandraBackup starts
+	MessageBackupStarted = "Backup %q snapshotted, uploading it"
+	// MessageBackupCompleted is the message used for an Event fired when a backup of a CassandraBackup completes
+	MessageBackupCompleted = "Backup %q completed"
+	// MessageBackupFailed is the message used for an Event fired when a backup of a CassandraBackup fails
+	MessageBackupFailed = "Backup %q failed to upload the snapshots of %s"
+	// MessageBackupPruned is the message used for an Event fired when a backup of a CassandraBackup is pruned
+	MessageBackupPruned = "Backup %q pruned"
+)
+
+// maxBackupRecords is the number of backups recorded on the status of a
+// CassandraBackup without retention.
+const maxBackupRecords = 100
+
+// backupHandler is the cassandra backup handler that will handle the events
+// received from kubernetes.
+type backupHandler struct {
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the snapshots and the jobs, no backup is taken.
+	dryRun bool
+	logger log.Logger
+}
+
+// newBackupHandler returns a new backup handler.
+func newBackupHandler(ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool, logger log.Logger) *backupHandler {
+	return &backupHandler{
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+		logger:   logger,
+	}
+}
+
+func (h *backupHandler) Add(obj runtime.Object) error {
+	backup, ok := obj.(*cassandrav1alpha1.CassandraBackup)
+	if !ok {
+		return fmt.Errorf("%v is not a cassandra backup object", obj.GetObjectKind())
+	}
+
+	logger := h.logger.With("namespace", backup.Namespace, "backup", backup.Name, "reconcile", rand.String(8))
+	return h.withLogger(logger).Ensure(backup)
+}
+
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *backupHandler) withLogger(logger log.Logger) *backupHandler {
+	return newBackupHandler(h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
+
+// Delete is called when a cassandra backup is deleted, its jobs and manifests
+// are garbage collected while the backups are kept at their destination.
+func (h *backupHandler) Delete(name string) error {
+	h.logger.Infof("cassandra backup %s deleted, its backups are kept at their destination", name)
+	return nil
+}
+
+func (h *backupHandler) Ensure(backup *cassandrav1alpha1.CassandraBackup) error {
+	status := backup.Status.DeepCopy()
+	err := h.ensureBackup(backup, status)
+	if h.dryRun {
+		// The status is not written on dry run.
+		return err
+	}
+	if updateErr := h.updateStatus(backup, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// ensureBackup starts the backups when they're due and follows the one in
+// progress, one step per reconciliation, pruning the backups beyond the
+// retention. The schedule is checked on every resync of the backup.
+func (h *backupHandler) ensureBackup(backup *cassandrav1alpha1.CassandraBackup, status *cassandrav1alpha1.CassandraBackupStatus) error {
+	cc, err := h.cluster(backup, status)
+	if err != nil || cc == nil {
+		return err
+	}
+
+	// An invalid spec is not retried, the backup is requeued when it changes.
+	if err := ccsvc.ValidateBackup(backup); err != nil {
+		h.recorder.Event(backup, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		status.SetCondition(cassandrav1alpha1.BackupScheduled, corev1.ConditionFalse, InvalidSpec, err.Error())
+		return nil
+	}
+	if cc.Spec.Storage == nil {
+		status.SetCondition(cassandrav1alpha1.BackupScheduled, corev1.ConditionFalse, StorageRequired, fmt.Sprintf(MessageStorageRequired, cc.Name))
+		return nil
+	}
+	status.ObservedGeneration = backup.Generation
+
+	if err := h.ccSvc.DeleteFinishedPruneJobs(backup); err != nil {
+		return err
+	}
+
+	started := false
+	if status.Current == nil {
+		next, due := ccsvc.NextBackupTime(backup, status.LastScheduleTime)
+		if now := time.Now(); due && !now.Before(next) {
+			start := metav1.NewTime(now)
+			status.LastScheduleTime = &start
+			status.Current = &cassandrav1alpha1.BackupRecord{
+				Name:      ccsvc.BackupName(backup, now),
+				Phase:     cassandrav1alpha1.BackupSnapshotting,
+				StartTime: start,
+			}
+			started = true
+		}
+	}
+
+	msg := fmt.Sprintf(MessageBackupTaken, cc.Name)
+	if next, due := ccsvc.NextBackupTime(backup, status.LastScheduleTime); due {
+		msg = fmt.Sprintf(MessageBackupScheduled, cc.Name, next.Format(time.RFC3339))
+	}
+	status.SetCondition(cassandrav1alpha1.BackupScheduled, corev1.ConditionTrue, BackupScheduled, msg)
+
+	// A new backup is recorded before its snapshots are taken, and is
+	// requeued with the update of its status. No status is written on dry
+	// run, so it goes on.
+	if status.Current != nil && (!started || h.dryRun) {
+		if err := h.progressBackup(cc, backup, status); err != nil {
+			return err
+		}
+	}
+	return h.pruneBackups(backup, status)
+}
+
+// progressBackup snapshots the nodes for the current backup and, once its
+// snapshots are uploaded, records it on the finished backups.
+func (h *backupHandler) progressBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, status *cassandrav1alpha1.CassandraBackupStatus) error {
+	current := status.Current
+	if current.Phase == cassandrav1alpha1.BackupSnapshotting {
+		if err := h.ccSvc.StartBackup(cc, backup, current.Name, current.StartTime.Time); err != nil {
+			h.recorder.Eventf(backup, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "backup snapshots", err)
+			return err
+		}
+		current.Phase = cassandrav1alpha1.BackupUploading
+		h.recorder.Eventf(backup, corev1.EventTypeNormal, BackupStarted, MessageBackupStarted, current.Name)
+		// The upload jobs just started, the backup is requeued with the
+		// update of its status.
+		return nil
+	}
+
+	uploaded, pending, failed, err := h.ccSvc.BackupUploads(backup, current.Name)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return nil
+	}
+	if len(uploaded) == 0 && len(failed) == 0 {
+		failed = []string{"every node, the upload jobs are gone"}
+	}
+	if err := h.ccSvc.FinishBackup(cc, backup, current.Name); err != nil {
+		h.recorder.Eventf(backup, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "backup snapshots", err)
+		return err
+	}
+
+	now := metav1.Now()
+	current.CompletionTime = &now
+	if len(failed) > 0 {
+		msg := fmt.Sprintf(MessageBackupFailed, current.Name, strings.Join(failed, ", "))
+		current.Phase = cassandrav1alpha1.BackupFailed
+		h.recorder.Event(backup, corev1.EventTypeWarning, BackupFailed, msg)
+		status.SetCondition(cassandrav1alpha1.BackupSucceeded, corev1.ConditionFalse, BackupFailed, msg)
+	} else {
+		msg := fmt.Sprintf(MessageBackupCompleted, current.Name)
+		current.Phase = cassandrav1alpha1.BackupCompleted
+		h.recorder.Event(backup, corev1.EventTypeNormal, BackupCompleted, msg)
+		status.SetCondition(cassandrav1alpha1.BackupSucceeded, corev1.ConditionTrue, BackupCompleted, msg)
+	}
+	status.Backups = append(status.Backups, *current)
+	status.Current = nil
+	return nil
+}
+
+// pruneBackups prunes the backups older than the last completed ones kept by
+// the retention, the failed ones included. Without retention the backups are
+// kept at the destination, but only the last maxBackupRecords are kept on
+// the status.
+func (h *backupHandler) pruneBackups(backup *cassandrav1alpha1.CassandraBackup, status *cassandrav1alpha1.CassandraBackupStatus) error {
+	retention := int(backup.Spec.Retention)
+	if retention == 0 {
+		if extra := len(status.Backups) - maxBackupRecords; extra > 0 {
+			status.Backups = status.Backups[extra:]
+		}
+		return nil
+	}
+
+	oldestKept, completed := 0, 0
+	for i := len(status.Backups) - 1; i >= 0 && completed < retention; i-- {
+		if status.Backups[i].Phase == cassandrav1alpha1.BackupCompleted {
+			oldestKept = i
+			completed++
+		}
+	}
+	if completed < retention {
+		return nil
+	}
+
+	for i := 0; i < oldestKept; i++ {
+		name := status.Backups[0].Name
+		if err := h.ccSvc.PruneBackup(backup, name); err != nil {
+			h.recorder.Eventf(backup, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "backup pruning", err)
+			return err
+		}
+		h.recorder.Eventf(backup, corev1.EventTypeNormal, BackupPruned, MessageBackupPruned, name)
+		status.Backups = status.Backups[1:]
+	}
+	return nil
+}
+
+// cluster returns the cluster of the backup when it's not paused, a backup
+// due while it's paused is taken once it's resumed. Otherwise it returns nil
+// and sets the reason on the scheduled condition, the backup is requeued when
+// its cluster changes.
+func (h *backupHandler) cluster(backup *cassandrav1alpha1.CassandraBackup, status *cassandrav1alpha1.CassandraBackupStatus) (*cassandrav1alpha1.CassandraCluster, error) {
+	clusterName := backup.Spec.ClusterName
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(backup.Namespace).Get(clusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.BackupScheduled, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, clusterName))
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case cc.Spec.Paused:
+		status.SetCondition(cassandrav1alpha1.BackupScheduled, corev1.ConditionFalse, ClusterPaused, fmt.Sprintf(MessageClusterPaused, clusterName))
+		return nil, nil
+	}
+	return cc, nil
+}
+
+// updateStatus updates the status block of the CassandraBackup resource when
+// it differs from the stored one.
+func (h *backupHandler) updateStatus(backup *cassandrav1alpha1.CassandraBackup, status *cassandrav1alpha1.CassandraBackupStatus) error {
+	if equality.Semantic.DeepEqual(&backup.Status, status) {
+		return nil
+	}
+
+	backupCopy := backup.DeepCopy()
+	backupCopy.Status = *status
+	// The status endpoint is not found without the status subresource.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraBackups(backup.Namespace).UpdateStatus(backupCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraBackups(backup.Namespace).Update(backupCopy)
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package operator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/log"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// pruningClient records the pruned backups, the other methods of the client
+// are not called while pruning.
+type pruningClient struct {
+	ccsvc.CassandraClusterClient
+	pruned []string
+	fail   string
+}
+
+func (c *pruningClient) PruneBackup(backup *cassandrav1alpha1.CassandraBackup, name string) error {
+	if name == c.fail {
+		return fmt.Errorf("prune job of %s not created", name)
+	}
+	c.pruned = append(c.pruned, name)
+	return nil
+}
+
+func backupRecords(phases ...cassandrav1alpha1.BackupPhase) []cassandrav1alpha1.BackupRecord {
+	var records []cassandrav1alpha1.BackupRecord
+	for i, phase := range phases {
+		records = append(records, cassandrav1alpha1.BackupRecord{Name: fmt.Sprintf("b%d", i), Phase: phase})
+	}
+	return records
+}
+
+func recordNames(records []cassandrav1alpha1.BackupRecord) []string {
+	names := []string{}
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	return names
+}
+
+func TestPruneBackups(t *testing.T) {
+	completed, failed := cassandrav1alpha1.BackupCompleted, cassandrav1alpha1.BackupFailed
+	many := make([]cassandrav1alpha1.BackupPhase, maxBackupRecords+5)
+	for i := range many {
+		many[i] = completed
+	}
+
+	tests := []struct {
+		name      string
+		retention int32
+		backups   []cassandrav1alpha1.BackupRecord
+		fail      string
+		pruned    []string
+		kept      []string
+		err       bool
+	}{
+		{
+			name:      "the completed backups within the retention are kept",
+			retention: 3,
+			backups:   backupRecords(completed, failed, completed),
+			pruned:    []string{},
+			kept:      []string{"b0", "b1", "b2"},
+		},
+		{
+			name:      "the backups older than the retention are pruned, the failed ones included",
+			retention: 2,
+			backups:   backupRecords(completed, failed, completed, failed, completed, failed),
+			pruned:    []string{"b0", "b1"},
+			kept:      []string{"b2", "b3", "b4", "b5"},
+		},
+		{
+			name:      "the pruned backups are kept on the status until their prune job is created",
+			retention: 1,
+			backups:   backupRecords(completed, completed, completed),
+			fail:      "b1",
+			pruned:    []string{"b0"},
+			kept:      []string{"b1", "b2"},
+			err:       true,
+		},
+		{
+			name:    "without retention the backups are kept",
+			backups: backupRecords(completed, failed, completed),
+			pruned:  []string{},
+			kept:    []string{"b0", "b1", "b2"},
+		},
+		{
+			name:    "without retention only the last backups are recorded",
+			backups: backupRecords(many...),
+			pruned:  []string{},
+			kept:    recordNames(backupRecords(many...)[5:]),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &pruningClient{pruned: []string{}, fail: test.fail}
+			h := newBackupHandler(nil, client, record.NewFakeRecorder(maxBackupRecords), false, log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat))
+			backup := &cassandrav1alpha1.CassandraBackup{
+				Spec: cassandrav1alpha1.CassandraBackupSpec{Retention: test.retention},
+			}
+			status := &cassandrav1alpha1.CassandraBackupStatus{Backups: test.backups}
+
+			err := h.pruneBackups(backup, status)
+			if (err != nil) != test.err {
+				t.Errorf("got error %v, want error %t", err, test.err)
+			}
+			if !reflect.DeepEqual(client.pruned, test.pruned) {
+				t.Errorf("pruned %v, want %v", client.pruned, test.pruned)
+			}
+			if kept := recordNames(status.Backups); !reflect.DeepEqual(kept, test.kept) {
+				t.Errorf("kept %v, want %v", kept, test.kept)
+			}
+		})
+	}
+}
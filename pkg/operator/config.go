@@ -1,9 +1,114 @@
 package operator
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// PodAntiAffinity is the feature gate spreading the pods of a cluster across
+// nodes with a required pod anti-affinity when they have no affinity.
+const PodAntiAffinity = "PodAntiAffinity"
+
+// defaultFeatureGates are the known feature gates and their default state.
+var defaultFeatureGates = map[string]bool{
+	PodAntiAffinity: true,
+}
 
 // Config is the configuration for the cassandra operator.
 type Config struct {
 	// ResyncPeriod is the resync period of the operator.
-	ResyncPeriod time.Duration
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	// Namespace is the namespace watched by the operator, all the
+	// namespaces when empty.
+	Namespace string `json:"namespace,omitempty"`
+	// Workers is the number of cassandra clusters reconciled concurrently,
+	// a cluster is never reconciled by two workers at the same time.
+	Workers int `json:"workers"`
+	// DryRun reads the live state but only logs the changes the operator
+	// would apply to the cluster resources, nothing is written.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Defaults are merged under the spec of every cassandra cluster.
+	Defaults Defaults `json:"defaults"`
+	// FeatureGates enables or disables the operator features, the ones not
+	// set keep their default state.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+}
+
+// Defaults are the operator wide values merged under the spec of every
+// cassandra cluster.
+type Defaults struct {
+	// Image of the cassandra containers.
+	Image string `json:"image"`
+	// Resources of the cassandra containers.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// StorageClassName of the data claims of the clusters with storage.
+	StorageClassName *string `json:"storageClassName,omitempty"`
+}
+
+// DefaultConfig returns the configuration used for the values not set.
+func DefaultConfig() Config {
+	return Config{
+		ResyncPeriod: metav1.Duration{Duration: 30 * time.Second},
+		Workers:      1,
+		Defaults: Defaults{
+			Image: ccsvc.DefaultImage,
+		},
+	}
+}
+
+// Validate returns an error describing every invalid value of the configuration.
+func (c Config) Validate() error {
+	var errs []string
+	if c.ResyncPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Sprintf("resync period must be positive, got %s", c.ResyncPeriod.Duration))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Sprintf("%d is not a valid number of workers, at least one is required", c.Workers))
+	}
+	if c.Defaults.Image == "" {
+		errs = append(errs, "default image must be specified")
+	}
+	for name, limit := range c.Defaults.Resources.Limits {
+		if request, ok := c.Defaults.Resources.Requests[name]; ok && request.Cmp(limit) > 0 {
+			errs = append(errs, fmt.Sprintf("default %s request %s is greater than its limit %s", name, request.String(), limit.String()))
+		}
+	}
+	for name := range c.FeatureGates {
+		if _, ok := defaultFeatureGates[name]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown feature gate %q", name))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+}
+
+// FeatureEnabled returns whether the feature gate is enabled.
+func (c Config) FeatureEnabled(name string) bool {
+	if enabled, ok := c.FeatureGates[name]; ok {
+		return enabled
+	}
+	return defaultFeatureGates[name]
+}
+
+// ServiceConfig returns the configuration of the resources generated for the
+// cassandra clusters.
+func (c Config) ServiceConfig() ccsvc.Config {
+	return ccsvc.Config{
+		Image:            c.Defaults.Image,
+		Resources:        c.Defaults.Resources,
+		StorageClassName: c.Defaults.StorageClassName,
+		PodAntiAffinity:  c.FeatureEnabled(PodAntiAffinity),
+		DryRun:           c.DryRun,
+	}
 }
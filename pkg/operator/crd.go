@@ -1,58 +1,69 @@
 package operator
 
 import (
-	"github.com/spotahome/kooper/client/crd"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"fmt"
+	"time"
+
+	koopercrd "github.com/spotahome/kooper/client/crd"
+	"github.com/spotahome/kooper/operator/resource"
+	"github.com/spotahome/kooper/operator/retrieve"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
 
 	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
-	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
 )
 
-// cassandraClusterCRD is the crd cassandra cluster
-type cassandraClusterCRD struct {
-	crdCli  crd.Interface
-	kubeCli kubernetes.Interface
-	ccCli   cassandracli.Interface
-}
+// crdPresentTimeout is the time waited on dry run for the CRD to be present.
+const crdPresentTimeout = 30 * time.Second
 
-func newCassandraClusterCRD(ccCli cassandracli.Interface, crdCli crd.Interface, kubeCli kubernetes.Interface) *cassandraClusterCRD {
-	return &cassandraClusterCRD{
-		crdCli:  crdCli,
-		ccCli:   ccCli,
-		kubeCli: kubeCli,
-	}
+// crdKinds are the custom resources of the operator.
+var crdKinds = []struct {
+	kind   string
+	plural string
+	scope  koopercrd.Scope
+	object runtime.Object
+}{
+	{cassandrav1alpha1.CCKind, cassandrav1alpha1.CCNamePlural, cassandrav1alpha1.CCScope, &cassandrav1alpha1.CassandraCluster{}},
+	{cassandrav1alpha1.RoleKind, cassandrav1alpha1.RoleNamePlural, cassandrav1alpha1.RoleScope, &cassandrav1alpha1.CassandraRole{}},
+	{cassandrav1alpha1.KeyspaceKind, cassandrav1alpha1.KeyspaceNamePlural, cassandrav1alpha1.KeyspaceScope, &cassandrav1alpha1.CassandraKeyspace{}},
+	{cassandrav1alpha1.BackupKind, cassandrav1alpha1.BackupNamePlural, cassandrav1alpha1.BackupScope, &cassandrav1alpha1.CassandraBackup{}},
+	{cassandrav1alpha1.RestoreKind, cassandrav1alpha1.RestoreNamePlural, cassandrav1alpha1.RestoreScope, &cassandrav1alpha1.CassandraRestore{}},
+	{cassandrav1alpha1.TaskKind, cassandrav1alpha1.TaskNamePlural, cassandrav1alpha1.TaskScope, &cassandrav1alpha1.CassandraTask{}},
 }
 
-// Initialize satisfies resource.crd interface.
-func (cc *cassandraClusterCRD) Initialize() error {
-	crd := crd.Conf{
-		Kind:       cassandrav1alpha1.CCKind,
-		NamePlural: cassandrav1alpha1.CCNamePlural,
-		Group:      cassandrav1alpha1.SchemeGroupVersion.Group,
-		Version:    cassandrav1alpha1.SchemeGroupVersion.Version,
-		Scope:      cassandrav1alpha1.CCScope,
-	}
-
-	return cc.crdCli.EnsurePresent(crd)
+// crd is a custom resource of the operator. The controllers watch the
+// resources through informers, so it has no lister-watcher.
+type crd struct {
+	retrieve.Resource
+	conf   koopercrd.Conf
+	crdCli koopercrd.Interface
+	dryRun bool
 }
 
-// GetListerWatcher satisfies resource.crd interface (and retrieve.Retriever).
-func (cc *cassandraClusterCRD) GetListerWatcher() cache.ListerWatcher {
-	return &cache.ListWatch{
-		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-			return cc.ccCli.CassandraV1alpha1().CassandraClusters("default").List(options)
-		},
-		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-			return cc.ccCli.CassandraV1alpha1().CassandraClusters("default").Watch(options)
-		},
+// newCRDs returns the custom resources of the operator.
+func newCRDs(crdCli koopercrd.Interface, dryRun bool) []resource.CRD {
+	var crds []resource.CRD
+	for _, kind := range crdKinds {
+		crds = append(crds, &crd{
+			Resource: retrieve.Resource{Object: kind.object},
+			conf: koopercrd.Conf{
+				Kind:       kind.kind,
+				NamePlural: kind.plural,
+				Group:      cassandrav1alpha1.SchemeGroupVersion.Group,
+				Version:    cassandrav1alpha1.SchemeGroupVersion.Version,
+				Scope:      kind.scope,
+			},
+			crdCli: crdCli,
+			dryRun: dryRun,
+		})
 	}
+	return crds
 }
 
-// GetObject satisfies resource.crd interface (and retrieve.Retriever).
-func (cc *cassandraClusterCRD) GetObject() runtime.Object {
-	return &cassandrav1alpha1.CassandraCluster{}
+// Initialize satisfies resource.CRD interface registering the CRD. On dry
+// run the CRD is not registered, it must be already present.
+func (c *crd) Initialize() error {
+	if c.dryRun {
+		return c.crdCli.WaitToBePresent(fmt.Sprintf("%s.%s", c.conf.NamePlural, c.conf.Group), crdPresentTimeout)
+	}
+	return c.crdCli.EnsurePresent(c.conf)
 }
@@ -2,31 +2,106 @@ package operator
 
 import (
 	"github.com/camilocot/cassandra-crd/pkg/log"
-	"github.com/spotahome/kooper/client/crd"
+	koopercrd "github.com/spotahome/kooper/client/crd"
 	"github.com/spotahome/kooper/operator"
-	"github.com/spotahome/kooper/operator/controller"
+	kooperctrl "github.com/spotahome/kooper/operator/controller"
+	corev1 "k8s.io/api/core/v1"
+	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/controller"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
 	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
 	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
 
 	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	cassandrascheme "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned/scheme"
+	informers "github.com/camilocot/cassandra-crd/pkg/client/informers/externalversions"
 )
 
-// New returns pod terminator operator.
-func New(cfg Config, ccCli cassandracli.Interface, k8sService k8s.Services, crdCli crd.Interface, kubeCli kubernetes.Interface, logger log.Logger) (operator.Operator, error) {
+const controllerAgentName = "cassandra-controller"
 
-	// Create our CRD
-	ccCRD := newCassandraClusterCRD(ccCli, crdCli, kubeCli)
+// New returns cassandra cluster operator.
+func New(cfg Config, ccCli cassandracli.Interface, k8sService k8s.Services, crdCli koopercrd.Interface, kubeCli kubernetes.Interface, logger log.Logger) (operator.Operator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 
-	ccSvc := ccsvc.NewCassandraClusterClient(k8sService, logger)
+	// On dry run the kubernetes services only log the changes.
+	var dryRun *k8s.DryRun
+	if cfg.DryRun {
+		logger.Infof("dry run enabled, no resource will be modified")
+		dryRun = k8s.NewDryRun(k8sService, logger)
+		k8sService = dryRun
+	}
 
-	// Create the handler
-	handler := newHandler(kubeCli, ccSvc, logger)
+	// The CQL sessions are pooled per cluster and shared by the handlers.
+	ccSvc := ccsvc.NewCassandraClusterClient(k8sService, cql.NewClient(logger), cfg.ServiceConfig(), logger)
 
-	// Create our controller.
-	ctrl := controller.NewSequential(cfg.ResyncPeriod, handler, ccCRD, nil, logger)
+	// Create the handlers
+	recorder := newEventRecorder(kubeCli, cfg.DryRun, logger)
+	handler := newHandler(kubeCli, ccCli, ccSvc, recorder, dryRun, logger)
+	roleHandler := newRoleHandler(ccCli, ccSvc, recorder, cfg.DryRun, logger)
+	keyspaceHandler := newKeyspaceHandler(ccCli, ccSvc, recorder, cfg.DryRun, logger)
+	backupHandler := newBackupHandler(ccCli, ccSvc, recorder, cfg.DryRun, logger)
+	restoreHandler := newRestoreHandler(ccCli, ccSvc, recorder, cfg.DryRun, logger)
+	taskHandler := newTaskHandler(ccCli, ccSvc, recorder, cfg.DryRun, logger)
 
-	// Assemble CRD and controller to create the operator.
-	return operator.NewOperator(ccCRD, ctrl, logger), nil
+	// Create our controllers, they watch the cassandra clusters and the
+	// resources they own, the cassandra roles, keyspaces, backups, restores
+	// and tasks.
+	kubeInformerFactory := kubeinformers.NewFilteredSharedInformerFactory(kubeCli, cfg.ResyncPeriod.Duration, cfg.Namespace, nil)
+	ccInformerFactory := informers.NewFilteredSharedInformerFactory(ccCli, cfg.ResyncPeriod.Duration, cfg.Namespace, nil)
+	ctrl := controller.NewController(kubeInformerFactory, ccInformerFactory, handler, cfg.Workers, logger)
+	roleCtrl := controller.NewResourceController(
+		cassandrav1alpha1.RoleKind,
+		ccInformerFactory.Cassandra().V1alpha1().CassandraRoles().Informer(),
+		func(obj interface{}) string { return obj.(*cassandrav1alpha1.CassandraRole).Spec.ClusterName },
+		ccInformerFactory, roleHandler, cfg.Workers, logger)
+	keyspaceCtrl := controller.NewResourceController(
+		cassandrav1alpha1.KeyspaceKind,
+		ccInformerFactory.Cassandra().V1alpha1().CassandraKeyspaces().Informer(),
+		func(obj interface{}) string { return obj.(*cassandrav1alpha1.CassandraKeyspace).Spec.ClusterName },
+		ccInformerFactory, keyspaceHandler, cfg.Workers, logger)
+	backupCtrl := controller.NewResourceController(
+		cassandrav1alpha1.BackupKind,
+		ccInformerFactory.Cassandra().V1alpha1().CassandraBackups().Informer(),
+		func(obj interface{}) string { return obj.(*cassandrav1alpha1.CassandraBackup).Spec.ClusterName },
+		ccInformerFactory, backupHandler, cfg.Workers, logger)
+	restoreCtrl := controller.NewResourceController(
+		cassandrav1alpha1.RestoreKind,
+		ccInformerFactory.Cassandra().V1alpha1().CassandraRestores().Informer(),
+		func(obj interface{}) string { return obj.(*cassandrav1alpha1.CassandraRestore).Spec.ClusterName },
+		ccInformerFactory, restoreHandler, cfg.Workers, logger)
+	taskCtrl := controller.NewResourceController(
+		cassandrav1alpha1.TaskKind,
+		ccInformerFactory.Cassandra().V1alpha1().CassandraTasks().Informer(),
+		func(obj interface{}) string { return obj.(*cassandrav1alpha1.CassandraTask).Spec.ClusterName },
+		ccInformerFactory, taskHandler, cfg.Workers, logger)
+
+	// Assemble CRDs and controllers to create the operator.
+	return operator.NewMultiOperator(
+		newCRDs(crdCli, cfg.DryRun),
+		[]kooperctrl.Controller{ctrl, roleCtrl, keyspaceCtrl, backupCtrl, restoreCtrl, taskCtrl},
+		logger,
+	), nil
+}
+
+// newEventRecorder returns a recorder of the events of the cassandra cluster
+// resources. On dry run the events are only logged.
+func newEventRecorder(kubeCli kubernetes.Interface, dryRun bool, logger log.Logger) record.EventRecorder {
+	// Add cassandra-controller types to the default Kubernetes Scheme so Events can be
+	// logged for cassandra-controller types.
+	cassandrascheme.AddToScheme(scheme.Scheme)
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(logger.Infof)
+	if dryRun {
+		return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	}
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeCli.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 }
@@ -2,30 +2,112 @@ package operator
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/camilocot/cassandra-crd/pkg/log"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 
 	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	"github.com/camilocot/cassandra-crd/pkg/controller"
 	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+const (
+	// SuccessSynced is used as part of the Event 'reason' when a CassandraCluster is synced
+	SuccessSynced = "Synced"
+	// ErrResourceExists is used as part of the Event 'reason' when a CassandraCluster fails
+	// to sync due to a resource of the same name already existing.
+	ErrResourceExists = "ErrResourceExists"
+
+	// ErrSyncFailed is used as part of the Event 'reason' when the resources
+	// of a CassandraCluster fail to be ensured.
+	ErrSyncFailed = "ErrSyncFailed"
+	// StatefulSetCreated is used as part of the Event 'reason' when a StatefulSet is created
+	StatefulSetCreated = "StatefulSetCreated"
+	// StatefulSetUpdated is used as part of the Event 'reason' when a StatefulSet is updated
+	StatefulSetUpdated = "StatefulSetUpdated"
+	// ScalingUp is used as part of the Event 'reason' when the replicas of a StatefulSet grow
+	ScalingUp = "ScalingUp"
+	// ScalingDown is used as part of the Event 'reason' when the replicas of a StatefulSet shrink
+	ScalingDown = "ScalingDown"
+	// ReconciliationPaused is used as part of the Event 'reason' when a CassandraCluster is paused
+	ReconciliationPaused = "ReconciliationPaused"
+	// ReconciliationResumed is used as part of the Event 'reason' when a CassandraCluster is resumed
+	ReconciliationResumed = "ReconciliationResumed"
+	// WaitingForNodes is used as part of the condition 'reason' when the nodes of a CassandraCluster are not ready
+	WaitingForNodes = "WaitingForNodes"
+	// AuthConfigured is used as part of the Event 'reason' when the authentication of a CassandraCluster is configured
+	AuthConfigured = "AuthConfigured"
+	// ErrAuthFailed is used as part of the condition 'reason' when the authentication of a CassandraCluster fails to be configured
+	ErrAuthFailed = "ErrAuthFailed"
+	// CertificatesRenewed is used as part of the Event 'reason' when the node certificates of a CassandraCluster are renewed
+	CertificatesRenewed = "CertificatesRenewed"
+
+	// MessageResourceExists is the message used for Events when a resource
+	// fails to sync due to a resource already existing
+	MessageResourceExists = "Resource conflict: %s"
+	// MessageResourceSynced is the message used for an Event fired when a CassandraCluster
+	// is synced successfully
+	MessageResourceSynced = "CassandraCluster synced successfully"
+	// MessageSyncFailed is the message used for Events when the resources of a
+	// CassandraCluster fail to be ensured
+	MessageSyncFailed = "Error ensuring the %s: %s"
+	// MessageStatefulSetCreated is the message used for an Event fired when a StatefulSet is created
+	MessageStatefulSetCreated = "StatefulSet %q created with %d replicas"
+	// MessageStatefulSetUpdated is the message used for an Event fired when a StatefulSet is updated
+	MessageStatefulSetUpdated = "StatefulSet %q updated"
+	// MessageScalingUp is the message used for an Event fired when a StatefulSet grows
+	MessageScalingUp = "Scaling StatefulSet %q from %d to %d replicas"
+	// MessageScalingDown is the message used for an Event fired when a StatefulSet shrinks
+	MessageScalingDown = "Scaling StatefulSet %q from %d to %d replicas, its last nodes are drained but not decommissioned"
+	// MessageReconciliationPaused is the message used for an Event fired when a CassandraCluster is paused
+	MessageReconciliationPaused = "CassandraCluster paused, its resources won't be modified until it's resumed"
+	// MessageReconciliationResumed is the message used for an Event fired when a CassandraCluster is resumed
+	MessageReconciliationResumed = "CassandraCluster resumed"
+	// MessageWaitingForNodes is the message used for conditions waiting for the nodes of a CassandraCluster
+	MessageWaitingForNodes = "Waiting for all the nodes to be ready"
+	// MessageAuthConfigured is the message used for an Event fired when the authentication of a CassandraCluster is configured
+	MessageAuthConfigured = "Superuser of secret %s replaces the default one"
+	// MessageCertificatesRenewed is the message used for an Event fired when the node certificates of a CassandraCluster are renewed
+	MessageCertificatesRenewed = "Certificates of the nodes renewed, the nodes are restarted one by one to load them"
 )
 
 // Handler  is the cassandra cluster handler that will handle the
 // events received from kubernetes.
 type handler struct {
-	k8sCli kubernetes.Interface
-	ccSvc  ccsvc.CassandraClusterClient
+	k8sCli   kubernetes.Interface
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// repairs runs the scheduled repairs of the clusters.
+	repairs *repairer
+	// dryRun summarises the changes that would be applied, nil when the
+	// changes are applied.
+	dryRun *k8s.DryRun
 	logger log.Logger
 }
 
 // newHandler returns a new handler.
-func newHandler(k8sCli kubernetes.Interface, ccSvc ccsvc.CassandraClusterClient, logger log.Logger) *handler {
+func newHandler(k8sCli kubernetes.Interface, ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun *k8s.DryRun, logger log.Logger) *handler {
 	return &handler{
-		k8sCli: k8sCli,
-		ccSvc:  ccSvc,
-		logger: logger,
+		k8sCli:   k8sCli,
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		repairs:  newRepairer(ccSvc, recorder, dryRun != nil),
+		dryRun:   dryRun,
+		logger:   logger,
 	}
 }
 
@@ -35,23 +117,280 @@ func (h *handler) Add(obj runtime.Object) error {
 		return fmt.Errorf("%v is not a cassandra cluster object", obj.GetObjectKind())
 	}
 
-	if err := h.Ensure(cc); err != nil {
+	// The messages of a reconciliation carry the cluster and an ID relating
+	// them, as the reconciliations of several clusters are interleaved.
+	logger := h.logger.With("namespace", cc.Namespace, "cluster", cc.Name, "reconcile", rand.String(8))
+	if err := h.withLogger(logger).Ensure(cc); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (h *handler) Delete(name string) error {
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *handler) withLogger(logger log.Logger) *handler {
+	return newHandler(h.k8sCli, h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
 
-	fmt.Println(name)
+// Delete is called when a cassandra cluster is deleted, the resources it owns
+// are garbage collected by kubernetes and its CQL session is closed.
+func (h *handler) Delete(name string) error {
+	h.logger.Infof("cassandra cluster %s deleted", name)
+	h.ccSvc.CloseSession(name)
 	return nil
 }
 
 func (h *handler) Ensure(cc *cassandrav1alpha1.CassandraCluster) error {
+	status := cc.Status.DeepCopy()
+	h.ensurePauseState(cc, status)
+
+	// The resources are generated from the spec with the operator defaults
+	// merged under it, the stored spec is left untouched.
+	effective := h.ccSvc.EffectiveCluster(cc)
+
+	var err error
+	if cc.Spec.Paused {
+		err = h.refreshStatus(effective, status)
+	} else {
+		status.EffectiveSpec = effective.Spec.DeepCopy()
+		err = h.ensureResources(effective, status)
+	}
+	// The repairs run one batch of ranges at a time, the cluster is
+	// requeued for the next one so the worker isn't held meanwhile.
+	var requeue time.Duration
+	if err == nil {
+		requeue, err = h.repairs.ensure(effective, status)
+	}
+	if h.dryRun != nil {
+		// The status is not written on dry run.
+		h.summarizeDryRun(cc)
+		return err
+	}
+	// The resyncs that change nothing record no event, so they don't flood
+	// the events of the cluster.
+	changed := !equality.Semantic.DeepEqual(&cc.Status, status)
+	if updateErr := h.updateStatus(cc, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	if err == nil && !cc.Spec.Paused && changed {
+		h.recorder.Event(cc, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	}
+	if err == nil && requeue > 0 {
+		return controller.RequeueAfter(requeue)
+	}
+	return err
+}
+
+// ensurePauseState reflects the pause state of the cluster on the paused
+// condition, recording an event when it toggles.
+func (h *handler) ensurePauseState(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus) {
+	wasPaused := status.IsConditionTrue(cassandrav1alpha1.ClusterPaused)
+	switch {
+	case cc.Spec.Paused && !wasPaused:
+		h.recorder.Event(cc, corev1.EventTypeNormal, ReconciliationPaused, MessageReconciliationPaused)
+	case !cc.Spec.Paused && wasPaused:
+		h.recorder.Event(cc, corev1.EventTypeNormal, ReconciliationResumed, MessageReconciliationResumed)
+	}
+
+	if cc.Spec.Paused {
+		status.SetCondition(cassandrav1alpha1.ClusterPaused, corev1.ConditionTrue, ReconciliationPaused, MessageReconciliationPaused)
+		return
+	}
+	status.SetCondition(cassandrav1alpha1.ClusterPaused, corev1.ConditionFalse, "", "")
+}
+
+// refreshStatus reflects the current state of the world on status without
+// mutating the resources of the cluster.
+func (h *handler) refreshStatus(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus) error {
+	statefulSets, err := h.ccSvc.GetStatefulSets(cc)
+	if err != nil {
+		return err
+	}
+	status.CurrentReplicas = currentReplicas(statefulSets)
+	return nil
+}
+
+// ensureResources converges the resources of the cluster to the desired
+// state, reflecting the current state of the world on status.
+func (h *handler) ensureResources(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus) error {
+	statefulSets, err := h.ccSvc.GetStatefulSets(cc)
+	if err != nil {
+		return err
+	}
+
+	if err := h.ccSvc.EnsureServices(cc); err != nil {
+		return h.syncFailed(cc, status, "services", err)
+	}
+
+	// The certificates must exist before the nodes mounting them start.
+	if cc.Spec.TLS != nil {
+		renewed, err := h.ccSvc.EnsureTLS(cc)
+		if err != nil {
+			return h.syncFailed(cc, status, "certificates", err)
+		}
+		if renewed {
+			h.recorder.Event(cc, corev1.EventTypeNormal, CertificatesRenewed, MessageCertificatesRenewed)
+		}
+	}
+
+	// The nodes read their JMX credentials from the secret when they start.
+	if cc.Spec.JMX != nil {
+		if err := h.ccSvc.EnsureJMXSecret(cc); err != nil {
+			return h.syncFailed(cc, status, "jmx secret", err)
+		}
+	}
+
 	if err := h.ccSvc.EnsureStatefulset(cc); err != nil {
+		return h.syncFailed(cc, status, "statefulsets", err)
+	}
+	status.SetCondition(cassandrav1alpha1.ClusterResourceConflict, corev1.ConditionFalse, "", "")
+
+	current, err := h.ccSvc.GetStatefulSets(cc)
+	if err != nil {
 		return err
 	}
+	h.recordStatefulSetChanges(cc, statefulSets, current)
+
+	status.CurrentReplicas = currentReplicas(current)
 
+	if cc.Spec.Auth != nil {
+		return h.ensureAuth(cc, status, current)
+	}
+	return nil
+}
+
+// ensureAuth makes sure the superuser of the cluster exists once its nodes
+// are ready, reflecting it on the auth ready condition.
+func (h *handler) ensureAuth(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus, statefulSets []*appsv1.StatefulSet) error {
+	if err := h.ccSvc.EnsureSuperuserSecret(cc); err != nil {
+		return h.syncFailed(cc, status, "superuser secret", err)
+	}
+
+	// The nodes restart when the authentication is enabled, the cluster is
+	// requeued when the statefulsets become ready.
+	if !statefulSetsReady(statefulSets) {
+		status.SetCondition(cassandrav1alpha1.ClusterAuthReady, corev1.ConditionFalse, WaitingForNodes, MessageWaitingForNodes)
+		return nil
+	}
+
+	if err := h.ccSvc.EnsureAuth(cc); err != nil {
+		status.SetCondition(cassandrav1alpha1.ClusterAuthReady, corev1.ConditionFalse, ErrAuthFailed, err.Error())
+		return h.syncFailed(cc, status, "authentication", err)
+	}
+
+	msg := fmt.Sprintf(MessageAuthConfigured, ccsvc.SuperuserSecretName(cc))
+	if !status.IsConditionTrue(cassandrav1alpha1.ClusterAuthReady) {
+		h.recorder.Event(cc, corev1.EventTypeNormal, AuthConfigured, msg)
+	}
+	status.SetCondition(cassandrav1alpha1.ClusterAuthReady, corev1.ConditionTrue, AuthConfigured, msg)
 	return nil
 }
+
+// statefulSetsReady returns whether all the pods of the statefulsets are
+// ready and running their last revision.
+func statefulSetsReady(statefulSets []*appsv1.StatefulSet) bool {
+	for _, ss := range statefulSets {
+		if ss.Status.ObservedGeneration < ss.Generation ||
+			ss.Status.ReadyReplicas != replicas(ss) ||
+			ss.Status.CurrentRevision != ss.Status.UpdateRevision {
+			return false
+		}
+	}
+	return true
+}
+
+// syncFailed records the error ensuring the resources of the cluster. If a
+// resource is not controlled by this CassandraCluster resource, we should log
+// a warning to the event recorder and raise the resource conflict condition.
+func (h *handler) syncFailed(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus, resources string, err error) error {
+	if k8s.IsResourceConflict(err) {
+		msg := fmt.Sprintf(MessageResourceExists, err)
+		h.recorder.Event(cc, corev1.EventTypeWarning, ErrResourceExists, msg)
+		status.SetCondition(cassandrav1alpha1.ClusterResourceConflict, corev1.ConditionTrue, ErrResourceExists, msg)
+		return err
+	}
+
+	h.recorder.Eventf(cc, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, resources, err)
+	return err
+}
+
+// recordStatefulSetChanges emits an event for every statefulset created,
+// updated or scaled while ensuring the cluster.
+func (h *handler) recordStatefulSetChanges(cc *cassandrav1alpha1.CassandraCluster, previous, current []*appsv1.StatefulSet) {
+	stored := make(map[string]*appsv1.StatefulSet, len(previous))
+	for _, ss := range previous {
+		stored[ss.Name] = ss
+	}
+
+	for _, ss := range current {
+		old, ok := stored[ss.Name]
+		if !ok {
+			h.recorder.Eventf(cc, corev1.EventTypeNormal, StatefulSetCreated, MessageStatefulSetCreated, ss.Name, replicas(ss))
+			continue
+		}
+		// The generation only changes with the spec, status updates are ignored.
+		if old.Generation == ss.Generation {
+			continue
+		}
+
+		switch from, to := replicas(old), replicas(ss); {
+		case to > from:
+			h.recorder.Eventf(cc, corev1.EventTypeNormal, ScalingUp, MessageScalingUp, ss.Name, from, to)
+		case to < from:
+			h.recorder.Eventf(cc, corev1.EventTypeNormal, ScalingDown, MessageScalingDown, ss.Name, from, to)
+		default:
+			h.recorder.Eventf(cc, corev1.EventTypeNormal, StatefulSetUpdated, MessageStatefulSetUpdated, ss.Name)
+		}
+	}
+}
+
+// replicas returns the desired replicas of a statefulset, one when unset as
+// defaulted by kubernetes.
+func replicas(ss *appsv1.StatefulSet) int32 {
+	if ss.Spec.Replicas == nil {
+		return 1
+	}
+	return *ss.Spec.Replicas
+}
+
+// currentReplicas returns the replicas running the current revision of the statefulsets.
+func currentReplicas(statefulSets []*appsv1.StatefulSet) int32 {
+	var replicas int32
+	for _, ss := range statefulSets {
+		replicas += ss.Status.CurrentReplicas
+	}
+	return replicas
+}
+
+// summarizeDryRun logs the changes that would have been applied to the
+// resources of the cluster.
+func (h *handler) summarizeDryRun(cc *cassandrav1alpha1.CassandraCluster) {
+	actions := h.dryRun.Summary(cc.Namespace, cc.Name)
+	if len(actions) == 0 {
+		h.logger.Infof("dry-run: cassandra cluster %s/%s is up to date", cc.Namespace, cc.Name)
+		return
+	}
+	h.logger.Infof("dry-run: cassandra cluster %s/%s would apply %d changes: %s", cc.Namespace, cc.Name, len(actions), strings.Join(actions, "; "))
+}
+
+// updateStatus updates the status block of the CassandraCluster resource
+// when it differs from the stored one.
+func (h *handler) updateStatus(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus) error {
+	if equality.Semantic.DeepEqual(&cc.Status, status) {
+		return nil
+	}
+
+	ccCopy := cc.DeepCopy()
+	ccCopy.Status = *status
+	// UpdateStatus will not allow changes to the Spec of the resource,
+	// which is ideal for ensuring nothing other than resource status has been updated.
+	// If the CustomResourceSubresources feature gate is not enabled or the
+	// CRD has no status subresource, the status endpoint is not found and
+	// we must use Update instead to update the Status block of the CassandraCluster resource.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraClusters(cc.Namespace).UpdateStatus(ccCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraClusters(cc.Namespace).Update(ccCopy)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package operator
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/log"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+// conflictingClient fails to ensure the statefulsets with err, the other
+// resources of the cluster are ensured.
+type conflictingClient struct {
+	ccsvc.CassandraClusterClient
+	err error
+}
+
+func (c *conflictingClient) GetStatefulSets(*cassandrav1alpha1.CassandraCluster) ([]*appsv1.StatefulSet, error) {
+	return nil, nil
+}
+
+func (c *conflictingClient) EnsureServices(*cassandrav1alpha1.CassandraCluster) error {
+	return nil
+}
+
+func (c *conflictingClient) EnsureStatefulset(*cassandrav1alpha1.CassandraCluster) error {
+	return c.err
+}
+
+func TestResourceConflictCondition(t *testing.T) {
+	cc := &cassandrav1alpha1.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec:       cassandrav1alpha1.CassandraClusterSpec{StatefulSetName: "cassandra"},
+	}
+	client := &conflictingClient{
+		err: &k8s.ResourceConflictError{Kind: "statefulSet", Namespace: "default", Name: "cassandra", Owner: "CassandraCluster test"},
+	}
+	recorder := record.NewFakeRecorder(10)
+	h := newHandler(nil, nil, client, recorder, nil, log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat))
+	status := &cassandrav1alpha1.CassandraClusterStatus{}
+
+	// The conflict raises the condition and records a warning.
+	if err := h.ensureResources(cc, status); !k8s.IsResourceConflict(err) {
+		t.Fatalf("got error %v, want a resource conflict", err)
+	}
+	if !status.IsConditionTrue(cassandrav1alpha1.ClusterResourceConflict) {
+		t.Errorf("resource conflict condition not raised")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrResourceExists) {
+			t.Errorf("got event %q, want %s", event, ErrResourceExists)
+		}
+	default:
+		t.Errorf("no event recorded for the conflict")
+	}
+
+	// The condition is cleared once the conflicting resource is gone.
+	client.err = nil
+	if err := h.ensureResources(cc, status); err != nil {
+		t.Fatal(err)
+	}
+	if status.IsConditionTrue(cassandrav1alpha1.ClusterResourceConflict) {
+		t.Errorf("resource conflict condition not cleared")
+	}
+}
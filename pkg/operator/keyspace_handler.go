@@ -0,0 +1,234 @@
+package operator
+
+import (
+	"fmt"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+const (
+	// InvalidReplication is used as part of the Event 'reason' when the replication of a CassandraKeyspace is refused
+	InvalidReplication = "InvalidReplication"
+	// RepairPending is used as part of the Event 'reason' when a CassandraKeyspace must be repaired
+	RepairPending = "RepairPending"
+	// KeyspaceRepaired is used as part of the Event 'reason' when a CassandraKeyspace is repaired
+	KeyspaceRepaired = "KeyspaceRepaired"
+
+	// MessageKeyspaceSynced is the message used for an Event fired when a CassandraKeyspace is synced
+	MessageKeyspaceSynced = "Keyspace %q synced on CassandraCluster %q"
+	// MessageRepairPending is the message used for an Event fired when a CassandraKeyspace must be repaired
+	MessageRepairPending = "Replication of keyspace %q increased, repairing it on %d nodes"
+	// MessageRepairProgress is the message used for conditions while a CassandraKeyspace is repaired
+	MessageRepairProgress = "Repairing keyspace %q, %d nodes pending"
+	// MessageKeyspaceRepaired is the message used for an Event fired when a CassandraKeyspace is repaired
+	MessageKeyspaceRepaired = "Keyspace %q repaired on every node"
+)
+
+// keyspaceHandler is the cassandra keyspace handler that will handle the
+// events received from kubernetes.
+type keyspaceHandler struct {
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the statements and repairs, the keyspaces are not
+	// modified.
+	dryRun bool
+	logger log.Logger
+}
+
+// newKeyspaceHandler returns a new keyspace handler.
+func newKeyspaceHandler(ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool, logger log.Logger) *keyspaceHandler {
+	return &keyspaceHandler{
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+		logger:   logger,
+	}
+}
+
+func (h *keyspaceHandler) Add(obj runtime.Object) error {
+	keyspace, ok := obj.(*cassandrav1alpha1.CassandraKeyspace)
+	if !ok {
+		return fmt.Errorf("%v is not a cassandra keyspace object", obj.GetObjectKind())
+	}
+
+	logger := h.logger.With("namespace", keyspace.Namespace, "keyspace", keyspace.Name, "reconcile", rand.String(8))
+	return h.withLogger(logger).Ensure(keyspace)
+}
+
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *keyspaceHandler) withLogger(logger log.Logger) *keyspaceHandler {
+	return newKeyspaceHandler(h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
+
+// Delete is called when a cassandra keyspace is deleted, its keyspace is
+// kept on the cluster with its data.
+func (h *keyspaceHandler) Delete(name string) error {
+	h.logger.Infof("cassandra keyspace %s deleted, the keyspace and its data are kept", name)
+	return nil
+}
+
+func (h *keyspaceHandler) Ensure(keyspace *cassandrav1alpha1.CassandraKeyspace) error {
+	status := keyspace.Status.DeepCopy()
+	err := h.ensureKeyspace(keyspace, status)
+	if h.dryRun {
+		// The status is not written on dry run.
+		return err
+	}
+	if updateErr := h.updateStatus(keyspace, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// ensureKeyspace syncs the keyspace on its cluster and repairs it on the
+// pending nodes, one per reconciliation, reflecting it on the conditions.
+func (h *keyspaceHandler) ensureKeyspace(keyspace *cassandrav1alpha1.CassandraKeyspace, status *cassandrav1alpha1.CassandraKeyspaceStatus) error {
+	cc, err := h.readyCluster(keyspace, status)
+	if err != nil || cc == nil {
+		return err
+	}
+
+	// An invalid spec is not retried, the keyspace is requeued when it changes.
+	if err := ccsvc.ValidateKeyspace(keyspace); err != nil {
+		h.recorder.Event(keyspace, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, InvalidSpec, err.Error())
+		return nil
+	}
+
+	name := ccsvc.KeyspaceName(keyspace)
+	increased, err := h.ccSvc.KeyspaceReplicationIncreased(cc, keyspace)
+	if err == nil && increased && !equality.Semantic.DeepEqual(status.PendingRepairsReplication, &keyspace.Spec.Replication) {
+		err = h.recordPendingRepairs(cc, keyspace, status)
+		// The pending repairs are written before the keyspace is altered, so
+		// they're not lost when its status can't be written afterwards. The
+		// update of the status requeues the keyspace to alter it. On dry run
+		// the status is not written.
+		if err == nil && !h.dryRun {
+			return nil
+		}
+	}
+	if err == nil {
+		err = h.ccSvc.EnsureKeyspace(cc, keyspace)
+	}
+	switch {
+	case ccsvc.IsInvalidReplication(err):
+		// The keyspace is requeued when the nodes of its cluster change.
+		if !isKeyspaceConditionReason(status, cassandrav1alpha1.KeyspaceSynced, InvalidReplication) {
+			h.recorder.Event(keyspace, corev1.EventTypeWarning, InvalidReplication, err.Error())
+		}
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, InvalidReplication, err.Error())
+		return nil
+	case err != nil:
+		msg := fmt.Sprintf(MessageSyncFailed, "keyspace", err)
+		h.recorder.Event(keyspace, corev1.EventTypeWarning, ErrSyncFailed, msg)
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, ErrSyncFailed, msg)
+		return err
+	}
+
+	msg := fmt.Sprintf(MessageKeyspaceSynced, name, cc.Name)
+	if !status.IsConditionTrue(cassandrav1alpha1.KeyspaceSynced) {
+		h.recorder.Event(keyspace, corev1.EventTypeNormal, SuccessSynced, msg)
+	}
+	status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionTrue, SuccessSynced, msg)
+	status.ObservedGeneration = keyspace.Generation
+	return h.repairKeyspace(cc, keyspace, status)
+}
+
+// recordPendingRepairs sets every node of the cluster as pending to repair
+// the keyspace whose replication factor increases.
+func (h *keyspaceHandler) recordPendingRepairs(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace, status *cassandrav1alpha1.CassandraKeyspaceStatus) error {
+	pods, err := h.ccSvc.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	h.recorder.Eventf(keyspace, corev1.EventTypeNormal, RepairPending, MessageRepairPending, ccsvc.KeyspaceName(keyspace), len(pods))
+	status.PendingRepairs = pods
+	status.PendingRepairsReplication = keyspace.Spec.Replication.DeepCopy()
+	return nil
+}
+
+// repairKeyspace repairs the keyspace on the first pending node. The update
+// of the status requeues the keyspace until no node is pending.
+func (h *keyspaceHandler) repairKeyspace(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace, status *cassandrav1alpha1.CassandraKeyspaceStatus) error {
+	if len(status.PendingRepairs) == 0 {
+		return nil
+	}
+
+	name := ccsvc.KeyspaceName(keyspace)
+	status.SetCondition(cassandrav1alpha1.KeyspaceRepaired, corev1.ConditionFalse, RepairPending, fmt.Sprintf(MessageRepairProgress, name, len(status.PendingRepairs)))
+	if err := h.ccSvc.RepairKeyspace(cc, keyspace, status.PendingRepairs[0]); err != nil {
+		h.recorder.Eventf(keyspace, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "keyspace repair", err)
+		return err
+	}
+
+	status.PendingRepairs = status.PendingRepairs[1:]
+	if len(status.PendingRepairs) > 0 {
+		status.SetCondition(cassandrav1alpha1.KeyspaceRepaired, corev1.ConditionFalse, RepairPending, fmt.Sprintf(MessageRepairProgress, name, len(status.PendingRepairs)))
+		return nil
+	}
+	status.PendingRepairsReplication = nil
+	msg := fmt.Sprintf(MessageKeyspaceRepaired, name)
+	h.recorder.Event(keyspace, corev1.EventTypeNormal, KeyspaceRepaired, msg)
+	status.SetCondition(cassandrav1alpha1.KeyspaceRepaired, corev1.ConditionTrue, KeyspaceRepaired, msg)
+	return nil
+}
+
+// readyCluster returns the cluster of the keyspace when it's not paused and
+// accepts CQL sessions of the operator. Otherwise it returns nil and sets the reason on
+// the synced condition, the keyspace is requeued when its cluster changes.
+func (h *keyspaceHandler) readyCluster(keyspace *cassandrav1alpha1.CassandraKeyspace, status *cassandrav1alpha1.CassandraKeyspaceStatus) (*cassandrav1alpha1.CassandraCluster, error) {
+	clusterName := keyspace.Spec.ClusterName
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(keyspace.Namespace).Get(clusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, clusterName))
+	case err != nil:
+		return nil, err
+	case cc.Spec.Paused:
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, ClusterPaused, fmt.Sprintf(MessageClusterPaused, clusterName))
+	case cc.Spec.Auth != nil && !cc.Status.IsConditionTrue(cassandrav1alpha1.ClusterAuthReady):
+		status.SetCondition(cassandrav1alpha1.KeyspaceSynced, corev1.ConditionFalse, WaitingForAuth, fmt.Sprintf(MessageWaitingForAuth, clusterName))
+	default:
+		return cc, nil
+	}
+	return nil, nil
+}
+
+// isKeyspaceConditionReason returns whether the condition of the given type
+// is present with the reason.
+func isKeyspaceConditionReason(status *cassandrav1alpha1.CassandraKeyspaceStatus, conditionType cassandrav1alpha1.CassandraKeyspaceConditionType, reason string) bool {
+	condition := status.GetCondition(conditionType)
+	return condition != nil && condition.Reason == reason
+}
+
+// updateStatus updates the status block of the CassandraKeyspace resource
+// when it differs from the stored one.
+func (h *keyspaceHandler) updateStatus(keyspace *cassandrav1alpha1.CassandraKeyspace, status *cassandrav1alpha1.CassandraKeyspaceStatus) error {
+	if equality.Semantic.DeepEqual(&keyspace.Status, status) {
+		return nil
+	}
+
+	keyspaceCopy := keyspace.DeepCopy()
+	keyspaceCopy.Status = *status
+	// The status endpoint is not found without the status subresource.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraKeyspaces(keyspace.Namespace).UpdateStatus(keyspaceCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraKeyspaces(keyspace.Namespace).Update(keyspaceCopy)
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+const (
+	// RepairStarted is used as part of the Event 'reason' when a scheduled repair of a CassandraCluster starts
+	RepairStarted = "RepairStarted"
+	// RepairCompleted is used as part of the Event 'reason' when a scheduled repair of a CassandraCluster completes
+	RepairCompleted = "RepairCompleted"
+	// RepairOverdue is used as part of the condition 'reason' when a keyspace of a CassandraCluster is not repaired within its gc grace
+	RepairOverdue = "RepairOverdue"
+	// KeyspacesRepaired is used as part of the condition 'reason' when the keyspaces of a CassandraCluster are repaired within their gc grace
+	KeyspacesRepaired = "KeyspacesRepaired"
+	// RepairDisabled is used as part of the condition 'reason' when the repairs of a CassandraCluster are not scheduled anymore
+	RepairDisabled = "RepairDisabled"
+
+	// MessageRepairStarted is the message used for an Event fired when a scheduled repair of a CassandraCluster starts
+	MessageRepairStarted = "Repair of %d keyspaces on %d nodes started"
+	// MessageRepairCompleted is the message used for an Event fired when a scheduled repair of a CassandraCluster completes
+	MessageRepairCompleted = "Repair of %d keyspaces completed in %s"
+	// MessageRepairOverdue is the message used for conditions when keyspaces of a CassandraCluster are not repaired within their gc grace
+	MessageRepairOverdue = "Keyspaces %s not fully repaired within the gc_grace_seconds of their tables, their deleted data may reappear"
+	// MessageKeyspacesRepaired is the message used for conditions when the keyspaces of a CassandraCluster are repaired within their gc grace
+	MessageKeyspacesRepaired = "Every keyspace repaired within the gc_grace_seconds of its tables"
+	// MessageRepairDisabled is the message used for conditions when the repairs of a CassandraCluster are not scheduled anymore
+	MessageRepairDisabled = "Repairs not scheduled"
+
+	// repairRequeueDelay is the delay before the next batch of ranges of a
+	// run without intensity pause, the other clusters are reconciled
+	// meanwhile.
+	repairRequeueDelay = time.Second
+)
+
+// repairer runs the scheduled repairs of the cassandra clusters, one batch of
+// ranges per reconciliation of the cluster handler, so the repairs never run
+// next to another reconciliation of their cluster.
+type repairer struct {
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the repairs, the progress is not recorded.
+	dryRun bool
+}
+
+// newRepairer returns a new repairer.
+func newRepairer(ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool) *repairer {
+	return &repairer{
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+	}
+}
+
+// ensure repairs the next ranges of the run in progress or starts a run when
+// it's due, then raises the repair overdue condition on status when a
+// keyspace was not repaired within its gc grace. It returns the delay after
+// which the cluster must be reconciled again to go on with the run, zero
+// when no run is in progress. The schedule is checked on every resync of the
+// cluster.
+func (r *repairer) ensure(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraClusterStatus) (time.Duration, error) {
+	spec := cc.Spec.Repair
+	if spec == nil {
+		if status.GetCondition(cassandrav1alpha1.ClusterRepairOverdue) != nil {
+			status.SetCondition(cassandrav1alpha1.ClusterRepairOverdue, corev1.ConditionFalse, RepairDisabled, MessageRepairDisabled)
+		}
+		return 0, nil
+	}
+	if cc.Spec.Paused {
+		return 0, nil
+	}
+	// The repairs would stream the tables a restore truncates and loads,
+	// they resume once the restore gives the cluster back to its clients.
+	if cc.Annotations[ccsvc.RestoreAnnotation] != "" {
+		return 0, nil
+	}
+
+	// An invalid spec is not retried, the cluster is requeued when it changes.
+	if err := ccsvc.ValidateRepair(spec); err != nil {
+		r.recorder.Event(cc, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		return 0, nil
+	}
+
+	// The repairs fail with nodes down, the cluster is requeued when its
+	// statefulsets become ready.
+	statefulSets, err := r.ccSvc.GetStatefulSets(cc)
+	if err != nil {
+		return 0, err
+	}
+	if !statefulSetsReady(statefulSets) {
+		return 0, nil
+	}
+	if cc.Spec.Auth != nil && !status.IsConditionTrue(cassandrav1alpha1.ClusterAuthReady) {
+		return 0, nil
+	}
+
+	progress, err := r.ccSvc.RepairProgress(cc)
+	if err != nil {
+		return 0, err
+	}
+	requeue, err := r.repair(cc, spec, progress)
+	if saveErr := r.ccSvc.SaveRepairProgress(cc, progress); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := r.ensureOverdueCondition(cc, spec, progress, status); err != nil {
+		return 0, err
+	}
+	if r.dryRun {
+		// The progress is not recorded on dry run, the run would start
+		// over on every requeue.
+		return 0, nil
+	}
+	return requeue, nil
+}
+
+// repair starts a run when it's due and repairs the next batch of ranges of
+// the run in progress, unless the intensity pauses it. It returns the delay
+// before the next batch, zero once the run is done.
+func (r *repairer) repair(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, progress *ccsvc.RepairProgress) (time.Duration, error) {
+	now := time.Now()
+	if progress.Run == nil {
+		if now.Before(ccsvc.NextRepairTime(spec, progress)) {
+			return 0, nil
+		}
+		run, err := r.ccSvc.StartRepair(cc, spec, now)
+		if err != nil {
+			r.recorder.Eventf(cc, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "repair", err)
+			return 0, err
+		}
+		progress.Run = run
+		progress.LastRunStart = &run.Start
+		r.recorder.Eventf(cc, corev1.EventTypeNormal, RepairStarted, MessageRepairStarted, len(run.Keyspaces), len(run.Pods))
+	}
+
+	run := progress.Run
+	if !run.Done() {
+		if run.NextBatch != nil {
+			if pause := time.Until(run.NextBatch.Time); pause > 0 {
+				return pause, nil
+			}
+			run.NextBatch = nil
+		}
+		if err := r.repairBatch(cc, spec, run); err != nil {
+			r.recorder.Eventf(cc, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "repair", err)
+			return 0, err
+		}
+		if !run.Done() {
+			requeue := repairRequeueDelay
+			if run.NextBatch != nil {
+				if pause := time.Until(run.NextBatch.Time); pause > requeue {
+					requeue = pause
+				}
+			}
+			return requeue, nil
+		}
+	}
+
+	if progress.Repaired == nil {
+		progress.Repaired = map[string]metav1.Time{}
+	}
+	for _, keyspace := range run.Keyspaces {
+		progress.Repaired[keyspace] = run.Start
+	}
+	progress.Run = nil
+	r.recorder.Eventf(cc, corev1.EventTypeNormal, RepairCompleted, MessageRepairCompleted, len(run.Keyspaces), time.Since(run.Start.Time).Round(time.Second))
+	return 0, nil
+}
+
+// repairBatch repairs the next ranges of the run at the same time, reading
+// the ranges of the pod first when they're not known. It schedules the next
+// batch after the pause of the intensity.
+func (r *repairer) repairBatch(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, run *ccsvc.RepairRun) error {
+	pod := run.Pods[run.Pod]
+	if run.Ranges == nil {
+		ranges, err := r.ccSvc.NodeRanges(cc, run.Pods, pod, spec.Incremental)
+		if err != nil {
+			return err
+		}
+		run.Ranges = ranges
+		run.Advance(0)
+		return nil
+	}
+
+	keyspace := run.Keyspaces[run.Keyspace]
+	batch := run.Batch(ccsvc.RepairParallelism(spec))
+	start := time.Now()
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i, tokens := range batch {
+		wg.Add(1)
+		go func(i int, tokens ccsvc.TokenRange) {
+			defer wg.Done()
+			errs[i] = r.ccSvc.RepairRange(cc, pod, keyspace, tokens, spec.Incremental)
+		}(i, tokens)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	run.Advance(len(batch))
+	if pause := ccsvc.RepairPause(spec, time.Since(start)); pause > 0 {
+		next := metav1.NewTime(time.Now().Add(pause))
+		run.NextBatch = &next
+	}
+	return nil
+}
+
+// ensureOverdueCondition reflects on the repair overdue condition of status
+// the keyspaces not repaired within their gc grace, recording an event when
+// they become overdue.
+func (r *repairer) ensureOverdueCondition(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, progress *ccsvc.RepairProgress, status *cassandrav1alpha1.CassandraClusterStatus) error {
+	keyspaces, err := r.ccSvc.RepairKeyspaces(cc, spec)
+	if err != nil {
+		return err
+	}
+	gcGrace, err := r.ccSvc.KeyspacesGCGrace(cc, keyspaces)
+	if err != nil {
+		return err
+	}
+
+	overdue := ccsvc.OverdueKeyspaces(progress, gcGrace, time.Now())
+	if len(overdue) == 0 {
+		status.SetCondition(cassandrav1alpha1.ClusterRepairOverdue, corev1.ConditionFalse, KeyspacesRepaired, MessageKeyspacesRepaired)
+		return nil
+	}
+	msg := fmt.Sprintf(MessageRepairOverdue, strings.Join(overdue, ", "))
+	if !status.IsConditionTrue(cassandrav1alpha1.ClusterRepairOverdue) {
+		r.recorder.Event(cc, corev1.EventTypeWarning, RepairOverdue, msg)
+	}
+	status.SetCondition(cassandrav1alpha1.ClusterRepairOverdue, corev1.ConditionTrue, RepairOverdue, msg)
+	return nil
+}
@@ -0,0 +1,130 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// repairingClient keeps the repair progress of a cluster of two ready nodes
+// with two ranges each, recording the repaired ranges.
+type repairingClient struct {
+	ccsvc.CassandraClusterClient
+	progress []byte
+	repaired []string
+}
+
+func (c *repairingClient) GetStatefulSets(*cassandrav1alpha1.CassandraCluster) ([]*appsv1.StatefulSet, error) {
+	replicas := int32(2)
+	return []*appsv1.StatefulSet{{
+		Spec:   appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 2},
+	}}, nil
+}
+
+func (c *repairingClient) RepairProgress(*cassandrav1alpha1.CassandraCluster) (*ccsvc.RepairProgress, error) {
+	progress := &ccsvc.RepairProgress{}
+	return progress, json.Unmarshal(c.progress, progress)
+}
+
+func (c *repairingClient) SaveRepairProgress(cc *cassandrav1alpha1.CassandraCluster, progress *ccsvc.RepairProgress) error {
+	raw, err := json.Marshal(progress)
+	c.progress = raw
+	return err
+}
+
+func (c *repairingClient) StartRepair(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, start time.Time) (*ccsvc.RepairRun, error) {
+	return &ccsvc.RepairRun{Start: metav1.NewTime(start), Keyspaces: []string{"app"}, Pods: []string{"cassandra-0", "cassandra-1"}}, nil
+}
+
+func (c *repairingClient) RepairKeyspaces(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.RepairSpec) ([]string, error) {
+	return []string{"app"}, nil
+}
+
+func (c *repairingClient) NodeRanges(cc *cassandrav1alpha1.CassandraCluster, pods []string, pod string, incremental bool) ([]ccsvc.TokenRange, error) {
+	return []ccsvc.TokenRange{{Start: "0", End: "1"}, {Start: "1", End: "2"}}, nil
+}
+
+func (c *repairingClient) RepairRange(cc *cassandrav1alpha1.CassandraCluster, pod, keyspace string, tokens ccsvc.TokenRange, incremental bool) error {
+	c.repaired = append(c.repaired, fmt.Sprintf("%s %s %s", pod, keyspace, tokens.End))
+	return nil
+}
+
+func (c *repairingClient) KeyspacesGCGrace(*cassandrav1alpha1.CassandraCluster, []string) (map[string]time.Duration, error) {
+	return map[string]time.Duration{"app": 10 * 24 * time.Hour}, nil
+}
+
+func TestRepairBatches(t *testing.T) {
+	cc := &cassandrav1alpha1.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: cassandrav1alpha1.CassandraClusterSpec{
+			StatefulSetName: "cassandra",
+			Repair:          &cassandrav1alpha1.RepairSpec{Schedule: "0 * * * *"},
+		},
+	}
+	since, _ := json.Marshal(&ccsvc.RepairProgress{Since: metav1.NewTime(time.Now().Add(-2 * time.Hour))})
+	client := &repairingClient{progress: since}
+	r := newRepairer(client, record.NewFakeRecorder(10), false)
+	status := &cassandrav1alpha1.CassandraClusterStatus{}
+
+	// Every reconciliation reads the ranges of a node or repairs a batch of
+	// them, the cluster is requeued until the run is done.
+	var requeues []time.Duration
+	for i := 0; i < 6; i++ {
+		requeue, err := r.ensure(cc, status)
+		if err != nil {
+			t.Fatalf("reconcile %d: %s", i, err)
+		}
+		requeues = append(requeues, requeue)
+	}
+	wantRequeues := []time.Duration{repairRequeueDelay, repairRequeueDelay, repairRequeueDelay, repairRequeueDelay, repairRequeueDelay, 0}
+	if !reflect.DeepEqual(requeues, wantRequeues) {
+		t.Errorf("got requeues %v, want %v", requeues, wantRequeues)
+	}
+	wantRepaired := []string{"cassandra-0 app 1", "cassandra-0 app 2", "cassandra-1 app 1", "cassandra-1 app 2"}
+	if !reflect.DeepEqual(client.repaired, wantRepaired) {
+		t.Errorf("got repaired ranges %v, want %v", client.repaired, wantRepaired)
+	}
+	// The condition is set on the status written by the cluster handler.
+	condition := status.GetCondition(cassandrav1alpha1.ClusterRepairOverdue)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != KeyspacesRepaired {
+		t.Errorf("got repair overdue condition %v, want the keyspaces repaired", condition)
+	}
+
+	// The next run waits for the schedule.
+	if requeue, err := r.ensure(cc, status); err != nil || requeue != 0 {
+		t.Errorf("got requeue %s, error %v, want no run", requeue, err)
+	}
+
+	// A run paused by its intensity is requeued once the pause elapses,
+	// without repairing meanwhile.
+	next := metav1.NewTime(time.Now().Add(time.Minute))
+	paused, _ := json.Marshal(&ccsvc.RepairProgress{
+		Since: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+		Run: &ccsvc.RepairRun{
+			Start:     metav1.Now(),
+			Keyspaces: []string{"app"},
+			Pods:      []string{"cassandra-0", "cassandra-1"},
+			Ranges:    []ccsvc.TokenRange{{Start: "0", End: "1"}},
+			NextBatch: &next,
+		},
+	})
+	client.progress, client.repaired = paused, nil
+	requeue, err := r.ensure(cc, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeue <= 50*time.Second || requeue > time.Minute || client.repaired != nil {
+		t.Errorf("got requeue %s and repaired %v, want the pause of the run", requeue, client.repaired)
+	}
+}
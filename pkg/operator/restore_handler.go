@@ -0,0 +1,493 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/camilocot/cassandra-crd/pkg/apis/cassandra"
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// restoreFinalizer keeps the CassandraRestores until the clients can reach
+// their cluster again.
+const restoreFinalizer = cassandra.GroupName + "/restore"
+
+const (
+	// BackupNotFound is used as part of the condition 'reason' when the backup of a CassandraRestore doesn't exist
+	BackupNotFound = "BackupNotFound"
+	// ClusterBusy is used as part of the condition 'reason' when the cluster of a CassandraRestore is being restored by another one
+	ClusterBusy = "ClusterBusy"
+	// RestoreClusterCreated is used as part of the Event 'reason' when a CassandraRestore creates its cluster
+	RestoreClusterCreated = "ClusterCreated"
+	// RestoreStarted is used as part of the Event 'reason' when a CassandraRestore starts
+	RestoreStarted = "RestoreStarted"
+	// RestoreCompleted is used as part of the Event 'reason' when a CassandraRestore completes
+	RestoreCompleted = "RestoreCompleted"
+	// RestoreFailed is used as part of the Event 'reason' when a CassandraRestore fails
+	RestoreFailed = "RestoreFailed"
+
+	// MessageBackupNotFound is the message used for conditions when the CassandraBackup of a CassandraRestore doesn't exist
+	MessageBackupNotFound = "CassandraBackup %q not found"
+	// MessageCompletedBackupNotFound is the message used for conditions when the backup of a CassandraRestore is not a completed one
+	MessageCompletedBackupNotFound = "CassandraBackup %q has no completed backup %q"
+	// MessageClusterBusy is the message used for conditions when the cluster of a CassandraRestore is being restored by another one
+	MessageClusterBusy = "CassandraCluster %q is being restored by CassandraRestore %q"
+	// MessageRestoreClusterCreated is the message used for an Event fired when a CassandraRestore creates its cluster
+	MessageRestoreClusterCreated = "CassandraCluster %q created with the tokens of backup %q"
+	// MessageRestoreStarted is the message used for an Event fired when a CassandraRestore starts
+	MessageRestoreStarted = "Restoring backup %q into CassandraCluster %q, its clients can't reach it until it's restored"
+	// MessageRestoreInProgress is the message used for conditions while a CassandraRestore is in progress
+	MessageRestoreInProgress = "Restoring backup %q into CassandraCluster %q: %s"
+	// MessageRestoreCompleted is the message used for an Event fired when a CassandraRestore completes
+	MessageRestoreCompleted = "Backup %q restored into CassandraCluster %q"
+	// MessageRestoreFailed is the message used for an Event fired when a CassandraRestore fails
+	MessageRestoreFailed = "Backup %q failed to download on %s, the tables of CassandraCluster %q are left untouched"
+)
+
+// restoreHandler is the cassandra restore handler that will handle the events
+// received from kubernetes.
+type restoreHandler struct {
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the statements and the jobs, nothing is restored.
+	dryRun bool
+	logger log.Logger
+}
+
+// newRestoreHandler returns a new restore handler.
+func newRestoreHandler(ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool, logger log.Logger) *restoreHandler {
+	return &restoreHandler{
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+		logger:   logger,
+	}
+}
+
+func (h *restoreHandler) Add(obj runtime.Object) error {
+	restore, ok := obj.(*cassandrav1alpha1.CassandraRestore)
+	if !ok {
+		return fmt.Errorf("%v is not a cassandra restore object", obj.GetObjectKind())
+	}
+
+	logger := h.logger.With("namespace", restore.Namespace, "restore", restore.Name, "reconcile", rand.String(8))
+	return h.withLogger(logger).Ensure(restore)
+}
+
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *restoreHandler) withLogger(logger log.Logger) *restoreHandler {
+	return newRestoreHandler(h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
+
+// Delete is called when a cassandra restore is deleted, its cluster was
+// given back to the clients before removing its finalizer.
+func (h *restoreHandler) Delete(name string) error {
+	h.logger.Infof("cassandra restore %s deleted", name)
+	return nil
+}
+
+func (h *restoreHandler) Ensure(restore *cassandrav1alpha1.CassandraRestore) error {
+	if restore.DeletionTimestamp != nil {
+		return h.finalize(restore)
+	}
+
+	restore, err := h.ensureFinalizer(restore)
+	if err != nil {
+		return err
+	}
+
+	status := restore.Status.DeepCopy()
+	err = h.ensureRestore(restore, status)
+	if h.dryRun {
+		// The status is not written on dry run.
+		return err
+	}
+	if updateErr := h.updateStatus(restore, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// ensureRestore restores the backup into the cluster, one phase per
+// reconciliation, creating the cluster when it doesn't exist. The restore is
+// resynced periodically to follow its download jobs.
+func (h *restoreHandler) ensureRestore(restore *cassandrav1alpha1.CassandraRestore, status *cassandrav1alpha1.CassandraRestoreStatus) error {
+	if status.Phase == cassandrav1alpha1.RestoreCompleted || status.Phase == cassandrav1alpha1.RestoreFailed {
+		return nil
+	}
+
+	backup, name, err := h.backup(restore, status)
+	if err != nil || backup == nil {
+		return err
+	}
+	status.Backup = name
+	manifest, err := h.ccSvc.BackupManifest(restore.Namespace, name)
+	if err != nil {
+		return err
+	}
+
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(restore.Namespace).Get(restore.Spec.ClusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err) && status.Phase == "":
+		return h.createCluster(restore, manifest, status)
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, restore.Spec.ClusterName))
+		return nil
+	case err != nil:
+		return err
+	case cc.Spec.Paused:
+		// The restore goes on once the cluster is resumed, it's resynced
+		// periodically until then.
+		status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, ClusterPaused, fmt.Sprintf(MessageClusterPaused, cc.Name))
+		return nil
+	}
+
+	if status.Phase == "" {
+		pods, err := h.ccSvc.ClusterPods(cc)
+		if err != nil {
+			return err
+		}
+		// An invalid spec is not retried, the restore is requeued when its
+		// cluster changes.
+		if err := ccsvc.ValidateRestore(restore, manifest, pods); err != nil {
+			h.recorder.Event(restore, corev1.EventTypeWarning, InvalidSpec, err.Error())
+			status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, InvalidSpec, err.Error())
+			return nil
+		}
+		if other := cc.Annotations[ccsvc.RestoreAnnotation]; other != "" && other != restore.Name {
+			status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, ClusterBusy, fmt.Sprintf(MessageClusterBusy, cc.Name, other))
+			return nil
+		}
+		if cc, err = h.blockCluster(cc, restore); err != nil {
+			return err
+		}
+		h.start(restore, cc, status)
+	}
+	return h.progressRestore(cc, backup, restore, manifest, status)
+}
+
+// start records the start of the restore, its cluster no longer reachable by
+// its clients.
+func (h *restoreHandler) start(restore *cassandrav1alpha1.CassandraRestore, cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraRestoreStatus) {
+	now := metav1.Now()
+	status.StartTime = &now
+	status.Phase = cassandrav1alpha1.RestoreBootstrapping
+	h.recorder.Eventf(restore, corev1.EventTypeNormal, RestoreStarted, MessageRestoreStarted, status.Backup, cc.Name)
+}
+
+// progressRestore moves the restore through its phases: it waits for the
+// nodes of the cluster, prepares its schema and downloads the backup next to
+// its tables. Only once the backup is downloaded on every node the tables are
+// truncated and the backup is loaded into them, before giving the cluster
+// back to its clients.
+func (h *restoreHandler) progressRestore(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, restore *cassandrav1alpha1.CassandraRestore, manifest *ccsvc.BackupManifest, status *cassandrav1alpha1.CassandraRestoreStatus) error {
+	if status.Phase == cassandrav1alpha1.RestoreBootstrapping {
+		statefulSets, err := h.ccSvc.GetStatefulSets(cc)
+		if err != nil {
+			return err
+		}
+		if len(statefulSets) == 0 || !statefulSetsReady(statefulSets) {
+			status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, WaitingForNodes, MessageWaitingForNodes)
+			return nil
+		}
+		// The schema is prepared as the superuser.
+		if cc.Spec.Auth != nil && !cc.Status.IsConditionTrue(cassandrav1alpha1.ClusterAuthReady) {
+			status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, WaitingForAuth, fmt.Sprintf(MessageWaitingForAuth, cc.Name))
+			return nil
+		}
+		// Every node must own the ranges of the backup it loads. On dry run
+		// the nodes run no command, their tokens are unknown.
+		if !h.dryRun {
+			err := h.ccSvc.ValidateRestoreTokens(cc, manifest)
+			if ccsvc.IsTokensMismatch(err) {
+				h.recorder.Event(restore, corev1.EventTypeWarning, InvalidSpec, err.Error())
+				return h.fail(restore, status, InvalidSpec, err.Error())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		status.Phase = cassandrav1alpha1.RestorePreparing
+	}
+
+	if status.Phase == cassandrav1alpha1.RestorePreparing {
+		if err := h.ccSvc.PrepareRestore(cc, restore, manifest); err != nil {
+			h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restored schema", err)
+			return err
+		}
+		if err := h.ccSvc.StartRestore(cc, backup, restore, manifest); err != nil {
+			h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restore downloads", err)
+			return err
+		}
+		status.Phase = cassandrav1alpha1.RestoreDownloading
+		h.setInProgress(cc, status, "downloading the backup")
+		// The download jobs just started, the restore is requeued with the
+		// update of its status.
+		return nil
+	}
+
+	if status.Phase == cassandrav1alpha1.RestoreDownloading {
+		downloaded, pending, failed, err := h.ccSvc.RestoreDownloads(restore)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return nil
+		}
+		if len(downloaded) == 0 && len(failed) == 0 {
+			failed = []string{"every node, the download jobs are gone"}
+		}
+		if len(failed) > 0 {
+			if err := h.ccSvc.AbortRestore(cc, restore); err != nil {
+				h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restore downloads", err)
+				return err
+			}
+			msg := fmt.Sprintf(MessageRestoreFailed, status.Backup, strings.Join(failed, ", "), cc.Name)
+			h.recorder.Event(restore, corev1.EventTypeWarning, RestoreFailed, msg)
+			return h.fail(restore, status, RestoreFailed, msg)
+		}
+		status.Phase = cassandrav1alpha1.RestoreTruncating
+		h.setInProgress(cc, status, "truncating the restored tables")
+	}
+
+	if status.Phase == cassandrav1alpha1.RestoreTruncating {
+		if err := h.ccSvc.TruncateRestore(cc, restore, manifest); err != nil {
+			h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restored tables", err)
+			return err
+		}
+		status.Phase = cassandrav1alpha1.RestoreRefreshing
+		h.setInProgress(cc, status, "loading the downloaded tables")
+		// The phase is written before the backup is loaded, so the tables
+		// are never truncated again once they hold a part of it. The update
+		// of the status requeues the restore.
+		if !h.dryRun {
+			return nil
+		}
+	}
+
+	if status.Phase == cassandrav1alpha1.RestoreRefreshing {
+		if err := h.ccSvc.FinishRestore(cc, restore, manifest); err != nil {
+			h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restored tables", err)
+			return err
+		}
+		if err := h.unblockCluster(restore); err != nil {
+			return err
+		}
+		msg := fmt.Sprintf(MessageRestoreCompleted, status.Backup, cc.Name)
+		now := metav1.Now()
+		status.CompletionTime = &now
+		status.Phase = cassandrav1alpha1.RestoreCompleted
+		h.recorder.Event(restore, corev1.EventTypeNormal, RestoreCompleted, msg)
+		status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionTrue, RestoreCompleted, msg)
+	}
+	return nil
+}
+
+// fail gives the cluster of the restore back to its clients and records the
+// failure of the restore with the reason, its tables were left untouched.
+func (h *restoreHandler) fail(restore *cassandrav1alpha1.CassandraRestore, status *cassandrav1alpha1.CassandraRestoreStatus, reason, msg string) error {
+	if err := h.unblockCluster(restore); err != nil {
+		return err
+	}
+	now := metav1.Now()
+	status.CompletionTime = &now
+	status.Phase = cassandrav1alpha1.RestoreFailed
+	status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, reason, msg)
+	return nil
+}
+
+// setInProgress reflects the step of the restore in progress on the
+// succeeded condition.
+func (h *restoreHandler) setInProgress(cc *cassandrav1alpha1.CassandraCluster, status *cassandrav1alpha1.CassandraRestoreStatus, step string) {
+	status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, RestoreStarted, fmt.Sprintf(MessageRestoreInProgress, status.Backup, cc.Name, step))
+}
+
+// backup returns the CassandraBackup of the restore and the name of the
+// restored backup, the one recorded on status once the restore started.
+// Otherwise it returns nil and sets the reason on the succeeded condition,
+// the restore is resynced periodically.
+func (h *restoreHandler) backup(restore *cassandrav1alpha1.CassandraRestore, status *cassandrav1alpha1.CassandraRestoreStatus) (*cassandrav1alpha1.CassandraBackup, string, error) {
+	backupName := restore.Spec.BackupName
+	backup, err := h.ccCli.CassandraV1alpha1().CassandraBackups(restore.Namespace).Get(backupName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, BackupNotFound, fmt.Sprintf(MessageBackupNotFound, backupName))
+		return nil, "", nil
+	case err != nil:
+		return nil, "", err
+	}
+
+	name := status.Backup
+	if name == "" {
+		name = restore.Spec.Backup
+	}
+	for i := len(backup.Status.Backups) - 1; i >= 0; i-- {
+		record := backup.Status.Backups[i]
+		if record.Phase == cassandrav1alpha1.BackupCompleted && (name == "" || record.Name == name) {
+			return backup, record.Name, nil
+		}
+	}
+	status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, BackupNotFound, fmt.Sprintf(MessageCompletedBackupNotFound, backupName, name))
+	return nil, "", nil
+}
+
+// createCluster creates the cluster of the restore from its template, or the
+// spec of the backed up cluster, with the tokens of the backed up nodes. The
+// clients can't reach it until it's restored.
+func (h *restoreHandler) createCluster(restore *cassandrav1alpha1.CassandraRestore, manifest *ccsvc.BackupManifest, status *cassandrav1alpha1.CassandraRestoreStatus) error {
+	spec := restore.Spec.ClusterTemplate.DeepCopy()
+	if spec == nil {
+		source, err := h.ccCli.CassandraV1alpha1().CassandraClusters(restore.Namespace).Get(manifest.Cluster, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, manifest.Cluster))
+			return nil
+		case err != nil:
+			return err
+		}
+		spec = source.Spec.DeepCopy()
+		spec.StatefulSetName = ""
+		spec.AdoptExisting = false
+		spec.Paused = false
+	}
+	if spec.StatefulSetName == "" {
+		spec.StatefulSetName = restore.Spec.ClusterName
+	}
+	spec.InitialTokensConfigMap = ccsvc.RestoreTokensName(restore)
+
+	cc := &cassandrav1alpha1.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      restore.Spec.ClusterName,
+			Namespace: restore.Namespace,
+			Annotations: map[string]string{
+				ccsvc.RestoreAnnotation: restore.Name,
+			},
+		},
+		Spec: *spec,
+	}
+	// An invalid spec is not retried, the restore is requeued when it
+	// changes.
+	if err := ccsvc.ValidateRestore(restore, manifest, ccsvc.ClusterPodNames(cc)); err != nil {
+		h.recorder.Event(restore, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, InvalidSpec, err.Error())
+		return nil
+	}
+
+	// The tokens must exist before the nodes bootstrap.
+	if err := h.ccSvc.EnsureRestoreTokens(cc, restore, manifest); err != nil {
+		h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "initial tokens", err)
+		return err
+	}
+	if h.dryRun {
+		h.logger.Infof("dry-run: would create cassandra cluster %s/%s", cc.Namespace, cc.Name)
+		return nil
+	}
+	if _, err := h.ccCli.CassandraV1alpha1().CassandraClusters(cc.Namespace).Create(cc); err != nil {
+		h.recorder.Eventf(restore, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "restored cluster", err)
+		return err
+	}
+	h.recorder.Eventf(restore, corev1.EventTypeNormal, RestoreClusterCreated, MessageRestoreClusterCreated, cc.Name, status.Backup)
+	h.start(restore, cc, status)
+	status.SetCondition(cassandrav1alpha1.RestoreSucceeded, corev1.ConditionFalse, WaitingForNodes, MessageWaitingForNodes)
+	return nil
+}
+
+// blockCluster annotates the cluster with the restore, its headless service
+// no longer selects its pods. It returns the updated cluster, on dry run the
+// cluster is not modified.
+func (h *restoreHandler) blockCluster(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore) (*cassandrav1alpha1.CassandraCluster, error) {
+	if cc.Annotations[ccsvc.RestoreAnnotation] == restore.Name || h.dryRun {
+		return cc, nil
+	}
+
+	ccCopy := cc.DeepCopy()
+	if ccCopy.Annotations == nil {
+		ccCopy.Annotations = map[string]string{}
+	}
+	ccCopy.Annotations[ccsvc.RestoreAnnotation] = restore.Name
+	return h.ccCli.CassandraV1alpha1().CassandraClusters(cc.Namespace).Update(ccCopy)
+}
+
+// unblockCluster removes the annotation of the restore from its cluster, so
+// its clients can reach it again. On dry run the cluster is not modified.
+func (h *restoreHandler) unblockCluster(restore *cassandrav1alpha1.CassandraRestore) error {
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(restore.Namespace).Get(restore.Spec.ClusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	}
+	if cc.Annotations[ccsvc.RestoreAnnotation] != restore.Name || h.dryRun {
+		return nil
+	}
+
+	ccCopy := cc.DeepCopy()
+	delete(ccCopy.Annotations, ccsvc.RestoreAnnotation)
+	_, err = h.ccCli.CassandraV1alpha1().CassandraClusters(cc.Namespace).Update(ccCopy)
+	return err
+}
+
+// ensureFinalizer adds the finalizer to the restore, returning the updated
+// restore. On dry run the restore is not modified.
+func (h *restoreHandler) ensureFinalizer(restore *cassandrav1alpha1.CassandraRestore) (*cassandrav1alpha1.CassandraRestore, error) {
+	if hasFinalizer(restore.Finalizers, restoreFinalizer) || h.dryRun {
+		return restore, nil
+	}
+
+	restoreCopy := restore.DeepCopy()
+	restoreCopy.Finalizers = append(restoreCopy.Finalizers, restoreFinalizer)
+	return h.ccCli.CassandraV1alpha1().CassandraRestores(restore.Namespace).Update(restoreCopy)
+}
+
+// finalize gives the cluster of the restore back to its clients, when the
+// restore is deleted before it finished, and removes the finalizer of the
+// restore.
+func (h *restoreHandler) finalize(restore *cassandrav1alpha1.CassandraRestore) error {
+	if !hasFinalizer(restore.Finalizers, restoreFinalizer) {
+		return nil
+	}
+	if err := h.unblockCluster(restore); err != nil {
+		return err
+	}
+
+	if h.dryRun {
+		return nil
+	}
+	restoreCopy := restore.DeepCopy()
+	restoreCopy.Finalizers = removeFinalizer(restoreCopy.Finalizers, restoreFinalizer)
+	_, err := h.ccCli.CassandraV1alpha1().CassandraRestores(restore.Namespace).Update(restoreCopy)
+	return err
+}
+
+// updateStatus updates the status block of the CassandraRestore resource when
+// it differs from the stored one.
+func (h *restoreHandler) updateStatus(restore *cassandrav1alpha1.CassandraRestore, status *cassandrav1alpha1.CassandraRestoreStatus) error {
+	if equality.Semantic.DeepEqual(&restore.Status, status) {
+		return nil
+	}
+
+	restoreCopy := restore.DeepCopy()
+	restoreCopy.Status = *status
+	// The status endpoint is not found without the status subresource.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraRestores(restore.Namespace).UpdateStatus(restoreCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraRestores(restore.Namespace).Update(restoreCopy)
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package operator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	typedcli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned/typed/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/log"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// restoreCli stores the cluster and the backup of a restore, the other
+// resources are not read by the restore steps.
+type restoreCli struct {
+	cassandracli.Interface
+	cc     *cassandrav1alpha1.CassandraCluster
+	backup *cassandrav1alpha1.CassandraBackup
+}
+
+func (c *restoreCli) CassandraV1alpha1() typedcli.CassandraV1alpha1Interface {
+	return &restoreTypedCli{cli: c}
+}
+
+type restoreTypedCli struct {
+	typedcli.CassandraV1alpha1Interface
+	cli *restoreCli
+}
+
+func (c *restoreTypedCli) CassandraClusters(string) typedcli.CassandraClusterInterface {
+	return &restoreClusters{cli: c.cli}
+}
+
+func (c *restoreTypedCli) CassandraBackups(string) typedcli.CassandraBackupInterface {
+	return &restoreBackups{cli: c.cli}
+}
+
+type restoreClusters struct {
+	typedcli.CassandraClusterInterface
+	cli *restoreCli
+}
+
+func (c *restoreClusters) Get(name string, _ metav1.GetOptions) (*cassandrav1alpha1.CassandraCluster, error) {
+	if c.cli.cc == nil || c.cli.cc.Name != name {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: cassandrav1alpha1.CCNamePlural}, name)
+	}
+	return c.cli.cc.DeepCopy(), nil
+}
+
+func (c *restoreClusters) Update(cc *cassandrav1alpha1.CassandraCluster) (*cassandrav1alpha1.CassandraCluster, error) {
+	c.cli.cc = cc.DeepCopy()
+	return cc, nil
+}
+
+type restoreBackups struct {
+	typedcli.CassandraBackupInterface
+	cli *restoreCli
+}
+
+func (c *restoreBackups) Get(name string, _ metav1.GetOptions) (*cassandrav1alpha1.CassandraBackup, error) {
+	return c.cli.backup.DeepCopy(), nil
+}
+
+// restoringClient records the restore steps run on the cluster, its download
+// jobs end with failed.
+type restoringClient struct {
+	ccsvc.CassandraClusterClient
+	steps   []string
+	pending bool
+	failed  bool
+}
+
+func (c *restoringClient) BackupManifest(namespace, name string) (*ccsvc.BackupManifest, error) {
+	return &ccsvc.BackupManifest{
+		Name:    name,
+		Cluster: "test",
+		Nodes: []ccsvc.BackupNode{
+			{Pod: "cassandra-0", Tokens: []string{"0"}, Files: []string{"app/users-1a2b/mc-1-big-Data.db"}},
+		},
+	}, nil
+}
+
+func (c *restoringClient) ClusterPods(*cassandrav1alpha1.CassandraCluster) ([]string, error) {
+	return []string{"cassandra-0"}, nil
+}
+
+func (c *restoringClient) GetStatefulSets(*cassandrav1alpha1.CassandraCluster) ([]*appsv1.StatefulSet, error) {
+	replicas := int32(1)
+	return []*appsv1.StatefulSet{{
+		Spec:   appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	}}, nil
+}
+
+func (c *restoringClient) ValidateRestoreTokens(*cassandrav1alpha1.CassandraCluster, *ccsvc.BackupManifest) error {
+	c.steps = append(c.steps, "tokens")
+	return nil
+}
+
+func (c *restoringClient) PrepareRestore(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRestore, *ccsvc.BackupManifest) error {
+	c.steps = append(c.steps, "prepare")
+	return nil
+}
+
+func (c *restoringClient) StartRestore(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraBackup, *cassandrav1alpha1.CassandraRestore, *ccsvc.BackupManifest) error {
+	c.steps = append(c.steps, "download")
+	return nil
+}
+
+func (c *restoringClient) RestoreDownloads(*cassandrav1alpha1.CassandraRestore) (downloaded, pending, failed []string, err error) {
+	switch {
+	case c.pending:
+		return nil, []string{"cassandra-0"}, nil, nil
+	case c.failed:
+		return nil, nil, []string{"cassandra-0"}, nil
+	}
+	return []string{"cassandra-0"}, nil, nil, nil
+}
+
+func (c *restoringClient) TruncateRestore(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRestore, *ccsvc.BackupManifest) error {
+	c.steps = append(c.steps, "truncate")
+	return nil
+}
+
+func (c *restoringClient) FinishRestore(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRestore, *ccsvc.BackupManifest) error {
+	c.steps = append(c.steps, "refresh")
+	return nil
+}
+
+func (c *restoringClient) AbortRestore(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRestore) error {
+	c.steps = append(c.steps, "abort")
+	return nil
+}
+
+func TestRestorePhases(t *testing.T) {
+	type reconcile struct {
+		pending bool
+		phase   cassandrav1alpha1.RestorePhase
+		blocked bool
+	}
+	tests := []struct {
+		name       string
+		failed     bool
+		reconciles []reconcile
+		steps      []string
+	}{
+		{
+			name: "the backup is loaded once downloaded on every node",
+			reconciles: []reconcile{
+				{pending: true, phase: cassandrav1alpha1.RestoreDownloading, blocked: true},
+				{pending: true, phase: cassandrav1alpha1.RestoreDownloading, blocked: true},
+				{phase: cassandrav1alpha1.RestoreRefreshing, blocked: true},
+				{phase: cassandrav1alpha1.RestoreCompleted},
+				{phase: cassandrav1alpha1.RestoreCompleted},
+			},
+			steps: []string{"tokens", "prepare", "download", "truncate", "refresh"},
+		},
+		{
+			name:   "a failed download leaves the tables untouched",
+			failed: true,
+			reconciles: []reconcile{
+				{pending: true, phase: cassandrav1alpha1.RestoreDownloading, blocked: true},
+				{phase: cassandrav1alpha1.RestoreFailed},
+				{phase: cassandrav1alpha1.RestoreFailed},
+			},
+			steps: []string{"tokens", "prepare", "download", "abort"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cli := &restoreCli{
+				cc: &cassandrav1alpha1.CassandraCluster{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+					Spec:       cassandrav1alpha1.CassandraClusterSpec{StatefulSetName: "cassandra"},
+				},
+				backup: &cassandrav1alpha1.CassandraBackup{
+					ObjectMeta: metav1.ObjectMeta{Name: "daily", Namespace: "default"},
+					Status: cassandrav1alpha1.CassandraBackupStatus{
+						Backups: []cassandrav1alpha1.BackupRecord{{Name: "daily-20180601", Phase: cassandrav1alpha1.BackupCompleted}},
+					},
+				},
+			}
+			client := &restoringClient{failed: test.failed}
+			h := newRestoreHandler(cli, client, record.NewFakeRecorder(20), false, log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat))
+			restore := &cassandrav1alpha1.CassandraRestore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "default"},
+				Spec:       cassandrav1alpha1.CassandraRestoreSpec{BackupName: "daily", ClusterName: "test"},
+			}
+			status := &cassandrav1alpha1.CassandraRestoreStatus{}
+
+			for i, reconcile := range test.reconciles {
+				client.pending = reconcile.pending
+				if err := h.ensureRestore(restore, status); err != nil {
+					t.Fatalf("reconcile %d: %s", i, err)
+				}
+				if status.Phase != reconcile.phase {
+					t.Errorf("reconcile %d: got phase %s, want %s", i, status.Phase, reconcile.phase)
+				}
+				// The clients can't reach the cluster until the restore ends.
+				if blocked := cli.cc.Annotations[ccsvc.RestoreAnnotation] == restore.Name; blocked != reconcile.blocked {
+					t.Errorf("reconcile %d: got cluster blocked %t, want %t", i, blocked, reconcile.blocked)
+				}
+			}
+			if !reflect.DeepEqual(client.steps, test.steps) {
+				t.Errorf("got steps %v, want %v", client.steps, test.steps)
+			}
+			if status.Backup != "daily-20180601" {
+				t.Errorf("got backup %q restored, want the last completed one", status.Backup)
+			}
+		})
+	}
+}
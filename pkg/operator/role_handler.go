@@ -0,0 +1,258 @@
+package operator
+
+import (
+	"fmt"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/camilocot/cassandra-crd/pkg/apis/cassandra"
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+// roleFinalizer keeps the CassandraRoles until their role is dropped from
+// the cluster.
+const roleFinalizer = cassandra.GroupName + "/role"
+
+const (
+	// ClusterNotFound is used as part of the condition 'reason' when the CassandraCluster of a resource doesn't exist
+	ClusterNotFound = "ClusterNotFound"
+	// ClusterPaused is used as part of the condition 'reason' when the CassandraCluster of a resource is paused
+	ClusterPaused = "ClusterPaused"
+	// AuthDisabled is used as part of the condition 'reason' when the CassandraCluster of a resource has no authentication
+	AuthDisabled = "AuthDisabled"
+	// WaitingForAuth is used as part of the condition 'reason' when the authentication of a CassandraCluster is not ready
+	WaitingForAuth = "WaitingForAuth"
+	// InvalidSpec is used as part of the Event 'reason' when the spec of a resource is not valid
+	InvalidSpec = "InvalidSpec"
+	// RoleDropped is used as part of the Event 'reason' when the role of a CassandraRole is dropped
+	RoleDropped = "RoleDropped"
+
+	// MessageClusterNotFound is the message used for conditions when the CassandraCluster of a resource doesn't exist
+	MessageClusterNotFound = "CassandraCluster %q not found"
+	// MessageClusterPaused is the message used for conditions when the CassandraCluster of a resource is paused
+	MessageClusterPaused = "CassandraCluster %q is paused, nothing is done on it until it's resumed"
+	// MessageAuthDisabled is the message used for conditions when the CassandraCluster of a resource has no authentication
+	MessageAuthDisabled = "CassandraCluster %q has no authentication"
+	// MessageWaitingForAuth is the message used for conditions waiting for the authentication of a CassandraCluster
+	MessageWaitingForAuth = "Waiting for the authentication of CassandraCluster %q to be ready"
+	// MessageRoleSynced is the message used for an Event fired when a CassandraRole is synced
+	MessageRoleSynced = "Role %q synced on CassandraCluster %q"
+	// MessageRoleDropped is the message used for an Event fired when the role of a CassandraRole is dropped
+	MessageRoleDropped = "Role %q dropped from CassandraCluster %q"
+)
+
+// roleHandler is the cassandra role handler that will handle the events
+// received from kubernetes.
+type roleHandler struct {
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the statements, the roles are not modified.
+	dryRun bool
+	logger log.Logger
+}
+
+// newRoleHandler returns a new role handler.
+func newRoleHandler(ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool, logger log.Logger) *roleHandler {
+	return &roleHandler{
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+		logger:   logger,
+	}
+}
+
+func (h *roleHandler) Add(obj runtime.Object) error {
+	role, ok := obj.(*cassandrav1alpha1.CassandraRole)
+	if !ok {
+		return fmt.Errorf("%v is not a cassandra role object", obj.GetObjectKind())
+	}
+
+	logger := h.logger.With("namespace", role.Namespace, "role", role.Name, "reconcile", rand.String(8))
+	return h.withLogger(logger).Ensure(role)
+}
+
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *roleHandler) withLogger(logger log.Logger) *roleHandler {
+	return newRoleHandler(h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
+
+// Delete is called when a cassandra role is deleted, its role was dropped
+// from the cluster before removing its finalizer.
+func (h *roleHandler) Delete(name string) error {
+	h.logger.Infof("cassandra role %s deleted", name)
+	return nil
+}
+
+func (h *roleHandler) Ensure(role *cassandrav1alpha1.CassandraRole) error {
+	if role.DeletionTimestamp != nil {
+		return h.finalize(role)
+	}
+
+	role, err := h.ensureFinalizer(role)
+	if err != nil {
+		return err
+	}
+
+	status := role.Status.DeepCopy()
+	err = h.ensureRole(role, status)
+	if h.dryRun {
+		// The status is not written on dry run.
+		return err
+	}
+	if updateErr := h.updateStatus(role, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// ensureRole syncs the role on its cluster once the cluster authentication is
+// ready, reflecting it on the synced condition.
+func (h *roleHandler) ensureRole(role *cassandrav1alpha1.CassandraRole, status *cassandrav1alpha1.CassandraRoleStatus) error {
+	cc, err := h.authReadyCluster(role, status)
+	if err != nil || cc == nil {
+		return err
+	}
+
+	// An invalid spec is not retried, the role is requeued when it changes.
+	if err := ccsvc.ValidateRole(role); err != nil {
+		h.recorder.Event(role, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, InvalidSpec, err.Error())
+		return nil
+	}
+
+	if err := h.ccSvc.EnsureRole(cc, role); err != nil {
+		msg := fmt.Sprintf(MessageSyncFailed, "role", err)
+		h.recorder.Event(role, corev1.EventTypeWarning, ErrSyncFailed, msg)
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, ErrSyncFailed, msg)
+		return err
+	}
+
+	msg := fmt.Sprintf(MessageRoleSynced, ccsvc.RoleName(role), cc.Name)
+	if !status.IsConditionTrue(cassandrav1alpha1.RoleSynced) {
+		h.recorder.Event(role, corev1.EventTypeNormal, SuccessSynced, msg)
+	}
+	status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionTrue, SuccessSynced, msg)
+	status.ObservedGeneration = role.Generation
+	return nil
+}
+
+// authReadyCluster returns the cluster of the role when it's not paused and
+// its authentication is ready. Otherwise it returns nil and sets the reason on the synced
+// condition, the role is requeued when its cluster changes.
+func (h *roleHandler) authReadyCluster(role *cassandrav1alpha1.CassandraRole, status *cassandrav1alpha1.CassandraRoleStatus) (*cassandrav1alpha1.CassandraCluster, error) {
+	clusterName := role.Spec.ClusterName
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(role.Namespace).Get(clusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, clusterName))
+	case err != nil:
+		return nil, err
+	case cc.Spec.Paused:
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, ClusterPaused, fmt.Sprintf(MessageClusterPaused, clusterName))
+	case cc.Spec.Auth == nil:
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, AuthDisabled, fmt.Sprintf(MessageAuthDisabled, clusterName))
+	case !cc.Status.IsConditionTrue(cassandrav1alpha1.ClusterAuthReady):
+		status.SetCondition(cassandrav1alpha1.RoleSynced, corev1.ConditionFalse, WaitingForAuth, fmt.Sprintf(MessageWaitingForAuth, clusterName))
+	default:
+		return cc, nil
+	}
+	return nil, nil
+}
+
+// ensureFinalizer adds the finalizer to the role, returning the updated
+// role. On dry run the role is not modified.
+func (h *roleHandler) ensureFinalizer(role *cassandrav1alpha1.CassandraRole) (*cassandrav1alpha1.CassandraRole, error) {
+	if hasFinalizer(role.Finalizers, roleFinalizer) || h.dryRun {
+		return role, nil
+	}
+
+	roleCopy := role.DeepCopy()
+	roleCopy.Finalizers = append(roleCopy.Finalizers, roleFinalizer)
+	return h.ccCli.CassandraV1alpha1().CassandraRoles(role.Namespace).Update(roleCopy)
+}
+
+// finalize drops the role from its cluster and removes the finalizer of the
+// role. The role is not dropped when its cluster is gone or has no
+// authentication.
+func (h *roleHandler) finalize(role *cassandrav1alpha1.CassandraRole) error {
+	if !hasFinalizer(role.Finalizers, roleFinalizer) {
+		return nil
+	}
+
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(role.Namespace).Get(role.Spec.ClusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return err
+	case cc.DeletionTimestamp != nil || cc.Spec.Auth == nil:
+	case cc.Spec.Paused:
+		// The role is dropped once the cluster is resumed, the role is
+		// resynced periodically until then.
+		return nil
+	default:
+		if err := h.ccSvc.DeleteRole(cc, role); err != nil {
+			h.recorder.Eventf(role, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "role deletion", err)
+			return err
+		}
+		h.recorder.Eventf(role, corev1.EventTypeNormal, RoleDropped, MessageRoleDropped, ccsvc.RoleName(role), cc.Name)
+	}
+
+	if h.dryRun {
+		return nil
+	}
+	roleCopy := role.DeepCopy()
+	roleCopy.Finalizers = removeFinalizer(roleCopy.Finalizers, roleFinalizer)
+	_, err = h.ccCli.CassandraV1alpha1().CassandraRoles(role.Namespace).Update(roleCopy)
+	return err
+}
+
+// updateStatus updates the status block of the CassandraRole resource when
+// it differs from the stored one.
+func (h *roleHandler) updateStatus(role *cassandrav1alpha1.CassandraRole, status *cassandrav1alpha1.CassandraRoleStatus) error {
+	if equality.Semantic.DeepEqual(&role.Status, status) {
+		return nil
+	}
+
+	roleCopy := role.DeepCopy()
+	roleCopy.Status = *status
+	// The status endpoint is not found without the status subresource.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraRoles(role.Namespace).UpdateStatus(roleCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraRoles(role.Namespace).Update(roleCopy)
+	}
+	return err
+}
+
+// hasFinalizer returns whether finalizer is in finalizers.
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer returns finalizers without finalizer.
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	var result []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
+)
+
+const (
+	// SuperuserUsernameKey is the key of the superuser secret with its username.
+	SuperuserUsernameKey = cql.UsernameKey
+	// SuperuserPasswordKey is the key of the superuser secret with its password.
+	SuperuserPasswordKey = cql.PasswordKey
+
+	// superuserUsername is the username of the generated superusers.
+	superuserUsername = "admin"
+	// defaultRole is the superuser created by cassandra on bootstrap, along
+	// with its well known password.
+	defaultRole     = "cassandra"
+	defaultPassword = "cassandra"
+
+	authKeyspace = "system_auth"
+	// maxAuthReplicationFactor is the highest replication factor of the
+	// system_auth keyspace, the recommended one for bigger clusters.
+	maxAuthReplicationFactor = 3
+)
+
+// SuperuserSecretName returns the name of the secret with the superuser
+// credentials of the cluster.
+func SuperuserSecretName(cc *cassandrav1alpha1.CassandraCluster) string {
+	if cc.Spec.Auth != nil && cc.Spec.Auth.SuperuserSecretName != "" {
+		return cc.Spec.Auth.SuperuserSecretName
+	}
+	return cc.Spec.StatefulSetName + "-superuser"
+}
+
+// EnsureSuperuserSecret makes sure the secret with the superuser credentials
+// exists, generating them when it doesn't. An existing secret is never
+// updated, it may hold the credentials already set on the cluster.
+func (r *CassandraClusterKubeClient) EnsureSuperuserSecret(cc *cassandrav1alpha1.CassandraCluster) error {
+	return r.ensureCredentialsSecret(cc, SuperuserSecretName(cc), superuserUsername)
+}
+
+// ensureCredentialsSecret creates the secret name with username and a random
+// password when it doesn't exist.
+func (r *CassandraClusterKubeClient) ensureCredentialsSecret(cc *cassandrav1alpha1.CassandraCluster, name, username string) error {
+	_, err := r.K8SService.GetSecret(cc.Namespace, name)
+	if err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	password, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	return r.K8SService.CreateSecret(cc.Namespace, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cc.Namespace,
+			Labels:    clusterLabels(cc),
+			OwnerReferences: []metav1.OwnerReference{
+				clusterOwnerReference(cc),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			cql.UsernameKey: []byte(username),
+			cql.PasswordKey: []byte(password),
+		},
+	})
+}
+
+// randomPassword returns a password of 32 random characters.
+func randomPassword() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// superuserCredentials returns the superuser credentials of the secret.
+func (r *CassandraClusterKubeClient) superuserCredentials(cc *cassandrav1alpha1.CassandraCluster) (cql.Credentials, error) {
+	secret, err := r.K8SService.GetSecret(cc.Namespace, SuperuserSecretName(cc))
+	if err != nil {
+		return cql.Credentials{}, err
+	}
+	return cql.SecretCredentials(secret)
+}
+
+// EnsureAuth replaces the default cassandra superuser with the one of the
+// superuser secret, and replicates the system_auth keyspace across the
+// cluster so the roles are not lost with a node. The cluster nodes must be
+// ready.
+func (r *CassandraClusterKubeClient) EnsureAuth(cc *cassandrav1alpha1.CassandraCluster) error {
+	superuser, err := r.superuserCredentials(cc)
+	if err != nil {
+		return err
+	}
+
+	session, err := r.cqlSession(cc, superuser)
+	if err != nil {
+		// The superuser doesn't exist yet, it's created with the default one.
+		if err := r.bootstrapSuperuser(cc, superuser, err); err != nil {
+			return err
+		}
+		if r.config.DryRun {
+			return nil
+		}
+		if session, err = r.cqlSession(cc, superuser); err != nil {
+			return fmt.Errorf("could not log in as the superuser %s: %s", superuser.Username, err)
+		}
+	}
+
+	if err := r.ensureAuthReplication(cc, session); err != nil {
+		return err
+	}
+	return r.dropDefaultRole(session, superuser)
+}
+
+// bootstrapSuperuser creates the superuser logged in as the default one.
+func (r *CassandraClusterKubeClient) bootstrapSuperuser(cc *cassandrav1alpha1.CassandraCluster, superuser cql.Credentials, loginErr error) error {
+	session, err := r.cqlSession(cc, cql.Credentials{Username: defaultRole, Password: defaultPassword})
+	if err != nil {
+		return fmt.Errorf("could not log in as the superuser %s (%s) nor the default one (%s)", superuser.Username, loginErr, err)
+	}
+
+	// The keyspace is replicated first, with its default replication the
+	// superuser would be lost with the node holding it.
+	if err := r.ensureAuthReplication(cc, session); err != nil {
+		return err
+	}
+
+	// The role may already exist with another password, like when the
+	// secret has been recreated.
+	role, password := cqlString(superuser.Username), cqlString(superuser.Password)
+	if err := r.execute(session, fmt.Sprintf("create superuser %s", superuser.Username),
+		fmt.Sprintf("CREATE ROLE IF NOT EXISTS %s WITH PASSWORD = %s AND SUPERUSER = true AND LOGIN = true", role, password)); err != nil {
+		return err
+	}
+	return r.execute(session, fmt.Sprintf("set the password of superuser %s", superuser.Username),
+		fmt.Sprintf("ALTER ROLE %s WITH PASSWORD = %s AND SUPERUSER = true AND LOGIN = true", role, password))
+}
+
+// dropDefaultRole drops the default superuser, its password is well known.
+func (r *CassandraClusterKubeClient) dropDefaultRole(session cql.Session, superuser cql.Credentials) error {
+	if superuser.Username == defaultRole {
+		return nil
+	}
+
+	var role string
+	err := session.Query("SELECT role FROM system_auth.roles WHERE role = ?", defaultRole).Scan(&role)
+	if err == cql.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.execute(session, fmt.Sprintf("drop the default superuser %s", defaultRole),
+		fmt.Sprintf("DROP ROLE IF EXISTS %s", cqlString(defaultRole)))
+}
+
+// ensureAuthReplication replicates the system_auth keyspace on every node of
+// the datacenter of the cluster, up to maxAuthReplicationFactor.
+func (r *CassandraClusterKubeClient) ensureAuthReplication(cc *cassandrav1alpha1.CassandraCluster, session cql.Session) error {
+	var datacenter string
+	if err := session.Query("SELECT data_center FROM system.local").Scan(&datacenter); err != nil {
+		return err
+	}
+
+	// The statefulsets without replicas have a single one.
+	var factor int32
+	for _, rack := range clusterRacks(cc) {
+		if rack.Replicas == nil {
+			factor++
+			continue
+		}
+		factor += *rack.Replicas
+	}
+	if factor > maxAuthReplicationFactor {
+		factor = maxAuthReplicationFactor
+	}
+	if factor < 1 {
+		factor = 1
+	}
+	desired := map[string]string{
+		"class":    "org.apache.cassandra.locator.NetworkTopologyStrategy",
+		datacenter: fmt.Sprintf("%d", factor),
+	}
+
+	var current map[string]string
+	if err := session.Query("SELECT replication FROM system_schema.keyspaces WHERE keyspace_name = ?", authKeyspace).Scan(&current); err != nil {
+		return err
+	}
+	if replicationEqual(current, desired) {
+		return nil
+	}
+
+	if err := r.execute(session, fmt.Sprintf("replicate %s %d times in datacenter %s", authKeyspace, factor, datacenter),
+		fmt.Sprintf("ALTER KEYSPACE %s WITH replication = %s", authKeyspace, cqlMap(desired))); err != nil {
+		return err
+	}
+	r.logger.Warningf("replication of %s changed, repair the keyspace on every node to replicate the existing roles", authKeyspace)
+	return nil
+}
+
+// replicationEqual returns whether the replication options are the same, the
+// replication strategy class may be qualified or not.
+func replicationEqual(current, desired map[string]string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	for key, value := range desired {
+		if key == "class" {
+			if strategyName(current[key]) != strategyName(value) {
+				return false
+			}
+			continue
+		}
+		if current[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// strategyName returns the unqualified name of a replication strategy class.
+func strategyName(class string) string {
+	return class[strings.LastIndex(class, ".")+1:]
+}
+
+// execute runs the statement described by description, on dry run it's only
+// logged. The statement is never logged as it may hold passwords.
+func (r *CassandraClusterKubeClient) execute(session cql.Session, description, statement string) error {
+	if r.config.DryRun {
+		r.logger.Infof("dry-run: would %s", description)
+		return nil
+	}
+	if err := session.Query(statement).Exec(); err != nil {
+		return fmt.Errorf("could not %s: %s", description, err)
+	}
+	r.logger.Infof("cassandra: %s", description)
+	return nil
+}
+
+// cqlSession returns the pooled session to the ready nodes of the cluster
+// through its headless service, or through its seed while a restore keeps
+// the clients out of the service. It doesn't authenticate without a
+// username. The session is encrypted when the cluster encrypts the client
+// connections.
+func (r *CassandraClusterKubeClient) cqlSession(cc *cassandrav1alpha1.CassandraCluster, creds cql.Credentials) (cql.Session, error) {
+	tls, err := r.cqlTLS(cc)
+	if err != nil {
+		return nil, err
+	}
+	return r.cql.Session(cql.Cluster{
+		Key:         clusterKey(cc),
+		Host:        sessionHost(cc),
+		Port:        cql.DefaultPort,
+		Credentials: creds,
+		TLS:         tls,
+	})
+}
+
+// sessionHost returns the host the sessions to the cluster connect to.
+func sessionHost(cc *cassandrav1alpha1.CassandraCluster) string {
+	if cc.Annotations[RestoreAnnotation] != "" {
+		return clusterSeeds(cc)
+	}
+	return clusterHost(cc)
+}
+
+// clusterKey returns the namespace/name key of the cluster.
+func clusterKey(cc *cassandrav1alpha1.CassandraCluster) string {
+	return cc.Namespace + "/" + cc.Name
+}
+
+// CloseSession closes the pooled CQL session of the cluster with the
+// namespace/name key.
+func (r *CassandraClusterKubeClient) CloseSession(key string) {
+	r.cql.Close(key)
+}
+
+// cqlString returns value as a CQL string literal.
+func cqlString(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+// cqlMap returns the map as a CQL map literal, sorted by key.
+func cqlMap(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, cqlString(key)+": "+cqlString(values[key]))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
@@ -0,0 +1,690 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	// BackupManifestKey is the key of the manifest ConfigMap of a backup with
+	// its manifest, also uploaded as manifest.json along with the backup.
+	BackupManifestKey = "manifest.json"
+	// S3AccessKeyIDKey and S3SecretAccessKeyKey are the keys of the
+	// credentials secret of an S3 destination.
+	S3AccessKeyIDKey     = "accessKeyId"
+	S3SecretAccessKeyKey = "secretAccessKey"
+
+	defaultBackupImage = "amazon/aws-cli"
+	defaultS3Region    = "us-east-1"
+	// backupTimeFormat is the time suffix of the backup names.
+	backupTimeFormat = "20060102150405"
+	// backupJobBackoffLimit is the number of retries of the backup jobs
+	// before they fail.
+	backupJobBackoffLimit = 3
+
+	// cassandraTablesPath is where the image keeps the data of the tables,
+	// with their snapshots at <keyspace>/<table>-<id>/snapshots/<tag>.
+	cassandraTablesPath = cassandraDataPath + "/data"
+	// manifestPath is where the manifest ConfigMap is mounted on the upload
+	// jobs and backupVolumePath the volume of a PersistentVolumeClaim
+	// destination.
+	manifestPath     = "/manifest"
+	backupVolumePath = "/backup"
+	// podNameLabel is set by the statefulset controller on its pods.
+	podNameLabel = "statefulset.kubernetes.io/pod-name"
+
+	// backupURLEnv and s3EndpointEnv are the environment variables of the
+	// backup jobs with the root of the destination and the S3 endpoint, the
+	// scripts of the jobs only expand them quoted.
+	backupURLEnv  = "BACKUP_URL"
+	s3EndpointEnv = "S3_ENDPOINT"
+)
+
+var (
+	// s3BucketRegexp, backupPathRegexp and s3EndpointRegexp are the valid
+	// buckets, prefixes or volume paths, and endpoints of the destinations.
+	s3BucketRegexp   = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	backupPathRegexp = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+	s3EndpointRegexp = regexp.MustCompile(`^https?://[A-Za-z0-9.-]+(:[0-9]+)?/?$`)
+)
+
+// BackupManifest describes a backup, so it can be restored on the nodes with
+// the same tokens.
+type BackupManifest struct {
+	Name      string      `json:"name"`
+	Cluster   string      `json:"cluster"`
+	Keyspaces []string    `json:"keyspaces,omitempty"`
+	StartTime metav1.Time `json:"startTime"`
+	// Schema has the CQL statements creating the tables of the backup.
+	Schema string `json:"schema"`
+	// Replication has the replication options of the keyspaces of the
+	// backup, so they can be created on a new cluster.
+	Replication map[string]map[string]string `json:"replication,omitempty"`
+	Nodes       []BackupNode                 `json:"nodes"`
+}
+
+// BackupNode is the backup of a node.
+type BackupNode struct {
+	Pod    string   `json:"pod"`
+	Tokens []string `json:"tokens"`
+	// Files are the snapshot files of the node, at <keyspace>/<table>-<id>/
+	// under the directory of the node in the backup.
+	Files []string `json:"files"`
+}
+
+// ValidateBackup returns an error describing the invalid spec of the backup.
+func ValidateBackup(backup *cassandrav1alpha1.CassandraBackup) error {
+	spec := backup.Spec
+	if spec.Schedule != "" {
+		if _, err := cron.ParseStandard(spec.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q: %s", spec.Schedule, err)
+		}
+	}
+	if spec.Retention < 0 {
+		return fmt.Errorf("retention can't be negative")
+	}
+
+	s3, pvc := spec.Destination.S3, spec.Destination.PersistentVolumeClaim
+	switch {
+	case s3 == nil && pvc == nil, s3 != nil && pvc != nil:
+		return fmt.Errorf("exactly one of the s3 and persistentVolumeClaim destinations must be set")
+	case s3 != nil && s3.Bucket == "":
+		return fmt.Errorf("the s3 destination requires a bucket")
+	case s3 != nil && s3.CredentialsSecretName == "":
+		return fmt.Errorf("the s3 destination requires a credentialsSecretName")
+	case pvc != nil && pvc.ClaimName == "":
+		return fmt.Errorf("the persistentVolumeClaim destination requires a claimName")
+	case s3 != nil && !s3BucketRegexp.MatchString(s3.Bucket):
+		return fmt.Errorf("invalid s3 bucket %q", s3.Bucket)
+	case s3 != nil && !validBackupPath(s3.Prefix):
+		return fmt.Errorf("invalid s3 prefix %q", s3.Prefix)
+	case s3 != nil && s3.Endpoint != "" && !s3EndpointRegexp.MatchString(s3.Endpoint):
+		return fmt.Errorf("invalid s3 endpoint %q", s3.Endpoint)
+	case pvc != nil && !validBackupPath(pvc.Path):
+		return fmt.Errorf("invalid persistentVolumeClaim path %q", pvc.Path)
+	}
+	return nil
+}
+
+// validBackupPath returns whether the prefix or volume path of a destination
+// has only letters, digits, dots, dashes, underscores and slashes, and stays
+// under the root of the destination.
+func validBackupPath(p string) bool {
+	if !backupPathRegexp.MatchString(p) {
+		return false
+	}
+	for _, element := range strings.Split(p, "/") {
+		if element == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// NextBackupTime returns when the next backup is due, after the last one
+// started or the creation of the resource. It returns false when no backup is
+// due anymore, the backups without schedule are taken once. The spec must be
+// valid.
+func NextBackupTime(backup *cassandrav1alpha1.CassandraBackup, last *metav1.Time) (time.Time, bool) {
+	if backup.Spec.Schedule == "" {
+		return backup.CreationTimestamp.Time, last == nil
+	}
+	schedule, err := cron.ParseStandard(backup.Spec.Schedule)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if last == nil {
+		return schedule.Next(backup.CreationTimestamp.Time), true
+	}
+	return schedule.Next(last.Time), true
+}
+
+// BackupName returns the name of the backup started at start.
+func BackupName(backup *cassandrav1alpha1.CassandraBackup, start time.Time) string {
+	return fmt.Sprintf("%s-%s", backup.Name, start.UTC().Format(backupTimeFormat))
+}
+
+// BackupManifestName returns the name of the ConfigMap with the manifest of
+// the backup name.
+func BackupManifestName(name string) string {
+	return name + "-manifest"
+}
+
+// backupURL returns the root of the destination of the backup, the URL of
+// the prefix of an S3 bucket or the directory of the mounted volume. The
+// backups are written under it at <name>/.
+func backupURL(backup *cassandrav1alpha1.CassandraBackup) string {
+	if s3 := backup.Spec.Destination.S3; s3 != nil {
+		return strings.TrimSuffix("s3://"+path.Join(s3.Bucket, s3.Prefix), "/")
+	}
+	return path.Join(backupVolumePath, backup.Spec.Destination.PersistentVolumeClaim.Path)
+}
+
+// StartBackup snapshots the keyspaces of the backup on every node of the
+// cluster with the name of the backup as tag, records its manifest and
+// creates the jobs uploading the snapshots. It can be retried: the snapshots
+// taken before are replaced until the first upload job is created, then
+// they're kept for the jobs copying them and only the missing jobs are
+// created.
+func (r *CassandraClusterKubeClient) StartBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name string, start time.Time) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+
+	uploaded, pending, failed, err := r.BackupUploads(backup, name)
+	if err != nil {
+		return err
+	}
+	if len(uploaded)+len(pending)+len(failed) == 0 {
+		if err := r.snapshotBackup(cc, backup, name, start, pods); err != nil {
+			return err
+		}
+	} else {
+		r.logger.Infof("backup %s already snapshotted, creating its missing upload jobs", name)
+	}
+
+	for i, pod := range pods {
+		job := generateUploadJob(cc, backup, name, pod, i)
+		if err := r.K8SService.CreateJob(backup.Namespace, job); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	r.logger.Infof("backup %s of %d nodes started", name, len(pods))
+	return nil
+}
+
+// snapshotBackup replaces the snapshots of the backup name on the nodes of
+// pods and records its manifest.
+func (r *CassandraClusterKubeClient) snapshotBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name string, start time.Time, pods []string) error {
+	var err error
+	manifest := &BackupManifest{
+		Name:      name,
+		Cluster:   cc.Name,
+		Keyspaces: backup.Spec.Keyspaces,
+		StartTime: metav1.NewTime(start),
+	}
+	// The snapshots are taken one after the other, close enough to restore
+	// a consistent state of the cluster.
+	for _, pod := range pods {
+		if err := r.snapshotNode(cc, backup, name, pod); err != nil {
+			return err
+		}
+	}
+	for _, pod := range pods {
+		node, err := r.backupNode(cc, name, pod)
+		if err != nil {
+			return err
+		}
+		manifest.Nodes = append(manifest.Nodes, *node)
+	}
+	if len(pods) > 0 {
+		if manifest.Schema, err = r.backupSchema(cc, name, pods[0]); err != nil {
+			return err
+		}
+	}
+	if manifest.Replication, err = r.keyspacesReplication(cc, backupKeyspaces(manifest)); err != nil {
+		return err
+	}
+
+	return r.createBackupManifest(backup, manifest)
+}
+
+// snapshotNode replaces the snapshot of the backup name on the node of pod.
+func (r *CassandraClusterKubeClient) snapshotNode(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name, pod string) error {
+	if err := r.clearSnapshot(cc, name, pod); err != nil {
+		return err
+	}
+	command, err := r.nodetoolCommand(cc, append([]string{"snapshot", "-t", name}, backup.Spec.Keyspaces...)...)
+	if err != nil {
+		return err
+	}
+	_, err = r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+	return err
+}
+
+// clearSnapshot removes the snapshot of the backup name from the node of pod.
+func (r *CassandraClusterKubeClient) clearSnapshot(cc *cassandrav1alpha1.CassandraCluster, name, pod string) error {
+	command, err := r.nodetoolCommand(cc, "clearsnapshot", "-t", name)
+	if err != nil {
+		return err
+	}
+	_, err = r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+	return err
+}
+
+// backupNode returns the tokens and the snapshot files of the backup name on
+// the node of pod.
+func (r *CassandraClusterKubeClient) backupNode(cc *cassandrav1alpha1.CassandraCluster, name, pod string) (*BackupNode, error) {
+	command, err := r.nodetoolCommand(cc, "info", "-T")
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, []string{
+		"find", cassandraTablesPath, "-path", snapshotPattern(name, "*"), "-type", "f",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	node := &BackupNode{Pod: pod, Tokens: parseTokens(info)}
+	for _, file := range strings.Fields(files) {
+		node.Files = append(node.Files, backupFile(file, name))
+	}
+	return node, nil
+}
+
+// backupSchema returns the schema of the tables saved along with the
+// snapshot of the backup name on the node of pod.
+func (r *CassandraClusterKubeClient) backupSchema(cc *cassandrav1alpha1.CassandraCluster, name, pod string) (string, error) {
+	return r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, []string{
+		"find", cassandraTablesPath, "-path", snapshotPattern(name, "schema.cql"), "-exec", "cat", "{}", "+",
+	})
+}
+
+// keyspacesReplication returns the replication options of the keyspaces.
+func (r *CassandraClusterKubeClient) keyspacesReplication(cc *cassandrav1alpha1.CassandraCluster, keyspaces []string) (map[string]map[string]string, error) {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return nil, err
+	}
+	replication := map[string]map[string]string{}
+	for _, keyspace := range keyspaces {
+		var options map[string]string
+		if err := session.Query("SELECT replication FROM system_schema.keyspaces WHERE keyspace_name = ?", keyspace).Scan(&options); err != nil {
+			return nil, fmt.Errorf("could not read the replication of keyspace %s: %s", keyspace, err)
+		}
+		replication[keyspace] = options
+	}
+	return replication, nil
+}
+
+// backupKeyspaces returns the keyspaces with files in the backup, sorted and
+// without the system ones.
+func backupKeyspaces(manifest *BackupManifest) []string {
+	seen := map[string]bool{}
+	var keyspaces []string
+	for _, node := range manifest.Nodes {
+		for _, file := range node.Files {
+			keyspace := strings.SplitN(file, "/", 2)[0]
+			if seen[keyspace] || isSystemKeyspace(keyspace) {
+				continue
+			}
+			seen[keyspace] = true
+			keyspaces = append(keyspaces, keyspace)
+		}
+	}
+	sort.Strings(keyspaces)
+	return keyspaces
+}
+
+// isSystemKeyspace returns whether the keyspace is managed by cassandra,
+// they're snapshotted along with the other ones but never restored.
+func isSystemKeyspace(keyspace string) bool {
+	return keyspace == "system" || strings.HasPrefix(keyspace, "system_")
+}
+
+// snapshotPattern returns the find pattern of the files of the snapshot tag.
+func snapshotPattern(tag, file string) string {
+	return fmt.Sprintf("*/snapshots/%s/%s", tag, file)
+}
+
+// backupFile returns the path of a snapshot file in the backup of its node,
+// without the data directory and the snapshot directory of the table.
+func backupFile(file, tag string) string {
+	file = strings.TrimPrefix(file, cassandraTablesPath+"/")
+	return strings.Replace(file, "/snapshots/"+tag+"/", "/", 1)
+}
+
+// parseTokens returns the tokens of the output of nodetool info -T.
+func parseTokens(info string) []string {
+	var tokens []string
+	for _, line := range strings.Split(info, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "Token" {
+			tokens = append(tokens, strings.TrimSpace(fields[1]))
+		}
+	}
+	return tokens
+}
+
+// createBackupManifest records the manifest on the manifest ConfigMap of the
+// backup, replacing the one of a previous attempt.
+func (r *CassandraClusterKubeClient) createBackupManifest(backup *cassandrav1alpha1.CassandraBackup, manifest *BackupManifest) error {
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := BackupManifestName(manifest.Name)
+	if err := r.K8SService.DeleteConfigMap(backup.Namespace, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return r.K8SService.CreateConfigMap(backup.Namespace, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			Labels:    backupNameLabels(backup, manifest.Name),
+			OwnerReferences: []metav1.OwnerReference{
+				backupOwnerReference(backup),
+			},
+		},
+		Data: map[string]string{
+			BackupManifestKey: string(raw),
+		},
+	})
+}
+
+// BackupManifest returns the manifest of the backup name.
+func (r *CassandraClusterKubeClient) BackupManifest(namespace, name string) (*BackupManifest, error) {
+	configMap, err := r.K8SService.GetConfigMap(namespace, BackupManifestName(name))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal([]byte(configMap.Data[BackupManifestKey]), manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest of backup %s: %s", name, err)
+	}
+	return manifest, nil
+}
+
+// BackupUploads returns the pods whose snapshot of the backup name is
+// uploaded, still being uploaded or failed to be uploaded.
+func (r *CassandraClusterKubeClient) BackupUploads(backup *cassandrav1alpha1.CassandraBackup, name string) (uploaded, pending, failed []string, err error) {
+	selector := labels.Set(backupNameLabels(backup, name))
+	selector["job"] = "upload"
+	jobs, err := r.K8SService.ListJobs(backup.Namespace, selector)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, job := range jobs {
+		pod := job.Labels["pod"]
+		switch {
+		case job.Status.Succeeded > 0:
+			uploaded = append(uploaded, pod)
+		case jobFailed(&job):
+			failed = append(failed, pod)
+		default:
+			pending = append(pending, pod)
+		}
+	}
+	return uploaded, pending, failed, nil
+}
+
+// FinishBackup removes the snapshots of the backup name from the nodes and
+// deletes its upload jobs.
+func (r *CassandraClusterKubeClient) FinishBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name string) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if err := r.clearSnapshot(cc, name, pod); err != nil {
+			return err
+		}
+	}
+	return r.deleteBackupJobs(backup, backupNameLabels(backup, name), false)
+}
+
+// PruneBackup deletes the manifest of the backup name and creates the job
+// removing it from the destination.
+func (r *CassandraClusterKubeClient) PruneBackup(backup *cassandrav1alpha1.CassandraBackup, name string) error {
+	if err := r.K8SService.DeleteConfigMap(backup.Namespace, BackupManifestName(name)); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	job := generatePruneJob(backup, name)
+	if err := r.K8SService.CreateJob(backup.Namespace, job); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteFinishedPruneJobs deletes the prune jobs of the backup that
+// succeeded, the failed ones are kept to be inspected.
+func (r *CassandraClusterKubeClient) DeleteFinishedPruneJobs(backup *cassandrav1alpha1.CassandraBackup) error {
+	selector := labels.Set(backupLabels(backup))
+	selector["job"] = "prune"
+	return r.deleteBackupJobs(backup, selector, true)
+}
+
+// deleteBackupJobs deletes the jobs of the selector, only the succeeded
+// ones when succeededOnly is set.
+func (r *CassandraClusterKubeClient) deleteBackupJobs(backup *cassandrav1alpha1.CassandraBackup, selector labels.Set, succeededOnly bool) error {
+	jobs, err := r.K8SService.ListJobs(backup.Namespace, selector)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if succeededOnly && job.Status.Succeeded == 0 {
+			continue
+		}
+		if err := r.K8SService.DeleteJob(backup.Namespace, job.Name); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobFailed returns whether the job failed after its retries.
+func jobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// backupLabels returns the labels of the resources of the CassandraBackup.
+func backupLabels(backup *cassandrav1alpha1.CassandraBackup) map[string]string {
+	return map[string]string{
+		"app":    "cassandra-backup",
+		"backup": backup.Name,
+	}
+}
+
+// backupNameLabels returns the labels of the resources of the backup name.
+func backupNameLabels(backup *cassandrav1alpha1.CassandraBackup, name string) map[string]string {
+	labels := backupLabels(backup)
+	labels["backup-name"] = name
+	return labels
+}
+
+// backupOwnerReference returns the reference making the CassandraBackup the
+// controller of its resources, they're deleted along with it.
+func backupOwnerReference(backup *cassandrav1alpha1.CassandraBackup) metav1.OwnerReference {
+	return *metav1.NewControllerRef(backup, schema.GroupVersionKind{
+		Group:   cassandrav1alpha1.SchemeGroupVersion.Group,
+		Version: cassandrav1alpha1.SchemeGroupVersion.Version,
+		Kind:    cassandrav1alpha1.BackupKind,
+	})
+}
+
+// generateUploadJob returns the job uploading the snapshot of the backup name
+// from the data volume of pod, the index-th node of the cluster. It runs on
+// the node of the pod to mount its volume. The first node uploads the
+// manifest too.
+func generateUploadJob(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name, pod string, index int) *batchv1.Job {
+	destination := path.Join(name, pod)
+	script := []string{
+		"set -e",
+		backupUploadFunction(backup),
+		fmt.Sprintf("cd %s", cassandraTablesPath),
+		fmt.Sprintf(`find . -path '%s' -type f | while read -r file; do upload "$file" "%s/$(echo "$file" | sed 's#^\./##; s#/snapshots/%s/#/#')"; done`,
+			snapshotPattern(name, "*"), destination, name),
+	}
+	volume, mount := podDataVolume(pod, true)
+	volumes, mounts := []corev1.Volume{volume}, []corev1.VolumeMount{mount}
+	if index == 0 {
+		script = append(script, fmt.Sprintf("upload %s/%s %s/%s", manifestPath, BackupManifestKey, name, BackupManifestKey))
+		volumes = append(volumes, corev1.Volume{
+			Name: "manifest",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: BackupManifestName(name)},
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: "manifest", MountPath: manifestPath, ReadOnly: true})
+	}
+
+	labels := backupNameLabels(backup, name)
+	labels["job"] = "upload"
+	labels["pod"] = pod
+	job := generateBackupJob(backup, backupOwnerReference(backup), fmt.Sprintf("%s-%d", name, index), labels, script, volumes, mounts)
+	job.Spec.Template.Spec.Affinity = podNodeAffinity(pod)
+	return job
+}
+
+// podDataVolume returns the data volume of pod and its mount on the data
+// path of the cassandra container.
+func podDataVolume(pod string, readOnly bool) (corev1.Volume, corev1.VolumeMount) {
+	volume := corev1.Volume{
+		Name: cassandraDataVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: cassandraDataVolumeName + "-" + pod,
+				ReadOnly:  readOnly,
+			},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      cassandraDataVolumeName,
+		MountPath: cassandraDataPath,
+		ReadOnly:  readOnly,
+	}
+	return volume, mount
+}
+
+// podNodeAffinity returns the affinity scheduling a pod on the node of pod,
+// the only one its data volume can be mounted on.
+func podNodeAffinity(pod string) *corev1.Affinity {
+	return &corev1.Affinity{
+		PodAffinity: &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{podNameLabel: pod},
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			},
+		},
+	}
+}
+
+// generatePruneJob returns the job removing the backup name from the
+// destination.
+func generatePruneJob(backup *cassandrav1alpha1.CassandraBackup, name string) *batchv1.Job {
+	var script string
+	if backup.Spec.Destination.S3 != nil {
+		script = s3Command("rm", "--recursive", fmt.Sprintf(`"$%s/%s/"`, backupURLEnv, name))
+	} else {
+		script = fmt.Sprintf(`rm -rf "$%s/%s"`, backupURLEnv, name)
+	}
+
+	labels := backupNameLabels(backup, name)
+	labels["job"] = "prune"
+	return generateBackupJob(backup, backupOwnerReference(backup), name+"-prune", labels, []string{script}, nil, nil)
+}
+
+// generateBackupJob returns a job controlled by owner running the script
+// with the volumes and the ones of the destination of the backup.
+func generateBackupJob(backup *cassandrav1alpha1.CassandraBackup, owner metav1.OwnerReference, name string, labels map[string]string, script []string, volumes []corev1.Volume, mounts []corev1.VolumeMount) *batchv1.Job {
+	image := backup.Spec.Image
+	if image == "" {
+		image = defaultBackupImage
+	}
+	container := corev1.Container{
+		Name:         "backup",
+		Image:        image,
+		Command:      []string{"/bin/sh", "-c", strings.Join(script, "\n")},
+		Env:          []corev1.EnvVar{{Name: backupURLEnv, Value: backupURL(backup)}},
+		VolumeMounts: mounts,
+	}
+
+	destination := backup.Spec.Destination
+	if s3 := destination.S3; s3 != nil {
+		region := s3.Region
+		if region == "" {
+			region = defaultS3Region
+		}
+		container.Env = append(container.Env,
+			secretEnvVar("AWS_ACCESS_KEY_ID", s3.CredentialsSecretName, S3AccessKeyIDKey),
+			secretEnvVar("AWS_SECRET_ACCESS_KEY", s3.CredentialsSecretName, S3SecretAccessKeyKey),
+			corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: region},
+		)
+		if s3.Endpoint != "" {
+			container.Env = append(container.Env, corev1.EnvVar{Name: s3EndpointEnv, Value: s3.Endpoint})
+		}
+	}
+	if pvc := destination.PersistentVolumeClaim; pvc != nil {
+		volumes = append(volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.ClaimName},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "backup", MountPath: backupVolumePath})
+	}
+
+	backoffLimit := int32(backupJobBackoffLimit)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: backup.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				owner,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{container},
+					Volumes:       volumes,
+				},
+			},
+		},
+	}
+}
+
+// backupUploadFunction returns the shell function copying the file $1 to the
+// path $2 of the destination.
+func backupUploadFunction(backup *cassandrav1alpha1.CassandraBackup) string {
+	if backup.Spec.Destination.S3 != nil {
+		return fmt.Sprintf(`upload() { %s; }`, s3Command("cp", `"$1"`, fmt.Sprintf(`"$%s/$2"`, backupURLEnv)))
+	}
+	return fmt.Sprintf(`upload() { mkdir -p "$(dirname "$%[1]s/$2")" && cp "$1" "$%[1]s/$2"; }`, backupURLEnv)
+}
+
+// s3Command returns the aws s3 command with args on the endpoint of the
+// destination, when the job has one.
+func s3Command(args ...string) string {
+	command := append([]string{"aws", "s3"}, args...)
+	command = append(command, "--only-show-errors", fmt.Sprintf(`${%[1]s:+--endpoint-url "$%[1]s"}`, s3EndpointEnv))
+	return strings.Join(command, " ")
+}
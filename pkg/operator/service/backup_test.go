@@ -0,0 +1,268 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+func TestNextBackupTime(t *testing.T) {
+	created := time.Date(2018, 6, 1, 10, 30, 0, 0, time.UTC)
+	last := metav1.NewTime(time.Date(2018, 6, 2, 3, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name     string
+		schedule string
+		last     *metav1.Time
+		next     time.Time
+		due      bool
+	}{
+		{
+			name: "without schedule the backup is due on creation",
+			next: created,
+			due:  true,
+		},
+		{
+			name: "without schedule the backup is taken once",
+			last: &last,
+			next: created,
+		},
+		{
+			name:     "the first scheduled backup follows the creation",
+			schedule: "0 3 * * *",
+			next:     time.Date(2018, 6, 2, 3, 0, 0, 0, time.UTC),
+			due:      true,
+		},
+		{
+			name:     "the next scheduled backup follows the last one",
+			schedule: "0 3 * * *",
+			last:     &last,
+			next:     time.Date(2018, 6, 3, 3, 0, 0, 0, time.UTC),
+			due:      true,
+		},
+		{
+			name:     "an invalid schedule is never due",
+			schedule: "every day",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backup := &cassandrav1alpha1.CassandraBackup{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec:       cassandrav1alpha1.CassandraBackupSpec{Schedule: test.schedule},
+			}
+			next, due := NextBackupTime(backup, test.last)
+			if !next.Equal(test.next) || due != test.due {
+				t.Errorf("got %s, %t, want %s, %t", next, due, test.next, test.due)
+			}
+		})
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{
+			file: "/cassandra_data/data/app/users-1a2b/snapshots/daily-20180601/mc-1-big-Data.db",
+			want: "app/users-1a2b/mc-1-big-Data.db",
+		},
+		{
+			file: "/cassandra_data/data/app/users-1a2b/snapshots/daily-20180601/manifest.json",
+			want: "app/users-1a2b/manifest.json",
+		},
+		{
+			// The indexes of a table are kept in a directory of its snapshot.
+			file: "/cassandra_data/data/app/users-1a2b/snapshots/daily-20180601/.users_email_idx/mc-1-big-Data.db",
+			want: "app/users-1a2b/.users_email_idx/mc-1-big-Data.db",
+		},
+		{
+			// The snapshots with other tags are left untouched.
+			file: "/cassandra_data/data/app/users-1a2b/snapshots/other/mc-1-big-Data.db",
+			want: "app/users-1a2b/snapshots/other/mc-1-big-Data.db",
+		},
+	}
+
+	for _, test := range tests {
+		if got := backupFile(test.file, "daily-20180601"); got != test.want {
+			t.Errorf("backupFile(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	info := `ID                     : 9f4a8c1e-8b7a-4e0e-9d0c-0a4c1e6f2b3d
+Gossip active          : true
+Load                   : 1.2 MiB
+Data Center            : datacenter1
+Rack                   : rack1
+Token                  : -9223372036854775808
+Token                  : -3074457345618258603
+Token                  : 3074457345618258602
+`
+	want := []string{"-9223372036854775808", "-3074457345618258603", "3074457345618258602"}
+	if got := parseTokens(info); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := parseTokens(""); got != nil {
+		t.Errorf("got %v, want no tokens", got)
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination cassandrav1alpha1.BackupDestination
+		valid       bool
+	}{
+		{
+			name: "s3 destination",
+			destination: cassandrav1alpha1.BackupDestination{S3: &cassandrav1alpha1.S3Destination{
+				Endpoint: "http://minio.default.svc:9000", Bucket: "backups", Prefix: "prod/cassandra", CredentialsSecretName: "s3",
+			}},
+			valid: true,
+		},
+		{
+			name:        "volume destination",
+			destination: cassandrav1alpha1.BackupDestination{PersistentVolumeClaim: &cassandrav1alpha1.PersistentVolumeClaimDestination{ClaimName: "backups", Path: "cassandra"}},
+			valid:       true,
+		},
+		{
+			name: "bucket with a command",
+			destination: cassandrav1alpha1.BackupDestination{S3: &cassandrav1alpha1.S3Destination{
+				Bucket: "backups;reboot", CredentialsSecretName: "s3",
+			}},
+		},
+		{
+			name: "prefix with a command substitution",
+			destination: cassandrav1alpha1.BackupDestination{S3: &cassandrav1alpha1.S3Destination{
+				Bucket: "backups", Prefix: "$(reboot)", CredentialsSecretName: "s3",
+			}},
+		},
+		{
+			name: "endpoint with spaces",
+			destination: cassandrav1alpha1.BackupDestination{S3: &cassandrav1alpha1.S3Destination{
+				Endpoint: "http://minio --debug", Bucket: "backups", CredentialsSecretName: "s3",
+			}},
+		},
+		{
+			name:        "path out of the volume",
+			destination: cassandrav1alpha1.BackupDestination{PersistentVolumeClaim: &cassandrav1alpha1.PersistentVolumeClaimDestination{ClaimName: "backups", Path: "../etc"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backup := &cassandrav1alpha1.CassandraBackup{Spec: cassandrav1alpha1.CassandraBackupSpec{Destination: test.destination}}
+			if err := ValidateBackup(backup); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestBackupJobsDestination(t *testing.T) {
+	backup := &cassandrav1alpha1.CassandraBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "daily", Namespace: "default"},
+		Spec: cassandrav1alpha1.CassandraBackupSpec{Destination: cassandrav1alpha1.BackupDestination{S3: &cassandrav1alpha1.S3Destination{
+			Endpoint: "http://minio:9000", Bucket: "backups", Prefix: "prod", CredentialsSecretName: "s3",
+		}}},
+	}
+	restore := &cassandrav1alpha1.CassandraRestore{ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "default"}}
+	jobs := []*batchv1.Job{
+		generateUploadJob(testCluster(), backup, "daily-20180601", "cassandra-0", 0),
+		generatePruneJob(backup, "daily-20180601"),
+		generateDownloadJob(backup, restore, "daily-20180601", "cassandra-0", "cassandra-0", 0),
+	}
+
+	// The destination reaches the scripts through the environment only.
+	for _, job := range jobs {
+		container := job.Spec.Template.Spec.Containers[0]
+		script := container.Command[2]
+		for _, value := range []string{"minio", "backups", "prod"} {
+			if strings.Contains(script, value) {
+				t.Errorf("job %s script holds %q:\n%s", job.Name, value, script)
+			}
+		}
+		env := map[string]string{}
+		for _, v := range container.Env {
+			env[v.Name] = v.Value
+		}
+		if env[backupURLEnv] != "s3://backups/prod" || env[s3EndpointEnv] != "http://minio:9000" {
+			t.Errorf("job %s got environment %v", job.Name, env)
+		}
+	}
+}
+
+// execRecorder records the commands run on the pods, failing them with err.
+type execRecorder struct {
+	k8s.Services
+	commands []string
+	err      error
+}
+
+func (e *execRecorder) ExecPod(namespace, name, container string, command []string) (string, error) {
+	e.commands = append(e.commands, fmt.Sprintf("%s: %s", name, strings.Join(command, " ")))
+	return "", e.err
+}
+
+func TestStartBackupRetry(t *testing.T) {
+	cc := testCluster()
+	backup := &cassandrav1alpha1.CassandraBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "daily", Namespace: "default"},
+		Spec: cassandrav1alpha1.CassandraBackupSpec{Destination: cassandrav1alpha1.BackupDestination{
+			PersistentVolumeClaim: &cassandrav1alpha1.PersistentVolumeClaimDestination{ClaimName: "backups"},
+		}},
+	}
+	const name = "daily-20180601"
+	exec := &execRecorder{Services: k8s.New(fake.NewSimpleClientset(), nil, testLogger()), err: fmt.Errorf("node down")}
+	client := NewCassandraClusterClient(exec, nil, Config{}, testLogger())
+	statefulSets, err := client.generateCassandraStatefulSets(cc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.CreateStatefulSet(cc.Namespace, statefulSets[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without upload jobs the snapshots are replaced, a failed snapshot
+	// starts no upload.
+	if err := client.StartBackup(cc, backup, name, time.Now()); err == nil {
+		t.Fatal("got no error for a failed snapshot")
+	}
+	if want := "cassandra-0: nodetool clearsnapshot -t " + name; len(exec.commands) == 0 || exec.commands[0] != want {
+		t.Errorf("got commands %v, want %q first", exec.commands, want)
+	}
+	if jobs, _ := exec.ListJobs(backup.Namespace, nil); len(jobs) != 0 {
+		t.Errorf("got %d upload jobs for a failed snapshot", len(jobs))
+	}
+
+	// Once an upload job is created the snapshots it copies are kept, only
+	// the missing jobs are created.
+	exec.commands = nil
+	if err := exec.CreateJob(backup.Namespace, generateUploadJob(cc, backup, name, "cassandra-0", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.StartBackup(cc, backup, name, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(exec.commands) != 0 {
+		t.Errorf("got commands %v on a started backup, want none", exec.commands)
+	}
+	if _, pending, _, err := client.BackupUploads(backup, name); err != nil || len(pending) != 3 {
+		t.Errorf("got uploads of %v, error %v, want the 3 nodes", pending, err)
+	}
+}
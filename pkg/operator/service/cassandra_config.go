@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	// cassandraConfigPath is the cassandra configuration of the image.
+	cassandraConfigPath = "/etc/cassandra/cassandra.yaml"
+	// cassandraEntrypoint is the script of the image that starts cassandra.
+	cassandraEntrypoint = "/run.sh"
+)
+
+// cassandraSetting is a top level setting of cassandra.yaml. The settings
+// with options replace the whole block of the setting.
+type cassandraSetting struct {
+	name    string
+	value   string
+	options []cassandraSetting
+}
+
+// cassandraSettings returns the settings of cassandra.yaml that the image
+// doesn't expose as environment variables and the cluster overrides.
+func cassandraSettings(cc *cassandrav1alpha1.CassandraCluster) []cassandraSetting {
+	var settings []cassandraSetting
+	if cc.Spec.Auth != nil {
+		settings = append(settings,
+			cassandraSetting{name: "authenticator", value: "PasswordAuthenticator"},
+			cassandraSetting{name: "authorizer", value: "CassandraAuthorizer"},
+		)
+	}
+	return append(settings, tlsSettings(cc)...)
+}
+
+// applyCassandraSettings replaces the command of the cassandra container with
+// a script that sets the initial tokens of the node, generates its keystores
+// and JMX files and sets the settings of the cluster on cassandra.yaml before
+// running the image entrypoint. The command of the image is kept when there's nothing to set,
+// so the pods of the existing clusters are not recreated.
+func applyCassandraSettings(cc *cassandrav1alpha1.CassandraCluster, container *corev1.Container) {
+	script := initialTokensCommands(cc)
+	script = append(script, tlsCommands(cc)...)
+	script = append(script, jmxCommands(cc)...)
+	for _, setting := range cassandraSettings(cc) {
+		script = append(script, settingCommand(setting))
+	}
+	if len(script) == 0 {
+		return
+	}
+	script = append(script, "exec /bin/bash "+cassandraEntrypoint)
+	container.Command = []string{"/bin/bash", "-c", strings.Join(script, " && ")}
+}
+
+// settingCommand returns the command setting the value of a top level setting
+// on cassandra.yaml. A setting with options has its block removed, along with
+// its indented lines, and appended with the options.
+func settingCommand(setting cassandraSetting) string {
+	if len(setting.options) == 0 {
+		return fmt.Sprintf(`sed -ri 's/^(# )?(%s:).*/\2 %s/' %s`, setting.name, setting.value, cassandraConfigPath)
+	}
+
+	lines := []string{fmt.Sprintf("'%s:'", setting.name)}
+	for _, option := range setting.options {
+		lines = append(lines, fmt.Sprintf("'    %s: %s'", option.name, option.value))
+	}
+	return fmt.Sprintf(`sed -ri '/^%[1]s:/,/^\S/{/^(%[1]s:|\s)/d}' %[2]s && printf '%%s\n' %[3]s >> %[2]s`,
+		setting.name, cassandraConfigPath, strings.Join(lines, " "))
+}
@@ -1,59 +1,221 @@
 package service
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/camilocot/cassandra-crd/pkg/log"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
 	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
-	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/api/errors"
 )
 
+// CassandraClusterClient knows how to ensure the kubernetes resources of a cassandra cluster
 type CassandraClusterClient interface {
+	EnsureServices(*cassandrav1alpha1.CassandraCluster) error
 	EnsureStatefulset(*cassandrav1alpha1.CassandraCluster) error
+	GetStatefulSets(*cassandrav1alpha1.CassandraCluster) ([]*appsv1.StatefulSet, error)
+	EnsureSuperuserSecret(*cassandrav1alpha1.CassandraCluster) error
+	EnsureAuth(*cassandrav1alpha1.CassandraCluster) error
+	EnsureTLS(*cassandrav1alpha1.CassandraCluster) (bool, error)
+	EnsureJMXSecret(*cassandrav1alpha1.CassandraCluster) error
+	EnsureRole(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRole) error
+	DeleteRole(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraRole) error
+	KeyspaceReplicationIncreased(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraKeyspace) (bool, error)
+	EnsureKeyspace(*cassandrav1alpha1.CassandraCluster, *cassandrav1alpha1.CassandraKeyspace) error
+	ClusterPods(*cassandrav1alpha1.CassandraCluster) ([]string, error)
+	RepairKeyspace(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace, pod string) error
+	StartBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name string, start time.Time) error
+	BackupUploads(backup *cassandrav1alpha1.CassandraBackup, name string) (uploaded, pending, failed []string, err error)
+	FinishBackup(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, name string) error
+	PruneBackup(backup *cassandrav1alpha1.CassandraBackup, name string) error
+	DeleteFinishedPruneJobs(*cassandrav1alpha1.CassandraBackup) error
+	BackupManifest(namespace, name string) (*BackupManifest, error)
+	EnsureRestoreTokens(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error
+	ValidateRestoreTokens(cc *cassandrav1alpha1.CassandraCluster, manifest *BackupManifest) error
+	PrepareRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error
+	StartRestore(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error
+	RestoreDownloads(restore *cassandrav1alpha1.CassandraRestore) (downloaded, pending, failed []string, err error)
+	TruncateRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error
+	FinishRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error
+	AbortRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore) error
+	RepairProgress(*cassandrav1alpha1.CassandraCluster) (*RepairProgress, error)
+	SaveRepairProgress(cc *cassandrav1alpha1.CassandraCluster, progress *RepairProgress) error
+	StartRepair(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, start time.Time) (*RepairRun, error)
+	RepairKeyspaces(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec) ([]string, error)
+	NodeRanges(cc *cassandrav1alpha1.CassandraCluster, pods []string, pod string, incremental bool) ([]TokenRange, error)
+	RepairRange(cc *cassandrav1alpha1.CassandraCluster, pod, keyspace string, tokens TokenRange, incremental bool) error
+	KeyspacesGCGrace(cc *cassandrav1alpha1.CassandraCluster, keyspaces []string) (map[string]time.Duration, error)
+	TaskPods(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask) ([]string, error)
+	RunTask(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask, pod string) (string, error)
+	EffectiveCluster(*cassandrav1alpha1.CassandraCluster) *cassandrav1alpha1.CassandraCluster
+	// CloseSession closes the CQL session of the cluster with the
+	// namespace/name key.
+	CloseSession(key string)
+	// WithLogger returns the client logging with logger.
+	WithLogger(log.Logger) CassandraClusterClient
 }
 
 type CassandraClusterKubeClient struct {
 	K8SService k8s.Services
+	cql        cql.Client
+	config     Config
 	logger     log.Logger
 }
 
-// NewRedisFailoverKubeClient creates a new RedisFailoverKubeClient
-func NewCassandraClusterClient(k8sService k8s.Services, logger log.Logger) *CassandraClusterKubeClient {
+// NewCassandraClusterClient creates a new CassandraClusterKubeClient
+func NewCassandraClusterClient(k8sService k8s.Services, cqlClient cql.Client, config Config, logger log.Logger) *CassandraClusterKubeClient {
 	return &CassandraClusterKubeClient{
 		K8SService: k8sService,
+		cql:        cqlClient,
+		config:     config,
 		logger:     logger,
 	}
 }
 
-// EnsureStatefulset makes sure the cassandra statefulset exists in the desired state
+// WithLogger returns a copy of the client logging with logger.
+func (r *CassandraClusterKubeClient) WithLogger(logger log.Logger) CassandraClusterClient {
+	return NewCassandraClusterClient(r.K8SService.WithLogger(logger), r.cql, r.config, logger)
+}
+
+// EnsureStatefulset makes sure the cassandra statefulsets of every rack exist in the desired state
 func (r *CassandraClusterKubeClient) EnsureStatefulset(cc *cassandrav1alpha1.CassandraCluster) error {
-	ss := r.generateCassandraStatefulSet(cc)
-	return r.K8SService.CreateOrUpdateStatefulSet(cc.Namespace, ss)
+	rotation, err := r.tlsRotation(cc)
+	if err != nil {
+		return err
+	}
+	statefulSets, err := r.generateCassandraStatefulSets(cc, rotation)
+	if err != nil {
+		return err
+	}
+	if err := r.removeStatefulSets(cc); err != nil {
+		return err
+	}
+	for _, ss := range statefulSets {
+		stored, err := r.K8SService.GetStatefulSet(cc.Namespace, ss.Name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkInternodeEncryption(cc, stored); err != nil {
+			return err
+		}
+	}
+	for _, ss := range statefulSets {
+		if cc.Spec.AdoptExisting {
+			if err := r.K8SService.AdoptStatefulSet(cc.Namespace, ss); err != nil {
+				return err
+			}
+		}
+		if err := r.K8SService.CreateOrUpdateStatefulSet(cc.Namespace, ss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EffectiveCluster returns a copy of the cluster with the operator defaults
+// merged under its spec, the resources are generated from it.
+func (r *CassandraClusterKubeClient) EffectiveCluster(cc *cassandrav1alpha1.CassandraCluster) *cassandrav1alpha1.CassandraCluster {
+	effective := cc.DeepCopy()
+	effective.Spec = *r.config.EffectiveSpec(&cc.Spec)
+	return effective
+}
+
+// GetStatefulSets returns the existing statefulsets of the cluster racks
+func (r *CassandraClusterKubeClient) GetStatefulSets(cc *cassandrav1alpha1.CassandraCluster) ([]*appsv1.StatefulSet, error) {
+	var statefulSets []*appsv1.StatefulSet
+	for _, rack := range clusterRacks(cc) {
+		ss, err := r.K8SService.GetStatefulSet(cc.Namespace, rackStatefulSetName(cc, rack))
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		statefulSets = append(statefulSets, ss)
+	}
+	return statefulSets, nil
+}
+
+// removeStatefulSets deletes the statefulsets controlled by the cluster that
+// belong to none of its racks once they're scaled to zero. A removed rack must
+// be scaled to zero before, once its nodes were decommissioned by hand. The
+// nodes of a cluster without racks can't be moved into racks, as the nodes of
+// the racks would bootstrap a new cluster from their own seed.
+func (r *CassandraClusterKubeClient) removeStatefulSets(cc *cassandrav1alpha1.CassandraCluster) error {
+	statefulSets, err := r.K8SService.ListStatefulSets(cc.Namespace)
+	if err != nil {
+		return err
+	}
+	desired := map[string]bool{}
+	for _, rack := range clusterRacks(cc) {
+		desired[rackStatefulSetName(cc, rack)] = true
+	}
+
+	for _, ss := range statefulSets {
+		controller := metav1.GetControllerOf(&ss)
+		if controller == nil || controller.UID != cc.UID || desired[ss.Name] {
+			continue
+		}
+		if ss.Spec.Replicas == nil || *ss.Spec.Replicas > 0 || ss.Status.Replicas > 0 {
+			if ss.Name == cc.Spec.StatefulSetName {
+				return fmt.Errorf("racks can't be added to a cluster whose nodes run in statefulSet %s/%s, restore a backup into a new cluster with racks instead", cc.Namespace, ss.Name)
+			}
+			return fmt.Errorf("statefulSet %s/%s belongs to no rack of the cluster, its rack must be scaled to zero replicas before it's removed", cc.Namespace, ss.Name)
+		}
+		if err := r.K8SService.DeleteStatefulSet(cc.Namespace, ss.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateCassandraStatefulSets returns the statefulsets of every rack of the
+// cluster, rotation is the last rotation of the certificate of its nodes.
+func (r *CassandraClusterKubeClient) generateCassandraStatefulSets(cc *cassandrav1alpha1.CassandraCluster, rotation string) ([]*appsv1.StatefulSet, error) {
+	if err := validateRacks(cc); err != nil {
+		return nil, err
+	}
+	if err := validateJMX(cc); err != nil {
+		return nil, err
+	}
+	var statefulSets []*appsv1.StatefulSet
+	for _, rack := range clusterRacks(cc) {
+		ss, err := r.generateCassandraStatefulSet(cc, rack, rotation)
+		if err != nil {
+			return nil, err
+		}
+		statefulSets = append(statefulSets, ss)
+	}
+	return statefulSets, nil
 }
-func (r *CassandraClusterKubeClient) generateCassandraStatefulSet(cc *cassandrav1alpha1.CassandraCluster) *appsv1beta2.StatefulSet {
-	labels := map[string]string{
-		"app":        "cassandra",
-		"controller": cc.Name,
+
+func (r *CassandraClusterKubeClient) generateCassandraStatefulSet(cc *cassandrav1alpha1.CassandraCluster, rack cassandrav1alpha1.RackSpec, rotation string) (*appsv1.StatefulSet, error) {
+	labels := rackLabels(cc, rack)
+	scheduling := podScheduling(cc, rack)
+	if scheduling.Affinity == nil && r.config.PodAntiAffinity {
+		scheduling.Affinity = defaultAffinity(cc)
 	}
-	return &appsv1beta2.StatefulSet{
+	ss := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      cc.Spec.StatefulSetName,
+			Name:      rackStatefulSetName(cc, rack),
 			Namespace: cc.Namespace,
 			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(cc, schema.GroupVersionKind{
-					Group:   cassandrav1alpha1.SchemeGroupVersion.Group,
-					Version: cassandrav1alpha1.SchemeGroupVersion.Version,
-					Kind:    "CassandraCluster",
-				}),
+				clusterOwnerReference(cc),
 			},
 		},
-		Spec: appsv1beta2.StatefulSetSpec{
+		Spec: appsv1.StatefulSetSpec{
 			ServiceName: cc.Spec.StatefulSetName + "-unready",
-			Replicas:    cc.Spec.Replicas,
+			Replicas:    rack.Replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
@@ -62,14 +224,19 @@ func (r *CassandraClusterKubeClient) generateCassandraStatefulSet(cc *cassandrav
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
+					Affinity:          scheduling.Affinity,
+					Tolerations:       scheduling.Tolerations,
+					NodeSelector:      scheduling.NodeSelector,
+					PriorityClassName: scheduling.PriorityClassName,
 					Containers: []corev1.Container{
 						{
-							Name:  "cassandra",
-							Image: "gcr.io/google-samples/cassandra:v13",
+							Name:      cassandraContainerName,
+							Image:     cc.Spec.Image,
+							Resources: clusterResources(cc),
 							Env: []corev1.EnvVar{
 								{
 									Name:  "CASSANDRA_SEEDS",
-									Value: cc.Spec.StatefulSetName + "-0." + cc.Spec.StatefulSetName + "-unready." + cc.Namespace + ".svc.cluster.local",
+									Value: clusterSeeds(cc),
 								},
 								{
 									Name:  "MAX_HEAP_SIZE",
@@ -129,4 +296,18 @@ func (r *CassandraClusterKubeClient) generateCassandraStatefulSet(cc *cassandrav
 			},
 		},
 	}
+
+	applyStorage(cc, ss)
+	applyRack(rack, findContainer(ss.Spec.Template.Spec.Containers, cassandraContainerName))
+	applyTLS(cc, ss, rotation)
+	applyJMX(cc, ss)
+	applyInitialTokens(cc, ss)
+	applyCassandraSettings(cc, findContainer(ss.Spec.Template.Spec.Containers, cassandraContainerName))
+
+	template, err := applyPodTemplate(cc, ss.Spec.Template)
+	if err != nil {
+		return nil, err
+	}
+	ss.Spec.Template = template
+	return ss, nil
 }
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"io/ioutil"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/log"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+func testLogger() log.Logger {
+	return log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat)
+}
+
+func testCluster() *cassandrav1alpha1.CassandraCluster {
+	replicas := int32(3)
+	return &cassandrav1alpha1.CassandraCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: types.UID("cluster-uid")},
+		Spec: cassandrav1alpha1.CassandraClusterSpec{
+			StatefulSetName: "cassandra",
+			Replicas:        &replicas,
+			Image:           "cassandra:3.11",
+		},
+	}
+}
+
+func TestEnsureStatefulsetOwnership(t *testing.T) {
+	foreign := metav1.OwnerReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "other",
+		UID:        types.UID("other-uid"),
+		Controller: func() *bool { controller := true; return &controller }(),
+	}
+
+	tests := []struct {
+		name          string
+		owners        []metav1.OwnerReference
+		adoptExisting bool
+		conflict      bool
+	}{
+		{
+			name:     "a statefulSet without controller is refused",
+			conflict: true,
+		},
+		{
+			name:          "a statefulSet without controller is adopted with adoptExisting",
+			adoptExisting: true,
+		},
+		{
+			name:     "a statefulSet of another controller is refused",
+			owners:   []metav1.OwnerReference{foreign},
+			conflict: true,
+		},
+		{
+			name:          "a statefulSet of another controller is refused with adoptExisting",
+			owners:        []metav1.OwnerReference{foreign},
+			adoptExisting: true,
+			conflict:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc := testCluster()
+			cc.Spec.AdoptExisting = test.adoptExisting
+			client := NewCassandraClusterClient(k8s.New(fake.NewSimpleClientset(), nil, testLogger()), nil, Config{}, testLogger())
+
+			// The existing statefulSet was made by hand from the generated one.
+			statefulSets, err := client.generateCassandraStatefulSets(cc, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			existing := statefulSets[0]
+			existing.OwnerReferences = test.owners
+			existing.Spec.Template.Spec.Containers[0].Image = "cassandra:3.0"
+			if err := client.K8SService.CreateStatefulSet(cc.Namespace, existing); err != nil {
+				t.Fatal(err)
+			}
+
+			err = client.EnsureStatefulset(cc)
+			if k8s.IsResourceConflict(err) != test.conflict {
+				t.Fatalf("got error %v, want conflict %t", err, test.conflict)
+			}
+			if !test.conflict && err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := client.K8SService.GetStatefulSet(cc.Namespace, existing.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			controller := metav1.GetControllerOf(stored)
+			if test.conflict {
+				// A refused statefulSet is left untouched.
+				if image := stored.Spec.Template.Spec.Containers[0].Image; image != "cassandra:3.0" {
+					t.Errorf("refused statefulSet updated to image %s", image)
+				}
+				if controller != nil && controller.UID == cc.UID {
+					t.Errorf("refused statefulSet controlled by the cluster")
+				}
+				return
+			}
+			if controller == nil || controller.UID != cc.UID {
+				t.Errorf("adopted statefulSet controlled by %v, want the cluster", controller)
+			}
+			if len(stored.OwnerReferences) != 1 {
+				t.Errorf("adopted statefulSet owned by %v, want only the cluster", stored.OwnerReferences)
+			}
+			// The adopted statefulSet keeps its pods until the cluster changes.
+			if image := stored.Spec.Template.Spec.Containers[0].Image; image != "cassandra:3.0" {
+				t.Errorf("adopted statefulSet updated to image %s", image)
+			}
+			if stored.Annotations[k8s.LegacyHashAnnotation] == "" {
+				t.Errorf("adopted statefulSet has no %s annotation", k8s.LegacyHashAnnotation)
+			}
+		})
+	}
+}
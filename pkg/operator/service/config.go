@@ -0,0 +1,45 @@
+package service
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+// DefaultImage is the cassandra image used when none is configured.
+const DefaultImage = "gcr.io/google-samples/cassandra:v13"
+
+// Config is the operator wide configuration of the resources generated for
+// the cassandra clusters.
+type Config struct {
+	// Image of the cassandra container.
+	Image string
+	// Resources of the cassandra container.
+	Resources corev1.ResourceRequirements
+	// StorageClassName of the cassandra data claims.
+	StorageClassName *string
+	// PodAntiAffinity spreads the pods of a cluster across nodes when they
+	// have no affinity.
+	PodAntiAffinity bool
+	// DryRun only logs the statements that would be executed on the
+	// cassandra clusters.
+	DryRun bool
+}
+
+// EffectiveSpec returns the spec with its unset values taken from the
+// operator defaults. The resources set in the spec replace the default ones
+// as a whole, a request merged with a smaller limit would be invalid.
+func (c Config) EffectiveSpec(spec *cassandrav1alpha1.CassandraClusterSpec) *cassandrav1alpha1.CassandraClusterSpec {
+	effective := spec.DeepCopy()
+	if effective.Image == "" {
+		effective.Image = c.Image
+	}
+	if effective.Resources == nil && (len(c.Resources.Limits) > 0 || len(c.Resources.Requests) > 0) {
+		effective.Resources = c.Resources.DeepCopy()
+	}
+	if effective.Storage != nil && effective.Storage.StorageClassName == nil && c.StorageClassName != nil {
+		storageClassName := *c.StorageClassName
+		effective.Storage.StorageClassName = &storageClassName
+	}
+	return effective
+}
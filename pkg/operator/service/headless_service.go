@@ -0,0 +1,90 @@
+package service
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+// EnsureServices makes sure the headless services of the cassandra cluster exist in the desired state
+func (r *CassandraClusterKubeClient) EnsureServices(cc *cassandrav1alpha1.CassandraCluster) error {
+	for _, svc := range r.generateCassandraServices(cc) {
+		if cc.Spec.AdoptExisting {
+			if err := r.K8SService.AdoptService(cc.Namespace, svc); err != nil {
+				return err
+			}
+		}
+		if err := r.K8SService.CreateOrUpdateService(cc.Namespace, svc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateCassandraServices returns the services of the cluster
+func (r *CassandraClusterKubeClient) generateCassandraServices(cc *cassandrav1alpha1.CassandraCluster) []*corev1.Service {
+	return []*corev1.Service{
+		r.generateCassandraUnreadyService(cc),
+		r.generateCassandraHeadlessService(cc),
+	}
+}
+
+// clusterOwnerReference returns the controller reference to the cluster set
+// on all the resources generated for it, so they are requeued and garbage
+// collected with the cluster.
+func clusterOwnerReference(cc *cassandrav1alpha1.CassandraCluster) metav1.OwnerReference {
+	return *metav1.NewControllerRef(cc, schema.GroupVersionKind{
+		Group:   cassandrav1alpha1.SchemeGroupVersion.Group,
+		Version: cassandrav1alpha1.SchemeGroupVersion.Version,
+		Kind:    cassandrav1alpha1.CCKind,
+	})
+}
+
+// generateCassandraUnreadyService returns the headless service that governs
+// the statefulsets of the cluster. It returns the IPs of the unready pods too,
+// bootstrapping a new cluster needs them.
+func (r *CassandraClusterKubeClient) generateCassandraUnreadyService(cc *cassandrav1alpha1.CassandraCluster) *corev1.Service {
+	svc := r.generateCassandraHeadlessService(cc)
+	svc.Name = cc.Spec.StatefulSetName + "-unready"
+	svc.Annotations = map[string]string{
+		"service.alpha.kubernetes.io/tolerate-unready-endpoints": "true",
+	}
+	return svc
+}
+
+// generateCassandraHeadlessService returns the headless service the clients
+// use to reach the ready cassandra nodes of the cluster. While the cluster is
+// restored its selector matches no pod, so the clients can't reach it.
+func (r *CassandraClusterKubeClient) generateCassandraHeadlessService(cc *cassandrav1alpha1.CassandraCluster) *corev1.Service {
+	labels := clusterLabels(cc)
+	selector := clusterLabels(cc)
+	if restore := cc.Annotations[RestoreAnnotation]; restore != "" {
+		selector[RestoreAnnotation] = restore
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cc.Spec.StatefulSetName,
+			Labels:    labels,
+			Namespace: cc.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				clusterOwnerReference(cc),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "cql",
+					Port:       9042,
+					TargetPort: intstr.FromInt(9042),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+			Selector:  selector,
+			ClusterIP: corev1.ClusterIPNone,
+			Type:      corev1.ServiceTypeClusterIP,
+		},
+	}
+}
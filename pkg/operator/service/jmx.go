@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
+)
+
+const (
+	// jmxUsername is the username of the generated JMX users.
+	jmxUsername = "jmx"
+	// jmxPasswordPath and jmxAccessPath are the JMX password and access
+	// files written from the credentials of the JMX secret when the nodes
+	// start. The password file is also the one nodetool reads the password
+	// from.
+	jmxPasswordPath = "/etc/cassandra/jmxremote.password"
+	jmxAccessPath   = "/etc/cassandra/jmxremote.access"
+
+	jmxUsernameEnv = "JMX_USERNAME"
+	jmxPasswordEnv = "JMX_PASSWORD"
+
+	jolokiaContainerName = "jolokia"
+	jolokiaPort          = 8778
+	// jolokiaURLEnv is the JMX service URL of the node given to the Jolokia
+	// sidecar, the containers of a pod share its loopback interface.
+	jolokiaURLEnv = "JMX_URL"
+	jolokiaURL    = "service:jmx:rmi:///jndi/rmi://127.0.0.1:7199/jmxrmi"
+)
+
+// jmxEnabled returns whether the JMX of the nodes requires credentials.
+func jmxEnabled(cc *cassandrav1alpha1.CassandraCluster) bool {
+	return cc.Spec.JMX != nil
+}
+
+// JMXSecretName returns the name of the secret with the JMX credentials of
+// the cluster.
+func JMXSecretName(cc *cassandrav1alpha1.CassandraCluster) string {
+	if cc.Spec.JMX != nil && cc.Spec.JMX.SecretName != "" {
+		return cc.Spec.JMX.SecretName
+	}
+	return cc.Spec.StatefulSetName + "-jmx"
+}
+
+// EnsureJMXSecret makes sure the secret with the JMX credentials exists,
+// generating them when it doesn't. An existing secret is never updated, the
+// nodes pick the changes of its credentials when they restart.
+func (r *CassandraClusterKubeClient) EnsureJMXSecret(cc *cassandrav1alpha1.CassandraCluster) error {
+	return r.ensureCredentialsSecret(cc, JMXSecretName(cc), jmxUsername)
+}
+
+// nodetoolCommand returns the nodetool command with args, authenticated with
+// the JMX user of the cluster when its JMX requires credentials.
+func (r *CassandraClusterKubeClient) nodetoolCommand(cc *cassandrav1alpha1.CassandraCluster, args ...string) ([]string, error) {
+	command := []string{"nodetool"}
+	if jmxEnabled(cc) {
+		secret, err := r.K8SService.GetSecret(cc.Namespace, JMXSecretName(cc))
+		if err != nil {
+			return nil, err
+		}
+		creds, err := cql.SecretCredentials(secret)
+		if err != nil {
+			return nil, err
+		}
+		command = append(command, "-u", creds.Username, "-pwf", jmxPasswordPath)
+	}
+	return append(command, args...), nil
+}
+
+// nodetoolScript returns the shell command running nodetool with args from
+// the containers of the cassandra pods, like the probes and hooks.
+func nodetoolScript(cc *cassandrav1alpha1.CassandraCluster, args string) string {
+	if !jmxEnabled(cc) {
+		return "nodetool " + args
+	}
+	return fmt.Sprintf(`nodetool -u "$%s" -pwf %s %s`, jmxUsernameEnv, jmxPasswordPath, args)
+}
+
+// applyJMX makes the cassandra container of the statefulset authenticate the
+// JMX connections with the credentials of the JMX secret, which the probes
+// and hooks of the container use too. The JMX port is no longer exposed when
+// it's bound to the loopback interface, the nodetool commands of the operator
+// run in the container and still reach it. The Jolokia sidecar is added when
+// requested, it reaches JMX through the loopback interface too.
+func applyJMX(cc *cassandrav1alpha1.CassandraCluster, ss *appsv1.StatefulSet) {
+	if !jmxEnabled(cc) {
+		return
+	}
+	jmx := cc.Spec.JMX
+
+	template := &ss.Spec.Template
+	container := findContainer(template.Spec.Containers, cassandraContainerName)
+	localJMX := "no"
+	if jmx.LocalOnly {
+		localJMX = "yes"
+		var ports []corev1.ContainerPort
+		for _, port := range container.Ports {
+			if port.Name != "jmx" {
+				ports = append(ports, port)
+			}
+		}
+		container.Ports = ports
+	}
+	container.Env = append(container.Env,
+		secretEnvVar(jmxUsernameEnv, JMXSecretName(cc), cql.UsernameKey),
+		secretEnvVar(jmxPasswordEnv, JMXSecretName(cc), cql.PasswordKey),
+		// LOCAL_JMX makes cassandra-env.sh bind JMX to the loopback interface
+		// or to every interface, the authentication options below override
+		// the ones it sets.
+		corev1.EnvVar{Name: "LOCAL_JMX", Value: localJMX},
+		corev1.EnvVar{Name: "JVM_EXTRA_OPTS", Value: strings.Join([]string{
+			"-Dcom.sun.management.jmxremote.authenticate=true",
+			"-Dcom.sun.management.jmxremote.password.file=" + jmxPasswordPath,
+			"-Dcom.sun.management.jmxremote.access.file=" + jmxAccessPath,
+		}, " ")},
+	)
+
+	container.ReadinessProbe.Exec.Command = []string{
+		"/bin/bash", "-c", fmt.Sprintf(`[[ $(%s | grep "$POD_IP") == *UN* ]]`, nodetoolScript(cc, "status")),
+	}
+	container.Lifecycle.PreStop.Exec.Command = []string{"/bin/sh", "-c", nodetoolScript(cc, "drain")}
+
+	if jmx.Jolokia != nil {
+		template.Spec.Containers = append(template.Spec.Containers, corev1.Container{
+			Name:      jolokiaContainerName,
+			Image:     jmx.Jolokia.Image,
+			Resources: jmx.Jolokia.Resources,
+			Env: []corev1.EnvVar{
+				{Name: jolokiaURLEnv, Value: jolokiaURL},
+				secretEnvVar(jmxUsernameEnv, JMXSecretName(cc), cql.UsernameKey),
+				secretEnvVar(jmxPasswordEnv, JMXSecretName(cc), cql.PasswordKey),
+			},
+			Ports: []corev1.ContainerPort{
+				{
+					Name:          "jolokia",
+					ContainerPort: jolokiaPort,
+				},
+			},
+		})
+	}
+}
+
+// validateJMX returns an error when the Jolokia sidecar of the cluster has no
+// valid image.
+func validateJMX(cc *cassandrav1alpha1.CassandraCluster) error {
+	if cc.Spec.JMX == nil || cc.Spec.JMX.Jolokia == nil {
+		return nil
+	}
+	image := cc.Spec.JMX.Jolokia.Image
+	if image == "" || strings.ContainsAny(image, " \t\n") {
+		return fmt.Errorf("invalid Jolokia image %q", image)
+	}
+	return nil
+}
+
+// jmxCommands returns the commands writing the JMX password and access files
+// of the JMX user, readable only by their owner as the JVM requires.
+func jmxCommands(cc *cassandrav1alpha1.CassandraCluster) []string {
+	if !jmxEnabled(cc) {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("rm -f %s %s", jmxPasswordPath, jmxAccessPath),
+		fmt.Sprintf(`printf '%%s %%s\n' "$%s" "$%s" > %s`, jmxUsernameEnv, jmxPasswordEnv, jmxPasswordPath),
+		fmt.Sprintf(`printf '%%s readwrite\n' "$%s" > %s`, jmxUsernameEnv, jmxAccessPath),
+		fmt.Sprintf("chmod 400 %s %s", jmxPasswordPath, jmxAccessPath),
+	}
+}
+
+// secretEnvVar returns the environment variable name with the key of the
+// secret.
+func secretEnvVar(name, secret, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+				Key:                  key,
+			},
+		},
+	}
+}
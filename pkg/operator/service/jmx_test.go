@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+func TestJolokiaSidecar(t *testing.T) {
+	tests := []struct {
+		name    string
+		jolokia *cassandrav1alpha1.JolokiaSpec
+		sidecar bool
+		invalid bool
+	}{
+		{name: "no sidecar unless requested"},
+		{name: "sidecar with its image", jolokia: &cassandrav1alpha1.JolokiaSpec{Image: "jolokia:1.5"}, sidecar: true},
+		{name: "sidecar without image", jolokia: &cassandrav1alpha1.JolokiaSpec{}, invalid: true},
+		{name: "sidecar with an invalid image", jolokia: &cassandrav1alpha1.JolokiaSpec{Image: "jolokia 1.5"}, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc := testCluster()
+			cc.Spec.JMX = &cassandrav1alpha1.JMXSpec{LocalOnly: true, Jolokia: test.jolokia}
+			client := NewCassandraClusterClient(k8s.New(fake.NewSimpleClientset(), nil, testLogger()), nil, Config{}, testLogger())
+
+			statefulSets, err := client.generateCassandraStatefulSets(cc, "")
+			if test.invalid {
+				if err == nil {
+					t.Fatal("got no error for an invalid Jolokia image")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sidecar *corev1.Container
+			for i, container := range statefulSets[0].Spec.Template.Spec.Containers {
+				if container.Name == jolokiaContainerName {
+					sidecar = &statefulSets[0].Spec.Template.Spec.Containers[i]
+				}
+			}
+			if (sidecar != nil) != test.sidecar {
+				t.Fatalf("got sidecar %t, want %t", sidecar != nil, test.sidecar)
+			}
+			if sidecar == nil {
+				return
+			}
+
+			// The sidecar reaches the local-only JMX of its node with the
+			// credentials of the JMX secret.
+			env := map[string]corev1.EnvVar{}
+			for _, v := range sidecar.Env {
+				env[v.Name] = v
+			}
+			if url := env[jolokiaURLEnv].Value; url != jolokiaURL {
+				t.Errorf("got JMX URL %q, want %q", url, jolokiaURL)
+			}
+			for _, name := range []string{jmxUsernameEnv, jmxPasswordEnv} {
+				from := env[name].ValueFrom
+				if from == nil || from.SecretKeyRef == nil || from.SecretKeyRef.Name != JMXSecretName(cc) {
+					t.Errorf("%s not taken from the JMX secret", name)
+				}
+			}
+		})
+	}
+}
@@ -1,37 +1,76 @@
 package k8s
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/camilocot/cassandra-crd/pkg/log"
 
-	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
-// Service the ServiceAccount service that knows how to interact with k8s to manage them
+// Services is the group of services that know how to interact with k8s to manage the cassandra resources
 type Services interface {
 	StatefulSet
+	Service
+	Secret
+	ConfigMap
+	Job
+	Pod
+	// WithLogger returns the services logging with logger.
+	WithLogger(logger log.Logger) Services
 }
 
 type services struct {
-	StatefulSet
+	*StatefulSetService
+	*ServiceService
+	*SecretService
+	*ConfigMapService
+	*JobService
+	*PodService
 }
 
-// New returns a new Kubernetes service.
-func New(kubecli kubernetes.Interface, logger log.Logger) Services {
+// New returns a new Kubernetes service. The rest config is used to run
+// commands in the pods.
+func New(kubecli kubernetes.Interface, restConfig *rest.Config, logger log.Logger) Services {
 	return &services{
-		StatefulSet: NewStatefulSetService(kubecli, logger),
+		StatefulSetService: NewStatefulSetService(kubecli, logger),
+		ServiceService:     NewServiceService(kubecli, logger),
+		SecretService:      NewSecretService(kubecli, logger),
+		ConfigMapService:   NewConfigMapService(kubecli, logger),
+		JobService:         NewJobService(kubecli, logger),
+		PodService:         NewPodService(kubecli, restConfig, logger),
 	}
 
 }
 
+func (s *services) WithLogger(logger log.Logger) Services {
+	return &services{
+		StatefulSetService: s.StatefulSetService.WithLogger(logger),
+		ServiceService:     s.ServiceService.WithLogger(logger),
+		SecretService:      s.SecretService.WithLogger(logger),
+		ConfigMapService:   s.ConfigMapService.WithLogger(logger),
+		JobService:         s.JobService.WithLogger(logger),
+		PodService:         s.PodService.WithLogger(logger),
+	}
+}
+
 // StatefulSet the StatefulSet service that knows how to interact with k8s to manage them
 type StatefulSet interface {
-	GetStatefulSet(namespace, name string) (*appsv1beta2.StatefulSet, error)
-	CreateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error
-	UpdateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error
-	CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error
+	GetStatefulSet(namespace, name string) (*appsv1.StatefulSet, error)
+	ListStatefulSets(namespace string) ([]appsv1.StatefulSet, error)
+	CreateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
+	UpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
+	CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
+	AdoptStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error
+	// DeleteStatefulSet deletes the statefulSet along with its pods.
+	DeleteStatefulSet(namespace, name string) error
 }
 
 // StatefulSetService is the service account service implementation using API calls to kubernetes.
@@ -49,19 +88,24 @@ func NewStatefulSetService(kubeClient kubernetes.Interface, logger log.Logger) *
 
 }
 
-func (s *StatefulSetService) CreateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error {
-	_, err := s.kubeClient.AppsV1beta2().StatefulSets(namespace).Create(statefulSet)
+// WithLogger returns a copy of the service logging with logger.
+func (s *StatefulSetService) WithLogger(logger log.Logger) *StatefulSetService {
+	return NewStatefulSetService(s.kubeClient, logger)
+}
+
+func (s *StatefulSetService) CreateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	_, err := s.kubeClient.AppsV1().StatefulSets(namespace).Create(statefulSet)
 	if err != nil {
 		return err
 
 	}
-	s.logger.Infof("statefulSet created")
+	s.logger.Infof("statefulSet %s/%s created", namespace, statefulSet.Name)
 	return err
 
 }
 
-func (s *StatefulSetService) GetStatefulSet(namespace, name string) (*appsv1beta2.StatefulSet, error) {
-	statefulSet, err := s.kubeClient.AppsV1beta2().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+func (s *StatefulSetService) GetStatefulSet(namespace, name string) (*appsv1.StatefulSet, error) {
+	statefulSet, err := s.kubeClient.AppsV1().StatefulSets(namespace).Get(name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 
@@ -70,34 +114,189 @@ func (s *StatefulSetService) GetStatefulSet(namespace, name string) (*appsv1beta
 
 }
 
-func (s *StatefulSetService) CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error {
+func (s *StatefulSetService) ListStatefulSets(namespace string) ([]appsv1.StatefulSet, error) {
+	statefulSets, err := s.kubeClient.AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return statefulSets.Items, nil
+}
+
+func (s *StatefulSetService) DeleteStatefulSet(namespace, name string) error {
+	// The pods of a statefulSet are orphaned unless the deletion is propagated.
+	propagation := metav1.DeletePropagationBackground
+	err := s.kubeClient.AppsV1().StatefulSets(namespace).Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("statefulSet %s/%s deleted", namespace, name)
+	return nil
+}
+
+// CreateOrUpdateStatefulSet creates the statefulSet or updates the fields
+// owned by the operator when they differ from the stored ones. The update is
+// skipped when nothing changed, so resyncs don't bump the resource version.
+// A stored statefulSet not controlled by the controller of the desired one
+// is never updated, a ResourceConflictError is returned instead.
+func (s *StatefulSetService) CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	hash, err := objectHash(statefulSet)
+	if err != nil {
+		return err
+	}
+
 	storedStatefulSet, err := s.GetStatefulSet(namespace, statefulSet.Name)
 	if err != nil {
 		// If no resource we need to create.
 		if errors.IsNotFound(err) {
+			setAnnotation(&statefulSet.ObjectMeta, LastAppliedHashAnnotation, hash)
 			return s.CreateStatefulSet(namespace, statefulSet)
 
 		}
 		return err
 
 	}
+	if err := checkControlled("statefulSet", storedStatefulSet, statefulSet); err != nil {
+		return err
+	}
+
+	diff := statefulSetDiff(storedStatefulSet, statefulSet)
+	storedHash := storedStatefulSet.Annotations[LastAppliedHashAnnotation]
+	keep := keepsLegacyTemplate(storedStatefulSet, hash)
+	if storedHash == hash && (keep || len(diff) == 0) {
+		return nil
+	}
+
+	switch {
+	case keep:
+		s.logger.Infof("statefulSet %s/%s has no last applied hash, it's upgraded keeping its pod template", namespace, statefulSet.Name)
+	case len(diff) > 0:
+		s.logger.Infof("statefulSet %s/%s differs on: %s", namespace, statefulSet.Name, strings.Join(changedPaths(diff), ", "))
+	default:
+		s.logger.Infof("statefulSet %s/%s last applied hash changed", namespace, statefulSet.Name)
+	}
 
 	// Already exists, need to Update.
-	// Set the correct resource version to ensure we are on the latest version. This way the only valid
-	// namespace is our spec(https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#concurrency-control-and-consistency),
-	// we will replace the current namespace state.
-	statefulSet.ResourceVersion = storedStatefulSet.ResourceVersion
-	return s.UpdateStatefulSet(namespace, statefulSet)
+	// Only the fields owned by the operator are replaced on the stored object,
+	// the rest of fields set by the apiserver or other controllers are kept.
+	// The stored resource version ensures we are on the latest version(https://github.com/kubernetes/community/blob/master/contributors/devel/api-conventions.md#concurrency-control-and-consistency).
+	updated := storedStatefulSet.DeepCopy()
+	for key, value := range statefulSet.Labels {
+		setLabel(&updated.ObjectMeta, key, value)
+	}
+	for key, value := range statefulSet.Annotations {
+		setAnnotation(&updated.ObjectMeta, key, value)
+	}
+	setAnnotation(&updated.ObjectMeta, LastAppliedHashAnnotation, hash)
+	updated.OwnerReferences = statefulSet.OwnerReferences
+	if keep {
+		setAnnotation(&updated.ObjectMeta, LegacyHashAnnotation, hash)
+		return s.UpdateStatefulSet(namespace, updated)
+	}
+	delete(updated.Annotations, LegacyHashAnnotation)
+	updated.Spec.Replicas = statefulSet.Spec.Replicas
+	updated.Spec.Template = statefulSet.Spec.Template
+	if statefulSet.Spec.UpdateStrategy.Type != "" {
+		updated.Spec.UpdateStrategy = statefulSet.Spec.UpdateStrategy
+	}
+	return s.UpdateStatefulSet(namespace, updated)
+
+}
 
+// keepsLegacyTemplate returns whether the update of the stored statefulSet
+// keeps its pod template and replicas. The statefulSets without the last
+// applied hash were created through apps/v1beta2 by the previous versions of
+// the operator, or made by hand and adopted. They're upgraded recording the
+// hash of the desired statefulSet on LegacyHashAnnotation, and keep their pods
+// until the desired statefulSet changes.
+func keepsLegacyTemplate(stored *appsv1.StatefulSet, hash string) bool {
+	if stored.Annotations[LastAppliedHashAnnotation] == "" {
+		return true
+	}
+	legacyHash, ok := stored.Annotations[LegacyHashAnnotation]
+	return ok && legacyHash == hash
 }
 
-func (s *StatefulSetService) UpdateStatefulSet(namespace string, statefulSet *appsv1beta2.StatefulSet) error {
-	_, err := s.kubeClient.AppsV1beta2().StatefulSets(namespace).Update(statefulSet)
+// AdoptStatefulSet sets the controller of the desired statefulSet on the
+// stored one when it has no controller, so it can be updated afterwards.
+// Only the statefulSets whose selector matches the desired pod template can
+// be adopted, the selector of a statefulSet can't be changed.
+func (s *StatefulSetService) AdoptStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	storedStatefulSet, err := s.GetStatefulSet(namespace, statefulSet.Name)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
 		return err
+	}
 
+	owner, err := statefulSetAdoptionReference(storedStatefulSet, statefulSet)
+	if err != nil || owner == nil {
+		return err
 	}
-	s.logger.Infof("statefulSet updated")
+
+	adopted := storedStatefulSet.DeepCopy()
+	adopted.OwnerReferences = append(adopted.OwnerReferences, *owner)
+	if err := s.UpdateStatefulSet(namespace, adopted); err != nil {
+		return err
+	}
+	s.logger.Infof("statefulSet %s/%s adopted by %s %s", namespace, statefulSet.Name, owner.Kind, owner.Name)
+	return nil
+}
+
+// statefulSetAdoptionReference returns the controller reference to add to
+// the stored statefulSet to adopt it, see adoptionReference. Only the
+// statefulSets whose selector matches the desired pod template can be adopted.
+func statefulSetAdoptionReference(stored, desired *appsv1.StatefulSet) (*metav1.OwnerReference, error) {
+	owner, err := adoptionReference("statefulSet", stored, desired)
+	if err != nil || owner == nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(stored.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if !selector.Matches(labels.Set(desired.Spec.Template.Labels)) {
+		return nil, fmt.Errorf("statefulSet %s/%s can't be adopted, its selector %s doesn't match the pod labels", stored.Namespace, stored.Name, selector)
+	}
+	return owner, nil
+}
+
+func (s *StatefulSetService) UpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	_, err := s.kubeClient.AppsV1().StatefulSets(namespace).Update(statefulSet)
+	if err != nil {
+		return err
+
+	}
+	s.logger.Infof("statefulSet %s/%s updated", namespace, statefulSet.Name)
 	return err
 
 }
+
+// statefulSetDiff returns the fields owned by the operator that differ
+// between the stored and the desired statefulSet. The immutable fields of the
+// spec, like the volume claim templates, are ignored as they can't be updated.
+func statefulSetDiff(stored, desired *appsv1.StatefulSet) []FieldChange {
+	var diff []FieldChange
+	diff = append(diff, derivativeChanges("metadata.labels", reflect.ValueOf(desired.Labels), reflect.ValueOf(stored.Labels))...)
+	diff = append(diff, derivativeChanges("metadata.annotations", reflect.ValueOf(desired.Annotations), reflect.ValueOf(stored.Annotations))...)
+	diff = append(diff, derivativeChanges("metadata.ownerReferences", reflect.ValueOf(desired.OwnerReferences), reflect.ValueOf(stored.OwnerReferences))...)
+	diff = append(diff, derivativeChanges("spec.replicas", reflect.ValueOf(desired.Spec.Replicas), reflect.ValueOf(stored.Spec.Replicas))...)
+	diff = append(diff, derivativeChanges("spec.template", reflect.ValueOf(desired.Spec.Template), reflect.ValueOf(stored.Spec.Template))...)
+	diff = append(diff, derivativeChanges("spec.updateStrategy", reflect.ValueOf(desired.Spec.UpdateStrategy), reflect.ValueOf(stored.Spec.UpdateStrategy))...)
+	return diff
+}
+
+func setLabel(meta *metav1.ObjectMeta, key, value string) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[key] = value
+}
+
+func setAnnotation(meta *metav1.ObjectMeta, key, value string) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[key] = value
+}
@@ -0,0 +1,194 @@
+package k8s
+
+import (
+	"io/ioutil"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+)
+
+func testLogger() log.Logger {
+	return log.New(ioutil.Discard, log.ErrorLevel, log.TextFormat)
+}
+
+func desiredStatefulSet(image string) *appsv1.StatefulSet {
+	replicas := int32(3)
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cassandra",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "cassandra"},
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cassandra"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "cassandra"}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "cassandra", Image: image}},
+				},
+			},
+		},
+	}
+}
+
+// defaultStatefulSet sets on the stored statefulSet some of the fields the
+// apiserver defaults.
+func defaultStatefulSet(statefulSet *appsv1.StatefulSet) {
+	grace := int64(30)
+	statefulSet.Spec.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+	statefulSet.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+	statefulSet.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	statefulSet.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	statefulSet.Spec.Template.Spec.TerminationGracePeriodSeconds = &grace
+	statefulSet.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	statefulSet.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+}
+
+// appliedStatefulSet returns the statefulSet as created by
+// CreateOrUpdateStatefulSet.
+func appliedStatefulSet(statefulSet *appsv1.StatefulSet) *appsv1.StatefulSet {
+	hash, err := objectHash(statefulSet)
+	if err != nil {
+		panic(err)
+	}
+	setAnnotation(&statefulSet.ObjectMeta, LastAppliedHashAnnotation, hash)
+	return statefulSet
+}
+
+func updates(client *fake.Clientset) []*appsv1.StatefulSet {
+	var updated []*appsv1.StatefulSet
+	for _, action := range client.Actions() {
+		if update, ok := action.(kubetesting.UpdateAction); ok {
+			updated = append(updated, update.GetObject().(*appsv1.StatefulSet))
+		}
+	}
+	return updated
+}
+
+func TestCreateOrUpdateStatefulSet(t *testing.T) {
+	tests := []struct {
+		name string
+		// stored returns the stored statefulSet, nil when it's created by
+		// CreateOrUpdateStatefulSet.
+		stored  func() *appsv1.StatefulSet
+		desired *appsv1.StatefulSet
+		updated bool
+		image   string
+	}{
+		{
+			name:    "an unchanged statefulSet is not updated",
+			desired: desiredStatefulSet("cassandra:3.11"),
+		},
+		{
+			name: "the fields defaulted by the apiserver don't update the statefulSet",
+			stored: func() *appsv1.StatefulSet {
+				stored := appliedStatefulSet(desiredStatefulSet("cassandra:3.11"))
+				defaultStatefulSet(stored)
+				return stored
+			},
+			desired: desiredStatefulSet("cassandra:3.11"),
+		},
+		{
+			name: "a change of a field owned by the operator updates the statefulSet",
+			stored: func() *appsv1.StatefulSet {
+				stored := appliedStatefulSet(desiredStatefulSet("cassandra:3.11"))
+				defaultStatefulSet(stored)
+				return stored
+			},
+			desired: desiredStatefulSet("cassandra:3.11.2"),
+			updated: true,
+			image:   "cassandra:3.11.2",
+		},
+		{
+			name: "a statefulSet without the last applied hash keeps its pod template",
+			stored: func() *appsv1.StatefulSet {
+				return desiredStatefulSet("cassandra:3.0")
+			},
+			desired: desiredStatefulSet("cassandra:3.11"),
+			updated: true,
+			image:   "cassandra:3.0",
+		},
+		{
+			name: "an upgraded statefulSet keeps its pod template until the desired one changes",
+			stored: func() *appsv1.StatefulSet {
+				stored := appliedStatefulSet(desiredStatefulSet("cassandra:3.11"))
+				stored.Spec.Template.Spec.Containers[0].Image = "cassandra:3.0"
+				setAnnotation(&stored.ObjectMeta, LegacyHashAnnotation, stored.Annotations[LastAppliedHashAnnotation])
+				return stored
+			},
+			desired: desiredStatefulSet("cassandra:3.11"),
+		},
+		{
+			name: "an upgraded statefulSet takes the pod template of the changed desired one",
+			stored: func() *appsv1.StatefulSet {
+				stored := appliedStatefulSet(desiredStatefulSet("cassandra:3.11"))
+				stored.Spec.Template.Spec.Containers[0].Image = "cassandra:3.0"
+				setAnnotation(&stored.ObjectMeta, LegacyHashAnnotation, stored.Annotations[LastAppliedHashAnnotation])
+				return stored
+			},
+			desired: desiredStatefulSet("cassandra:3.11.2"),
+			updated: true,
+			image:   "cassandra:3.11.2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			service := NewStatefulSetService(client, testLogger())
+			if test.stored == nil {
+				if err := service.CreateOrUpdateStatefulSet("default", desiredStatefulSet("cassandra:3.11")); err != nil {
+					t.Fatal(err)
+				}
+			} else if _, err := client.AppsV1().StatefulSets("default").Create(test.stored()); err != nil {
+				t.Fatal(err)
+			}
+			client.ClearActions()
+
+			if err := service.CreateOrUpdateStatefulSet("default", test.desired); err != nil {
+				t.Fatal(err)
+			}
+			updated := updates(client)
+			if (len(updated) > 0) != test.updated {
+				t.Fatalf("got %d updates, want updated %t", len(updated), test.updated)
+			}
+			if !test.updated {
+				return
+			}
+			if image := updated[0].Spec.Template.Spec.Containers[0].Image; image != test.image {
+				t.Errorf("updated image %s, want %s", image, test.image)
+			}
+
+			// The updated statefulSet is stable.
+			client.ClearActions()
+			if err := service.CreateOrUpdateStatefulSet("default", test.desired); err != nil {
+				t.Fatal(err)
+			}
+			if updated := updates(client); len(updated) > 0 {
+				t.Errorf("got %d updates on the next reconciliation, want none", len(updated))
+			}
+		})
+	}
+}
+
+func TestStatefulSetDiff(t *testing.T) {
+	stored := desiredStatefulSet("cassandra:3.11")
+	defaultStatefulSet(stored)
+
+	if diff := statefulSetDiff(stored, desiredStatefulSet("cassandra:3.11")); len(diff) > 0 {
+		t.Errorf("got diff %v of the defaulted fields, want none", diff)
+	}
+
+	diff := statefulSetDiff(stored, desiredStatefulSet("cassandra:3.11.2"))
+	want := "spec.template.spec.containers[0].image"
+	if len(diff) != 1 || diff[0].Path != want {
+		t.Errorf("got diff %v, want %s", diff, want)
+	}
+}
@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigMap the ConfigMap service that knows how to interact with k8s to manage them
+type ConfigMap interface {
+	GetConfigMap(namespace, name string) (*corev1.ConfigMap, error)
+	CreateConfigMap(namespace string, configMap *corev1.ConfigMap) error
+	UpdateConfigMap(namespace string, configMap *corev1.ConfigMap) error
+	DeleteConfigMap(namespace, name string) error
+}
+
+// ConfigMapService is the configMap service implementation using API calls to kubernetes.
+type ConfigMapService struct {
+	kubeClient kubernetes.Interface
+	logger     log.Logger
+}
+
+// NewConfigMapService returns a new ConfigMap KubeService.
+func NewConfigMapService(kubeClient kubernetes.Interface, logger log.Logger) *ConfigMapService {
+	return &ConfigMapService{
+		kubeClient: kubeClient,
+		logger:     logger,
+	}
+}
+
+// WithLogger returns a copy of the service logging with logger.
+func (c *ConfigMapService) WithLogger(logger log.Logger) *ConfigMapService {
+	return NewConfigMapService(c.kubeClient, logger)
+}
+
+func (c *ConfigMapService) GetConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	configMap, err := c.kubeClient.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return configMap, err
+}
+
+func (c *ConfigMapService) CreateConfigMap(namespace string, configMap *corev1.ConfigMap) error {
+	_, err := c.kubeClient.CoreV1().ConfigMaps(namespace).Create(configMap)
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("configMap %s/%s created", namespace, configMap.Name)
+	return nil
+}
+
+func (c *ConfigMapService) UpdateConfigMap(namespace string, configMap *corev1.ConfigMap) error {
+	_, err := c.kubeClient.CoreV1().ConfigMaps(namespace).Update(configMap)
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("configMap %s/%s updated", namespace, configMap.Name)
+	return nil
+}
+
+func (c *ConfigMapService) DeleteConfigMap(namespace, name string) error {
+	err := c.kubeClient.CoreV1().ConfigMaps(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("configMap %s/%s deleted", namespace, name)
+	return nil
+}
@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// LastAppliedHashAnnotation stores the hash of the last object applied by the
+// operator, it detects the fields removed from the desired object which the
+// derivative diff can't see.
+const LastAppliedHashAnnotation = "cassandra.databases.camilocot/last-applied-hash"
+
+// LegacyHashAnnotation stores the hash of the desired statefulSet when a
+// statefulSet without the last applied hash was upgraded keeping its pod
+// template, see keepsLegacyTemplate.
+const LegacyHashAnnotation = "cassandra.databases.camilocot/legacy-hash"
+
+// objectHash returns the hash of the JSON representation of an object.
+func objectHash(obj interface{}) (string, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(raw)), nil
+}
+
+// FieldChange is a field owned by the operator whose desired value differs
+// from the stored one.
+type FieldChange struct {
+	Path    string
+	Stored  interface{}
+	Desired interface{}
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, jsonValue(c.Stored), jsonValue(c.Desired))
+}
+
+// jsonValue returns the JSON representation of a value, falling back to its
+// Go representation when it can't be marshalled.
+func jsonValue(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(raw)
+}
+
+// changedPaths returns the paths of the changed fields.
+func changedPaths(changes []FieldChange) []string {
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	return paths
+}
+
+// derivativeChanges returns the fields set in desired that differ from
+// stored along with both values. As in equality.Semantic.DeepDerivative the
+// unset fields of desired are ignored, so the values defaulted by the
+// apiserver are not reported as changes.
+func derivativeChanges(path string, desired, stored reflect.Value) []FieldChange {
+	if equality.Semantic.DeepDerivative(desired.Interface(), stored.Interface()) {
+		return nil
+	}
+
+	var changes []FieldChange
+	switch desired.Kind() {
+	case reflect.Ptr:
+		if stored.IsNil() {
+			return []FieldChange{{Path: path, Desired: desired.Interface()}}
+		}
+		return derivativeChanges(path, desired.Elem(), stored.Elem())
+	case reflect.Struct:
+		for i := 0; i < desired.NumField(); i++ {
+			field := desired.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			changes = append(changes, derivativeChanges(fieldPath(path, field), desired.Field(i), stored.Field(i))...)
+		}
+	case reflect.Slice:
+		if desired.Len() != stored.Len() {
+			return []FieldChange{{Path: path, Stored: stored.Interface(), Desired: desired.Interface()}}
+		}
+		for i := 0; i < desired.Len(); i++ {
+			changes = append(changes, derivativeChanges(fmt.Sprintf("%s[%d]", path, i), desired.Index(i), stored.Index(i))...)
+		}
+	case reflect.Map:
+		for _, key := range desired.MapKeys() {
+			keyPath := fmt.Sprintf("%s[%v]", path, key.Interface())
+			storedValue := stored.MapIndex(key)
+			if !storedValue.IsValid() {
+				changes = append(changes, FieldChange{Path: keyPath, Desired: desired.MapIndex(key).Interface()})
+				continue
+			}
+			changes = append(changes, derivativeChanges(keyPath, desired.MapIndex(key), storedValue)...)
+		}
+	}
+
+	// Leaf values and types with custom equality (like resource quantities)
+	// are reported as a whole.
+	if len(changes) == 0 {
+		return []FieldChange{{Path: path, Stored: stored.Interface(), Desired: desired.Interface()}}
+	}
+	return changes
+}
+
+// fieldPath returns the path of a struct field using its JSON name, inlined
+// fields keep the path of their parent.
+func fieldPath(path string, field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" || (name == "" && field.Anonymous) {
+		return path
+	}
+	if name == "" {
+		name = field.Name
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,370 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DryRun is a Services implementation that reads the live state from the
+// wrapped services but only logs the changes it would apply. The intended
+// actions are kept per controller of the resources so they can be
+// summarised once the controller has been ensured.
+type DryRun struct {
+	services Services
+	logger   log.Logger
+	actions  *dryRunActions
+}
+
+// dryRunActions are the intended actions per controller, shared by the
+// DryRun services with different loggers.
+type dryRunActions struct {
+	mu      sync.Mutex
+	actions map[string][]string
+}
+
+// NewDryRun returns a new DryRun service reading from services.
+func NewDryRun(services Services, logger log.Logger) *DryRun {
+	return &DryRun{
+		services: services,
+		logger:   logger,
+		actions:  &dryRunActions{actions: map[string][]string{}},
+	}
+}
+
+// WithLogger satisfies Services interface, the returned services share the
+// recorded actions.
+func (d *DryRun) WithLogger(logger log.Logger) Services {
+	return &DryRun{
+		services: d.services.WithLogger(logger),
+		logger:   logger,
+		actions:  d.actions,
+	}
+}
+
+// Summary returns the actions recorded for the resources controlled by the
+// namespace/name controller since the last call, and forgets them.
+func (d *DryRun) Summary(namespace, name string) []string {
+	d.actions.mu.Lock()
+	defer d.actions.mu.Unlock()
+	key := namespace + "/" + name
+	actions := d.actions.actions[key]
+	delete(d.actions.actions, key)
+	return actions
+}
+
+// record logs the intended action over the object and its changes, and keeps
+// it for the summary of its controller.
+func (d *DryRun) record(action, kind string, obj metav1.Object, changes []FieldChange) {
+	resource := fmt.Sprintf("%s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+	d.logger.Infof("dry-run: would %s %s", action, resource)
+	for _, change := range changes {
+		d.logger.Infof("dry-run:   %s", change)
+	}
+
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return
+	}
+	summary := action + " " + resource
+	if len(changes) > 0 {
+		summary = fmt.Sprintf("%s (%s)", summary, strings.Join(changedPaths(changes), ", "))
+	}
+
+	d.actions.mu.Lock()
+	defer d.actions.mu.Unlock()
+	key := obj.GetNamespace() + "/" + owner.Name
+	d.actions.actions[key] = append(d.actions.actions[key], summary)
+}
+
+// deleteFailed returns the error reading the live resource to delete, a
+// resource already gone has nothing to delete.
+func (d *DryRun) deleteFailed(err error) error {
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// GetStatefulSet satisfies StatefulSet interface reading the live statefulSet.
+func (d *DryRun) GetStatefulSet(namespace, name string) (*appsv1.StatefulSet, error) {
+	return d.services.GetStatefulSet(namespace, name)
+}
+
+// ListStatefulSets satisfies StatefulSet interface listing the live statefulSets.
+func (d *DryRun) ListStatefulSets(namespace string) ([]appsv1.StatefulSet, error) {
+	return d.services.ListStatefulSets(namespace)
+}
+
+// DeleteStatefulSet satisfies StatefulSet interface logging the deletion.
+func (d *DryRun) DeleteStatefulSet(namespace, name string) error {
+	statefulSet, err := d.services.GetStatefulSet(namespace, name)
+	if err != nil {
+		return d.deleteFailed(err)
+	}
+	d.record("delete", "statefulSet", statefulSet, nil)
+	return nil
+}
+
+// CreateStatefulSet satisfies StatefulSet interface logging the creation.
+func (d *DryRun) CreateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	statefulSet = statefulSet.DeepCopy()
+	statefulSet.Namespace = namespace
+	d.record("create", "statefulSet", statefulSet, nil)
+	return nil
+}
+
+// UpdateStatefulSet satisfies StatefulSet interface logging the fields that
+// would be updated on the live statefulSet.
+func (d *DryRun) UpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	stored, err := d.services.GetStatefulSet(namespace, statefulSet.Name)
+	if err != nil {
+		return err
+	}
+	d.record("update", "statefulSet", stored, statefulSetDiff(stored, statefulSet))
+	return nil
+}
+
+// CreateOrUpdateStatefulSet satisfies StatefulSet interface logging the
+// changes that StatefulSetService would apply.
+func (d *DryRun) CreateOrUpdateStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	hash, err := objectHash(statefulSet)
+	if err != nil {
+		return err
+	}
+
+	stored, err := d.services.GetStatefulSet(namespace, statefulSet.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return d.CreateStatefulSet(namespace, statefulSet)
+		}
+		return err
+	}
+	if err := checkControlled("statefulSet", stored, statefulSet); err != nil {
+		return err
+	}
+
+	changes := statefulSetDiff(stored, statefulSet)
+	if keepsLegacyTemplate(stored, hash) {
+		// Only the annotations of the statefulSet would be updated.
+		changes = nil
+	}
+	if storedHash := stored.Annotations[LastAppliedHashAnnotation]; storedHash != hash {
+		changes = append(changes, FieldChange{
+			Path:    fmt.Sprintf("metadata.annotations[%s]", LastAppliedHashAnnotation),
+			Stored:  storedHash,
+			Desired: hash,
+		})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	d.record("update", "statefulSet", statefulSet, changes)
+	return nil
+}
+
+// AdoptStatefulSet satisfies StatefulSet interface logging the adoption.
+func (d *DryRun) AdoptStatefulSet(namespace string, statefulSet *appsv1.StatefulSet) error {
+	stored, err := d.services.GetStatefulSet(namespace, statefulSet.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	owner, err := statefulSetAdoptionReference(stored, statefulSet)
+	if err != nil || owner == nil {
+		return err
+	}
+	d.record("adopt", "statefulSet", statefulSet, nil)
+	return nil
+}
+
+// GetService satisfies Service interface reading the live service.
+func (d *DryRun) GetService(namespace, name string) (*corev1.Service, error) {
+	return d.services.GetService(namespace, name)
+}
+
+// CreateService satisfies Service interface logging the creation.
+func (d *DryRun) CreateService(namespace string, service *corev1.Service) error {
+	service = service.DeepCopy()
+	service.Namespace = namespace
+	d.record("create", "service", service, nil)
+	return nil
+}
+
+// UpdateService satisfies Service interface logging the fields that would be
+// updated on the live service.
+func (d *DryRun) UpdateService(namespace string, service *corev1.Service) error {
+	stored, err := d.services.GetService(namespace, service.Name)
+	if err != nil {
+		return err
+	}
+	d.record("update", "service", stored, serviceDiff(stored, service))
+	return nil
+}
+
+// CreateOrUpdateService satisfies Service interface logging the changes that
+// ServiceService would apply.
+func (d *DryRun) CreateOrUpdateService(namespace string, service *corev1.Service) error {
+	stored, err := d.services.GetService(namespace, service.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return d.CreateService(namespace, service)
+		}
+		return err
+	}
+	if err := checkControlled("service", stored, service); err != nil {
+		return err
+	}
+
+	changes := serviceDiff(stored, service)
+	if len(changes) == 0 {
+		return nil
+	}
+	d.record("update", "service", service, changes)
+	return nil
+}
+
+// AdoptService satisfies Service interface logging the adoption.
+func (d *DryRun) AdoptService(namespace string, service *corev1.Service) error {
+	stored, err := d.services.GetService(namespace, service.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	owner, err := adoptionReference("service", stored, service)
+	if err != nil || owner == nil {
+		return err
+	}
+	d.record("adopt", "service", service, nil)
+	return nil
+}
+
+// GetSecret satisfies Secret interface reading the live secret.
+func (d *DryRun) GetSecret(namespace, name string) (*corev1.Secret, error) {
+	return d.services.GetSecret(namespace, name)
+}
+
+// CreateSecret satisfies Secret interface logging the creation, the secret
+// data is never logged.
+func (d *DryRun) CreateSecret(namespace string, secret *corev1.Secret) error {
+	secret = secret.DeepCopy()
+	secret.Namespace = namespace
+	d.record("create", "secret", secret, nil)
+	return nil
+}
+
+// UpdateSecret satisfies Secret interface logging the keys whose value would
+// change, the secret data is never logged.
+func (d *DryRun) UpdateSecret(namespace string, secret *corev1.Secret) error {
+	stored, err := d.services.GetSecret(namespace, secret.Name)
+	if err != nil {
+		return err
+	}
+
+	var changes []FieldChange
+	for _, key := range changedSecretKeys(stored.Data, secret.Data) {
+		changes = append(changes, FieldChange{Path: fmt.Sprintf("data[%s]", key), Stored: "<redacted>", Desired: "<redacted>"})
+	}
+	d.record("update", "secret", stored, changes)
+	return nil
+}
+
+// changedSecretKeys returns the sorted keys with a different value on stored
+// and desired.
+func changedSecretKeys(stored, desired map[string][]byte) []string {
+	var keys []string
+	for key, value := range desired {
+		if storedValue, ok := stored[key]; !ok || !bytes.Equal(storedValue, value) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range stored {
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetConfigMap satisfies ConfigMap interface reading the live configMap.
+func (d *DryRun) GetConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	return d.services.GetConfigMap(namespace, name)
+}
+
+// CreateConfigMap satisfies ConfigMap interface logging the creation.
+func (d *DryRun) CreateConfigMap(namespace string, configMap *corev1.ConfigMap) error {
+	configMap = configMap.DeepCopy()
+	configMap.Namespace = namespace
+	d.record("create", "configMap", configMap, nil)
+	return nil
+}
+
+// UpdateConfigMap satisfies ConfigMap interface logging the update.
+func (d *DryRun) UpdateConfigMap(namespace string, configMap *corev1.ConfigMap) error {
+	configMap = configMap.DeepCopy()
+	configMap.Namespace = namespace
+	d.record("update", "configMap", configMap, nil)
+	return nil
+}
+
+// DeleteConfigMap satisfies ConfigMap interface logging the deletion.
+func (d *DryRun) DeleteConfigMap(namespace, name string) error {
+	configMap, err := d.services.GetConfigMap(namespace, name)
+	if err != nil {
+		return d.deleteFailed(err)
+	}
+	d.record("delete", "configMap", configMap, nil)
+	return nil
+}
+
+// ListJobs satisfies Job interface listing the live jobs.
+func (d *DryRun) ListJobs(namespace string, selector labels.Set) ([]batchv1.Job, error) {
+	return d.services.ListJobs(namespace, selector)
+}
+
+// CreateJob satisfies Job interface logging the creation.
+func (d *DryRun) CreateJob(namespace string, job *batchv1.Job) error {
+	job = job.DeepCopy()
+	job.Namespace = namespace
+	d.record("create", "job", job, nil)
+	return nil
+}
+
+// DeleteJob satisfies Job interface logging the deletion.
+func (d *DryRun) DeleteJob(namespace, name string) error {
+	jobs, err := d.services.ListJobs(namespace, nil)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if jobs[i].Name == name {
+			d.record("delete", "job", &jobs[i], nil)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ExecPod satisfies Pod interface logging the command, it has no output.
+func (d *DryRun) ExecPod(namespace, name, container string, command []string) (string, error) {
+	d.logger.Infof("dry-run: would run %q on pod %s/%s", strings.Join(command, " "), namespace, name)
+	return "", nil
+}
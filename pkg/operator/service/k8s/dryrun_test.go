@@ -0,0 +1,52 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDryRunRecordsDeletes(t *testing.T) {
+	controller := true
+	owner := []metav1.OwnerReference{{Kind: "CassandraCluster", Name: "test", UID: "cluster-uid", Controller: &controller}}
+	statefulSet := desiredStatefulSet("cassandra:3.11")
+	statefulSet.OwnerReferences = owner
+	client := fake.NewSimpleClientset(
+		statefulSet,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cassandra-repair", Namespace: "default", OwnerReferences: owner}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cassandra-upload-0", Namespace: "default", OwnerReferences: owner}},
+	)
+	dryRun := NewDryRun(New(client, nil, testLogger()), testLogger())
+
+	if err := dryRun.DeleteStatefulSet("default", "cassandra"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dryRun.DeleteConfigMap("default", "cassandra-repair"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dryRun.DeleteJob("default", "cassandra-upload-0"); err != nil {
+		t.Fatal(err)
+	}
+	// A resource already gone has nothing to delete.
+	if err := dryRun.DeleteConfigMap("default", "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"delete statefulSet default/cassandra",
+		"delete configMap default/cassandra-repair",
+		"delete job default/cassandra-upload-0",
+	}
+	if summary := dryRun.Summary("default", "test"); !reflect.DeepEqual(summary, want) {
+		t.Errorf("got summary %v, want %v", summary, want)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("dry run deleted %s", action.GetResource().Resource)
+		}
+	}
+}
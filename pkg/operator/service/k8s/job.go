@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Job the Job service that knows how to interact with k8s to manage them
+type Job interface {
+	ListJobs(namespace string, selector labels.Set) ([]batchv1.Job, error)
+	CreateJob(namespace string, job *batchv1.Job) error
+	// DeleteJob deletes the job along with its pods.
+	DeleteJob(namespace, name string) error
+}
+
+// JobService is the job service implementation using API calls to kubernetes.
+type JobService struct {
+	kubeClient kubernetes.Interface
+	logger     log.Logger
+}
+
+// NewJobService returns a new Job KubeService.
+func NewJobService(kubeClient kubernetes.Interface, logger log.Logger) *JobService {
+	return &JobService{
+		kubeClient: kubeClient,
+		logger:     logger,
+	}
+}
+
+// WithLogger returns a copy of the service logging with logger.
+func (j *JobService) WithLogger(logger log.Logger) *JobService {
+	return NewJobService(j.kubeClient, logger)
+}
+
+func (j *JobService) ListJobs(namespace string, selector labels.Set) ([]batchv1.Job, error) {
+	jobs, err := j.kubeClient.BatchV1().Jobs(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return jobs.Items, nil
+}
+
+func (j *JobService) CreateJob(namespace string, job *batchv1.Job) error {
+	_, err := j.kubeClient.BatchV1().Jobs(namespace).Create(job)
+	if err != nil {
+		return err
+	}
+	j.logger.Infof("job %s/%s created", namespace, job.Name)
+	return nil
+}
+
+func (j *JobService) DeleteJob(namespace, name string) error {
+	// The pods of a job are orphaned unless the deletion is propagated.
+	propagation := metav1.DeletePropagationBackground
+	err := j.kubeClient.BatchV1().Jobs(namespace).Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		return err
+	}
+	j.logger.Infof("job %s/%s deleted", namespace, name)
+	return nil
+}
@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceConflictError is returned when a resource already exists and is not
+// controlled by the controller of the desired resource.
+type ResourceConflictError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Owner     string
+}
+
+func (e *ResourceConflictError) Error() string {
+	return fmt.Sprintf("%s %s/%s already exists and is not controlled by %s", e.Kind, e.Namespace, e.Name, e.Owner)
+}
+
+// IsResourceConflict returns true if the error is a ResourceConflictError.
+func IsResourceConflict(err error) bool {
+	_, ok := err.(*ResourceConflictError)
+	return ok
+}
+
+// checkControlled returns a ResourceConflictError when the stored resource is
+// not controlled by the controller of the desired one.
+func checkControlled(kind string, stored, desired metav1.Object) error {
+	owner := metav1.GetControllerOf(desired)
+	if owner == nil {
+		return nil
+	}
+	controller := metav1.GetControllerOf(stored)
+	if controller != nil && controller.UID == owner.UID {
+		return nil
+	}
+	return &ResourceConflictError{
+		Kind:      kind,
+		Namespace: stored.GetNamespace(),
+		Name:      stored.GetName(),
+		Owner:     owner.Kind + " " + owner.Name,
+	}
+}
+
+// adoptionReference returns the controller reference to add to the stored
+// resource so it's controlled by the controller of the desired one. It's nil
+// when the stored resource is already controlled by it, and a
+// ResourceConflictError when it's controlled by another controller.
+func adoptionReference(kind string, stored, desired metav1.Object) (*metav1.OwnerReference, error) {
+	owner := metav1.GetControllerOf(desired)
+	if owner == nil || metav1.GetControllerOf(stored) != nil {
+		return nil, checkControlled(kind, stored, desired)
+	}
+	return owner, nil
+}
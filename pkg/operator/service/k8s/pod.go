@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Pod the Pod service that knows how to interact with k8s to run commands
+// in the cassandra nodes.
+type Pod interface {
+	// ExecPod runs the command in the container of the pod and returns its
+	// standard output.
+	ExecPod(namespace, name, container string, command []string) (string, error)
+}
+
+// PodService is the pod service implementation using API calls to kubernetes.
+type PodService struct {
+	kubeClient kubernetes.Interface
+	restConfig *rest.Config
+	logger     log.Logger
+}
+
+// NewPodService returns a new Pod KubeService.
+func NewPodService(kubeClient kubernetes.Interface, restConfig *rest.Config, logger log.Logger) *PodService {
+	return &PodService{
+		kubeClient: kubeClient,
+		restConfig: restConfig,
+		logger:     logger,
+	}
+}
+
+// WithLogger returns a copy of the service logging with logger.
+func (p *PodService) WithLogger(logger log.Logger) *PodService {
+	return NewPodService(p.kubeClient, p.restConfig, logger)
+}
+
+func (p *PodService) ExecPod(namespace, name, container string, command []string) (string, error) {
+	req := p.kubeClient.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(p.restConfig, "POST", req.URL())
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	p.logger.Debugf("running %q on pod %s/%s", strings.Join(command, " "), namespace, name)
+	if err := exec.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return "", fmt.Errorf("%q failed on pod %s/%s: %s: %s", strings.Join(command, " "), namespace, name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Secret the Secret service that knows how to interact with k8s to manage them.
+// The credential secrets are never updated, the credentials they hold could
+// be lost. Only the certificate secrets the operator renews are updated.
+type Secret interface {
+	GetSecret(namespace, name string) (*corev1.Secret, error)
+	CreateSecret(namespace string, secret *corev1.Secret) error
+	UpdateSecret(namespace string, secret *corev1.Secret) error
+}
+
+// SecretService is the secret service implementation using API calls to kubernetes.
+type SecretService struct {
+	kubeClient kubernetes.Interface
+	logger     log.Logger
+}
+
+// NewSecretService returns a new Secret KubeService.
+func NewSecretService(kubeClient kubernetes.Interface, logger log.Logger) *SecretService {
+	return &SecretService{
+		kubeClient: kubeClient,
+		logger:     logger,
+	}
+}
+
+// WithLogger returns a copy of the service logging with logger.
+func (s *SecretService) WithLogger(logger log.Logger) *SecretService {
+	return NewSecretService(s.kubeClient, logger)
+}
+
+func (s *SecretService) GetSecret(namespace, name string) (*corev1.Secret, error) {
+	secret, err := s.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret, err
+}
+
+func (s *SecretService) CreateSecret(namespace string, secret *corev1.Secret) error {
+	_, err := s.kubeClient.CoreV1().Secrets(namespace).Create(secret)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("secret %s/%s created", namespace, secret.Name)
+	return nil
+}
+
+func (s *SecretService) UpdateSecret(namespace string, secret *corev1.Secret) error {
+	_, err := s.kubeClient.CoreV1().Secrets(namespace).Update(secret)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("secret %s/%s updated", namespace, secret.Name)
+	return nil
+}
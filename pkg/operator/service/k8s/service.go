@@ -0,0 +1,142 @@
+package k8s
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Service the Service service that knows how to interact with k8s to manage them
+type Service interface {
+	GetService(namespace, name string) (*corev1.Service, error)
+	CreateService(namespace string, service *corev1.Service) error
+	UpdateService(namespace string, service *corev1.Service) error
+	CreateOrUpdateService(namespace string, service *corev1.Service) error
+	AdoptService(namespace string, service *corev1.Service) error
+}
+
+// ServiceService is the service service implementation using API calls to kubernetes.
+type ServiceService struct {
+	kubeClient kubernetes.Interface
+	logger     log.Logger
+}
+
+// NewServiceService returns a new Service KubeService.
+func NewServiceService(kubeClient kubernetes.Interface, logger log.Logger) *ServiceService {
+	return &ServiceService{
+		kubeClient: kubeClient,
+		logger:     logger,
+	}
+}
+
+// WithLogger returns a copy of the service logging with logger.
+func (s *ServiceService) WithLogger(logger log.Logger) *ServiceService {
+	return NewServiceService(s.kubeClient, logger)
+}
+
+func (s *ServiceService) GetService(namespace, name string) (*corev1.Service, error) {
+	service, err := s.kubeClient.CoreV1().Services(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return service, err
+}
+
+func (s *ServiceService) CreateService(namespace string, service *corev1.Service) error {
+	_, err := s.kubeClient.CoreV1().Services(namespace).Create(service)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("service %s/%s created", namespace, service.Name)
+	return nil
+}
+
+func (s *ServiceService) UpdateService(namespace string, service *corev1.Service) error {
+	_, err := s.kubeClient.CoreV1().Services(namespace).Update(service)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("service %s/%s updated", namespace, service.Name)
+	return nil
+}
+
+// CreateOrUpdateService creates the service or updates the fields owned by
+// the operator when they differ from the stored ones. A stored service not
+// controlled by the controller of the desired one is never updated, a
+// ResourceConflictError is returned instead.
+func (s *ServiceService) CreateOrUpdateService(namespace string, service *corev1.Service) error {
+	storedService, err := s.GetService(namespace, service.Name)
+	if err != nil {
+		// If no resource we need to create.
+		if errors.IsNotFound(err) {
+			return s.CreateService(namespace, service)
+		}
+		return err
+	}
+	if err := checkControlled("service", storedService, service); err != nil {
+		return err
+	}
+
+	diff := serviceDiff(storedService, service)
+	if len(diff) == 0 {
+		return nil
+	}
+	s.logger.Infof("service %s/%s differs on: %s", namespace, service.Name, strings.Join(changedPaths(diff), ", "))
+
+	// The cluster IP is immutable, only the fields owned by the operator are
+	// replaced on the stored service.
+	updated := storedService.DeepCopy()
+	for key, value := range service.Labels {
+		setLabel(&updated.ObjectMeta, key, value)
+	}
+	for key, value := range service.Annotations {
+		setAnnotation(&updated.ObjectMeta, key, value)
+	}
+	updated.OwnerReferences = service.OwnerReferences
+	updated.Spec.Ports = service.Spec.Ports
+	updated.Spec.Selector = service.Spec.Selector
+	return s.UpdateService(namespace, updated)
+}
+
+// AdoptService sets the controller of the desired service on the stored one
+// when it has no controller, so it can be updated afterwards.
+func (s *ServiceService) AdoptService(namespace string, service *corev1.Service) error {
+	storedService, err := s.GetService(namespace, service.Name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	owner, err := adoptionReference("service", storedService, service)
+	if err != nil || owner == nil {
+		return err
+	}
+
+	adopted := storedService.DeepCopy()
+	adopted.OwnerReferences = append(adopted.OwnerReferences, *owner)
+	if err := s.UpdateService(namespace, adopted); err != nil {
+		return err
+	}
+	s.logger.Infof("service %s/%s adopted by %s %s", namespace, service.Name, owner.Kind, owner.Name)
+	return nil
+}
+
+// serviceDiff returns the fields owned by the operator that differ between
+// the stored and the desired service.
+func serviceDiff(stored, desired *corev1.Service) []FieldChange {
+	var diff []FieldChange
+	diff = append(diff, derivativeChanges("metadata.labels", reflect.ValueOf(desired.Labels), reflect.ValueOf(stored.Labels))...)
+	diff = append(diff, derivativeChanges("metadata.annotations", reflect.ValueOf(desired.Annotations), reflect.ValueOf(stored.Annotations))...)
+	diff = append(diff, derivativeChanges("metadata.ownerReferences", reflect.ValueOf(desired.OwnerReferences), reflect.ValueOf(stored.OwnerReferences))...)
+	diff = append(diff, derivativeChanges("spec.ports", reflect.ValueOf(desired.Spec.Ports), reflect.ValueOf(stored.Spec.Ports))...)
+	diff = append(diff, derivativeChanges("spec.selector", reflect.ValueOf(desired.Spec.Selector), reflect.ValueOf(stored.Spec.Selector))...)
+	return diff
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
+)
+
+const (
+	// networkTopologyStrategy replicates a keyspace per datacenter.
+	networkTopologyStrategy = "NetworkTopologyStrategy"
+	// simpleStrategy replicates a keyspace ignoring the datacenters.
+	simpleStrategy = "SimpleStrategy"
+	// replicationFactorOption is the replication option of simpleStrategy.
+	replicationFactorOption = "replication_factor"
+)
+
+// InvalidReplicationError is returned when the replication of a keyspace
+// can't be applied to the current nodes of the cluster.
+type InvalidReplicationError struct {
+	msg string
+}
+
+func (e *InvalidReplicationError) Error() string {
+	return e.msg
+}
+
+// IsInvalidReplication returns whether err is an InvalidReplicationError.
+func IsInvalidReplication(err error) bool {
+	_, ok := err.(*InvalidReplicationError)
+	return ok
+}
+
+// KeyspaceName returns the name in cassandra of the keyspace.
+func KeyspaceName(keyspace *cassandrav1alpha1.CassandraKeyspace) string {
+	if keyspace.Spec.KeyspaceName != "" {
+		return keyspace.Spec.KeyspaceName
+	}
+	return keyspace.Name
+}
+
+// ValidateKeyspace returns an error describing the invalid replication of
+// the keyspace.
+func ValidateKeyspace(keyspace *cassandrav1alpha1.CassandraKeyspace) error {
+	_, err := keyspaceReplication(keyspace.Spec.Replication)
+	return err
+}
+
+// keyspaceReplication returns the replication options of the spec.
+func keyspaceReplication(spec cassandrav1alpha1.ReplicationSpec) (map[string]string, error) {
+	switch spec.Strategy {
+	case "", networkTopologyStrategy:
+		if spec.ReplicationFactor != nil {
+			return nil, fmt.Errorf("%s replicates per datacenter, it has no replication factor", networkTopologyStrategy)
+		}
+		if len(spec.Datacenters) == 0 {
+			return nil, fmt.Errorf("%s requires the replication factor of at least one datacenter", networkTopologyStrategy)
+		}
+		replication := map[string]string{"class": networkTopologyStrategy}
+		for datacenter, factor := range spec.Datacenters {
+			if factor < 0 {
+				return nil, fmt.Errorf("replication factor of datacenter %s can't be negative", datacenter)
+			}
+			replication[datacenter] = strconv.Itoa(int(factor))
+		}
+		return replication, nil
+	case simpleStrategy:
+		if len(spec.Datacenters) > 0 {
+			return nil, fmt.Errorf("%s ignores the datacenters, it has a single replication factor", simpleStrategy)
+		}
+		if spec.ReplicationFactor == nil || *spec.ReplicationFactor < 1 {
+			return nil, fmt.Errorf("%s requires a positive replication factor", simpleStrategy)
+		}
+		return map[string]string{
+			"class":                 simpleStrategy,
+			replicationFactorOption: strconv.Itoa(int(*spec.ReplicationFactor)),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown replication strategy %q, valid strategies are %s and %s", spec.Strategy, networkTopologyStrategy, simpleStrategy)
+}
+
+// KeyspaceReplicationIncreased returns whether the replication of the spec
+// increases the replication factor of the existing keyspace, so its nodes must
+// repair it to hold the replicas they'd be responsible for. The replication is
+// refused when a datacenter has less nodes than its replication factor.
+func (r *CassandraClusterKubeClient) KeyspaceReplicationIncreased(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace) (bool, error) {
+	_, desired, current, err := r.keyspaceReplications(cc, keyspace)
+	if err != nil || current == nil {
+		return false, err
+	}
+	return !replicationEqual(current, desired) && replicationIncreased(current, desired), nil
+}
+
+// EnsureKeyspace makes sure the keyspace exists on the cluster with the
+// replication of its spec. The replication is refused when a datacenter has
+// less nodes than its replication factor.
+func (r *CassandraClusterKubeClient) EnsureKeyspace(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace) error {
+	session, desired, current, err := r.keyspaceReplications(cc, keyspace)
+	if err != nil {
+		return err
+	}
+
+	name := KeyspaceName(keyspace)
+	if current == nil {
+		return r.execute(session, fmt.Sprintf("create keyspace %s with replication %s", name, cqlMap(desired)),
+			fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = %s", cqlIdentifier(name), cqlMap(desired)))
+	}
+	if replicationEqual(current, desired) {
+		return nil
+	}
+	return r.execute(session, fmt.Sprintf("alter keyspace %s replication to %s", name, cqlMap(desired)),
+		fmt.Sprintf("ALTER KEYSPACE %s WITH replication = %s", cqlIdentifier(name), cqlMap(desired)))
+}
+
+// keyspaceReplications returns a session of the cluster with the desired
+// replication of the keyspace and its current one, nil when the keyspace
+// doesn't exist. An InvalidReplicationError is returned when the nodes of the
+// cluster can't hold the desired replication.
+func (r *CassandraClusterKubeClient) keyspaceReplications(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace) (cql.Session, map[string]string, map[string]string, error) {
+	desired, err := keyspaceReplication(keyspace.Spec.Replication)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	nodes, err := datacenterNodes(session)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkReplicationFactors(desired, nodes); err != nil {
+		return nil, nil, nil, err
+	}
+
+	var current map[string]string
+	err = session.Query("SELECT replication FROM system_schema.keyspaces WHERE keyspace_name = ?", KeyspaceName(keyspace)).Scan(&current)
+	if err == cql.ErrNotFound {
+		return session, desired, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return session, desired, current, nil
+}
+
+// datacenterNodes returns the number of nodes per datacenter of the cluster.
+func datacenterNodes(session cql.Session) (map[string]int, error) {
+	nodes := map[string]int{}
+	var datacenter string
+	if err := session.Query("SELECT data_center FROM system.local").Scan(&datacenter); err != nil {
+		return nil, err
+	}
+	nodes[datacenter]++
+
+	iter := session.Query("SELECT data_center FROM system.peers").Iter()
+	for iter.Scan(&datacenter) {
+		nodes[datacenter]++
+	}
+	return nodes, iter.Close()
+}
+
+// checkReplicationFactors returns an InvalidReplicationError when the
+// replication factor of a datacenter, or the whole cluster with
+// SimpleStrategy, is greater than its number of nodes.
+func checkReplicationFactors(replication map[string]string, nodes map[string]int) error {
+	var errs []string
+	for option, value := range replication {
+		if option == "class" {
+			continue
+		}
+		factor, _ := strconv.Atoi(value)
+
+		available, location := 0, "datacenter "+option
+		if option == replicationFactorOption {
+			location = "the cluster"
+			for _, n := range nodes {
+				available += n
+			}
+		} else {
+			available = nodes[option]
+		}
+		if factor > available {
+			errs = append(errs, fmt.Sprintf("replication factor %d is greater than the %d nodes of %s", factor, available, location))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return &InvalidReplicationError{msg: strings.Join(errs, "; ")}
+}
+
+// replicationIncreased returns whether a datacenter, or the cluster with
+// SimpleStrategy, has a greater replication factor on desired than on current.
+// A change of strategy moves the replicas, it's handled as an increase.
+func replicationIncreased(current, desired map[string]string) bool {
+	if strategyName(current["class"]) != strategyName(desired["class"]) {
+		return true
+	}
+	for option, value := range desired {
+		if option == "class" {
+			continue
+		}
+		factor, _ := strconv.Atoi(value)
+		currentFactor, _ := strconv.Atoi(current[option])
+		if factor > currentFactor {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterPods returns the names of the pods of the cluster statefulsets.
+func (r *CassandraClusterKubeClient) ClusterPods(cc *cassandrav1alpha1.CassandraCluster) ([]string, error) {
+	statefulSets, err := r.GetStatefulSets(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	var pods []string
+	for _, ss := range statefulSets {
+		replicas := int32(1)
+		if ss.Spec.Replicas != nil {
+			replicas = *ss.Spec.Replicas
+		}
+		for i := int32(0); i < replicas; i++ {
+			pods = append(pods, fmt.Sprintf("%s-%d", ss.Name, i))
+		}
+	}
+	return pods, nil
+}
+
+// RepairKeyspace runs a full repair of the keyspace on the node of pod.
+func (r *CassandraClusterKubeClient) RepairKeyspace(cc *cassandrav1alpha1.CassandraCluster, keyspace *cassandrav1alpha1.CassandraKeyspace, pod string) error {
+	name := KeyspaceName(keyspace)
+	command, err := r.nodetoolCommand(cc, "repair", "-full", name)
+	if err != nil {
+		return err
+	}
+	if _, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command); err != nil {
+		return err
+	}
+	if r.config.DryRun {
+		return nil
+	}
+	r.logger.Infof("keyspace %s repaired on pod %s/%s", name, cc.Namespace, pod)
+	return nil
+}
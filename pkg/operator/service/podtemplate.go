@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const cassandraContainerName = "cassandra"
+
+// applyPodTemplate strategically merges the pod template overrides of the
+// cluster on top of the generated pod template.
+func applyPodTemplate(cc *cassandrav1alpha1.CassandraCluster, template corev1.PodTemplateSpec) (corev1.PodTemplateSpec, error) {
+	if cc.Spec.PodTemplate == nil {
+		return template, nil
+	}
+
+	original, err := json.Marshal(template)
+	if err != nil {
+		return template, err
+	}
+	patch, err := podTemplatePatch(cc.Spec.PodTemplate)
+	if err != nil {
+		return template, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodTemplateSpec{})
+	if err != nil {
+		return template, fmt.Errorf("could not merge the pod template overrides: %s", err)
+	}
+
+	result := corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return template, err
+	}
+	if err := validatePodTemplate(template, result); err != nil {
+		return template, fmt.Errorf("pod template overrides refused: %s", err)
+	}
+	return result, nil
+}
+
+// podTemplatePatch returns the overrides as a patch. The typed template
+// serializes the unset fields without omitempty as null, which would delete
+// them in a strategic merge, so all the nulls are removed.
+func podTemplatePatch(override *corev1.PodTemplateSpec) ([]byte, error) {
+	raw, err := json.Marshal(override)
+	if err != nil {
+		return nil, err
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, err
+	}
+	return json.Marshal(removeNulls(patch))
+}
+
+func removeNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if field == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = removeNulls(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = removeNulls(item)
+		}
+	}
+	return value
+}
+
+// validatePodTemplate checks the merged template keeps the invariants the
+// operator relies on: the cassandra container, its ports and the labels
+// used by the statefulset selector.
+func validatePodTemplate(generated, merged corev1.PodTemplateSpec) error {
+	for key, value := range generated.Labels {
+		if merged.Labels[key] != value {
+			return fmt.Errorf("label %q is used by the statefulset selector and can't be changed", key)
+		}
+	}
+
+	want := findContainer(generated.Spec.Containers, cassandraContainerName)
+	got := findContainer(merged.Spec.Containers, cassandraContainerName)
+	if got == nil {
+		return fmt.Errorf("container %q can't be removed or renamed", cassandraContainerName)
+	}
+	if !equality.Semantic.DeepEqual(want.Ports, got.Ports) {
+		return fmt.Errorf("ports of container %q can't be changed", cassandraContainerName)
+	}
+	return nil
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
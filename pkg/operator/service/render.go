@@ -0,0 +1,39 @@
+package service
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+// GenerateResources returns the kubernetes resources ensured for the cluster,
+// generated the same way as in the reconciliation but without reading the
+// state of any kubernetes cluster. The resources have their kind set so they
+// can be serialized as manifests.
+func GenerateResources(cc *cassandrav1alpha1.CassandraCluster, config Config) ([]runtime.Object, error) {
+	r := &CassandraClusterKubeClient{config: config}
+	cc = r.EffectiveCluster(cc)
+
+	var objs []runtime.Object
+	for _, svc := range r.generateCassandraServices(cc) {
+		objs = append(objs, svc)
+	}
+	// The certificates were never renewed, they're not read.
+	statefulSets, err := r.generateCassandraStatefulSets(cc, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, ss := range statefulSets {
+		objs = append(objs, ss)
+	}
+
+	for _, obj := range objs {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, err
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	}
+	return objs, nil
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	// RepairProgressKey is the key of the repair ConfigMap of a cluster with
+	// the progress of its repairs.
+	RepairProgressKey = "progress.json"
+
+	defaultRepairParallelism = 1
+)
+
+// RepairProgress is the progress of the scheduled repairs of a cluster. It's
+// kept on the repair ConfigMap of the cluster, so the runs resume where they
+// were after a restart of the operator.
+type RepairProgress struct {
+	// Since is when the repairs were scheduled, the keyspaces never
+	// repaired are overdue from then.
+	Since metav1.Time `json:"since"`
+	// LastRunStart is when the last run started, the next one is scheduled
+	// after it.
+	LastRunStart *metav1.Time `json:"lastRunStart,omitempty"`
+	// Repaired is the start of the last run that repaired every range of
+	// each keyspace.
+	Repaired map[string]metav1.Time `json:"repaired,omitempty"`
+	// Run is the run in progress.
+	Run *RepairRun `json:"run,omitempty"`
+}
+
+// RepairRun is a run repairing the keyspaces node by node.
+type RepairRun struct {
+	Start     metav1.Time `json:"start"`
+	Keyspaces []string    `json:"keyspaces"`
+	Pods      []string    `json:"pods"`
+	// Pod, Keyspace and Range are the indexes of the pod being repaired, of
+	// its keyspace and of the next range of the keyspace.
+	Pod      int `json:"pod"`
+	Keyspace int `json:"keyspace"`
+	Range    int `json:"range"`
+	// Ranges of the pod being repaired, nil until they're read.
+	Ranges []TokenRange `json:"ranges"`
+	// NextBatch is when the next ranges are repaired, after the pause of the
+	// intensity.
+	NextBatch *metav1.Time `json:"nextBatch,omitempty"`
+}
+
+// TokenRange is the range of tokens after Start up to End. The empty range
+// is the primary range of the node.
+type TokenRange struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Done returns whether the run repaired every keyspace on every pod.
+func (run *RepairRun) Done() bool {
+	return run.Pod >= len(run.Pods) || len(run.Keyspaces) == 0
+}
+
+// Batch returns up to parallelism ranges of the keyspace being repaired,
+// starting with the next one.
+func (run *RepairRun) Batch(parallelism int) []TokenRange {
+	end := run.Range + parallelism
+	if end > len(run.Ranges) {
+		end = len(run.Ranges)
+	}
+	return run.Ranges[run.Range:end]
+}
+
+// Advance moves the run n ranges forward, to the next keyspace once every
+// range of the keyspace is repaired and to the next pod once every keyspace
+// is repaired.
+func (run *RepairRun) Advance(n int) {
+	run.Range += n
+	for !run.Done() && run.Ranges != nil && run.Range >= len(run.Ranges) {
+		run.Range = 0
+		run.Keyspace++
+		if run.Keyspace >= len(run.Keyspaces) {
+			run.Keyspace = 0
+			run.Pod++
+			run.Ranges = nil
+		}
+	}
+}
+
+// ValidateRepair returns an error describing the invalid repair spec.
+func ValidateRepair(spec *cassandrav1alpha1.RepairSpec) error {
+	if _, err := cron.ParseStandard(spec.Schedule); err != nil {
+		return fmt.Errorf("invalid repair schedule %q: %s", spec.Schedule, err)
+	}
+	if spec.Parallelism < 0 {
+		return fmt.Errorf("repair parallelism can't be negative")
+	}
+	if spec.Intensity != "" {
+		intensity, err := strconv.ParseFloat(spec.Intensity, 64)
+		if err != nil || intensity <= 0 || intensity > 1 {
+			return fmt.Errorf("invalid repair intensity %q, it must be greater than 0 and up to 1", spec.Intensity)
+		}
+	}
+	return nil
+}
+
+// NextRepairTime returns when the next run is due, after the last one started
+// or since the repairs were scheduled. The spec must be valid.
+func NextRepairTime(spec *cassandrav1alpha1.RepairSpec, progress *RepairProgress) time.Time {
+	schedule, err := cron.ParseStandard(spec.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+	if progress.LastRunStart == nil {
+		return schedule.Next(progress.Since.Time)
+	}
+	return schedule.Next(progress.LastRunStart.Time)
+}
+
+// RepairParallelism returns the number of ranges repaired at the same time.
+func RepairParallelism(spec *cassandrav1alpha1.RepairSpec) int {
+	if spec.Parallelism == 0 {
+		return defaultRepairParallelism
+	}
+	return int(spec.Parallelism)
+}
+
+// RepairPause returns the pause after ranges repaired in elapsed, so the
+// time spent repairing is the intensity of the spec. The spec must be valid.
+func RepairPause(spec *cassandrav1alpha1.RepairSpec, elapsed time.Duration) time.Duration {
+	if spec.Intensity == "" {
+		return 0
+	}
+	intensity, err := strconv.ParseFloat(spec.Intensity, 64)
+	if err != nil || intensity <= 0 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * (1 - intensity) / intensity)
+}
+
+// OverdueKeyspaces returns the sorted keyspaces whose last full repair is
+// older than their gc grace, or that were never repaired within it since the
+// repairs were scheduled.
+func OverdueKeyspaces(progress *RepairProgress, gcGrace map[string]time.Duration, now time.Time) []string {
+	var overdue []string
+	for keyspace, grace := range gcGrace {
+		repaired, ok := progress.Repaired[keyspace]
+		if !ok {
+			repaired = progress.Since
+		}
+		if now.Sub(repaired.Time) > grace {
+			overdue = append(overdue, keyspace)
+		}
+	}
+	sort.Strings(overdue)
+	return overdue
+}
+
+// RepairProgressName returns the name of the ConfigMap with the progress of
+// the repairs of the cluster.
+func RepairProgressName(cc *cassandrav1alpha1.CassandraCluster) string {
+	return cc.Spec.StatefulSetName + "-repair"
+}
+
+// RepairProgress returns the progress of the repairs of the cluster, a new one
+// scheduled from now when the cluster has no repair ConfigMap yet.
+func (r *CassandraClusterKubeClient) RepairProgress(cc *cassandrav1alpha1.CassandraCluster) (*RepairProgress, error) {
+	configMap, err := r.K8SService.GetConfigMap(cc.Namespace, RepairProgressName(cc))
+	if errors.IsNotFound(err) {
+		return &RepairProgress{Since: metav1.Now()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &RepairProgress{}
+	if err := json.Unmarshal([]byte(configMap.Data[RepairProgressKey]), progress); err != nil {
+		return nil, fmt.Errorf("invalid repair progress on configMap %s/%s: %s", cc.Namespace, configMap.Name, err)
+	}
+	return progress, nil
+}
+
+// SaveRepairProgress records the progress on the repair ConfigMap of the
+// cluster when it changed, the ConfigMap is garbage collected along with the
+// cluster.
+func (r *CassandraClusterKubeClient) SaveRepairProgress(cc *cassandrav1alpha1.CassandraCluster, progress *RepairProgress) error {
+	raw, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	name := RepairProgressName(cc)
+	stored, err := r.K8SService.GetConfigMap(cc.Namespace, name)
+	switch {
+	case errors.IsNotFound(err):
+		return r.K8SService.CreateConfigMap(cc.Namespace, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cc.Namespace,
+				Labels:    clusterLabels(cc),
+				OwnerReferences: []metav1.OwnerReference{
+					clusterOwnerReference(cc),
+				},
+			},
+			Data: map[string]string{RepairProgressKey: string(raw)},
+		})
+	case err != nil:
+		return err
+	case stored.Data[RepairProgressKey] == string(raw):
+		return nil
+	}
+
+	configMap := stored.DeepCopy()
+	configMap.Data = map[string]string{RepairProgressKey: string(raw)}
+	return r.K8SService.UpdateConfigMap(cc.Namespace, configMap)
+}
+
+// StartRepair returns a run starting at start that repairs the keyspaces of
+// the spec on every pod of the cluster.
+func (r *CassandraClusterKubeClient) StartRepair(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec, start time.Time) (*RepairRun, error) {
+	keyspaces, err := r.RepairKeyspaces(cc, spec)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return nil, err
+	}
+	return &RepairRun{
+		Start:     metav1.NewTime(start),
+		Keyspaces: keyspaces,
+		Pods:      pods,
+	}, nil
+}
+
+// RepairKeyspaces returns the sorted keyspaces of the cluster repaired by the
+// spec. The local keyspaces, like system and system_schema, have nothing to
+// repair.
+func (r *CassandraClusterKubeClient) RepairKeyspaces(cc *cassandrav1alpha1.CassandraCluster, spec *cassandrav1alpha1.RepairSpec) ([]string, error) {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	included := stringSet(spec.Keyspaces)
+	excluded := stringSet(spec.ExcludedKeyspaces)
+	var (
+		keyspaces   []string
+		keyspace    string
+		replication map[string]string
+	)
+	iter := session.Query("SELECT keyspace_name, replication FROM system_schema.keyspaces").Iter()
+	for iter.Scan(&keyspace, &replication) {
+		if strategyName(replication["class"]) == "LocalStrategy" || excluded[keyspace] {
+			continue
+		}
+		if len(included) > 0 && !included[keyspace] {
+			continue
+		}
+		keyspaces = append(keyspaces, keyspace)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("could not list the keyspaces: %s", err)
+	}
+	sort.Strings(keyspaces)
+	return keyspaces, nil
+}
+
+// stringSet returns the set of the values.
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// NodeRanges returns the ranges repaired on the node of pod. The incremental
+// repairs take the primary range of the node at once, the full ones the
+// ranges ending at each token of the node, read from the nodes of pods.
+func (r *CassandraClusterKubeClient) NodeRanges(cc *cassandrav1alpha1.CassandraCluster, pods []string, pod string, incremental bool) ([]TokenRange, error) {
+	if incremental {
+		return []TokenRange{{}}, nil
+	}
+
+	command, err := r.nodetoolCommand(cc, "info", "-T")
+	if err != nil {
+		return nil, err
+	}
+	var ring, owned []string
+	for _, p := range pods {
+		info, err := r.K8SService.ExecPod(cc.Namespace, p, cassandraContainerName, command)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the tokens of pod %s/%s: %s", cc.Namespace, p, err)
+		}
+		tokens := parseTokens(info)
+		ring = append(ring, tokens...)
+		if p == pod {
+			owned = tokens
+		}
+	}
+	return primaryRanges(ring, owned)
+}
+
+// primaryRanges returns the ranges of the ring ending at the owned tokens,
+// starting at the previous token of the ring.
+func primaryRanges(ring, owned []string) ([]TokenRange, error) {
+	values := make(map[string]*big.Int, len(ring))
+	for _, token := range ring {
+		value, ok := new(big.Int).SetString(token, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid token %q", token)
+		}
+		values[token] = value
+	}
+	sorted := append([]string(nil), ring...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return values[sorted[i]].Cmp(values[sorted[j]]) < 0
+	})
+	previous := make(map[string]string, len(sorted))
+	for i, token := range sorted {
+		previous[token] = sorted[(i+len(sorted)-1)%len(sorted)]
+	}
+
+	ranges := make([]TokenRange, 0, len(owned))
+	for _, token := range owned {
+		ranges = append(ranges, TokenRange{Start: previous[token], End: token})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return values[ranges[i].End].Cmp(values[ranges[j].End]) < 0
+	})
+	return ranges, nil
+}
+
+// RepairRange repairs the range of the keyspace on the node of pod, a full
+// repair unless incremental.
+func (r *CassandraClusterKubeClient) RepairRange(cc *cassandrav1alpha1.CassandraCluster, pod, keyspace string, tokens TokenRange, incremental bool) error {
+	args := []string{"repair", "-pr"}
+	if tokens != (TokenRange{}) {
+		args = []string{"repair", "-st", tokens.Start, "-et", tokens.End}
+	}
+	if !incremental {
+		args = append(args, "-full")
+	}
+	command, err := r.nodetoolCommand(cc, append(args, keyspace)...)
+	if err != nil {
+		return err
+	}
+	if _, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command); err != nil {
+		return err
+	}
+	if r.config.DryRun {
+		return nil
+	}
+	r.logger.Infof("keyspace %s repaired on pod %s/%s, range (%s, %s]", keyspace, cc.Namespace, pod, tokens.Start, tokens.End)
+	return nil
+}
+
+// KeyspacesGCGrace returns the gc grace of the keyspaces, the shortest
+// gc_grace_seconds of their tables. The keyspaces without tables are left
+// out, they have no deletes to lose.
+func (r *CassandraClusterKubeClient) KeyspacesGCGrace(cc *cassandrav1alpha1.CassandraCluster, keyspaces []string) (map[string]time.Duration, error) {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	gcGrace := map[string]time.Duration{}
+	for _, keyspace := range keyspaces {
+		var seconds int
+		iter := session.Query("SELECT gc_grace_seconds FROM system_schema.tables WHERE keyspace_name = ?", keyspace).Iter()
+		for iter.Scan(&seconds) {
+			grace := time.Duration(seconds) * time.Second
+			if current, ok := gcGrace[keyspace]; !ok || grace < current {
+				gcGrace[keyspace] = grace
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, fmt.Errorf("could not read the gc grace of keyspace %s: %s", keyspace, err)
+		}
+	}
+	return gcGrace, nil
+}
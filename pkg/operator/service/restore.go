@@ -0,0 +1,569 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	// RestoreAnnotation is set on a CassandraCluster with the name of the
+	// CassandraRestore restoring it. Its clients can't reach it meanwhile,
+	// the headless service they connect to selects no pod.
+	RestoreAnnotation = "cassandra.databases.camilocot/restore"
+
+	// initialTokensPath is where the initial tokens ConfigMap is mounted on
+	// the nodes and restoreFilesPath where the files ConfigMap of a restore
+	// is mounted on its download jobs.
+	initialTokensPath       = "/etc/cassandra/tokens"
+	initialTokensVolumeName = "initial-tokens"
+	restoreFilesPath        = "/restore"
+)
+
+// TokensMismatchError is returned when the nodes of a cluster don't hold the
+// tokens of the backed up nodes restored on them.
+type TokensMismatchError struct {
+	msg string
+}
+
+func (e *TokensMismatchError) Error() string {
+	return e.msg
+}
+
+// IsTokensMismatch returns whether err is a TokensMismatchError.
+func IsTokensMismatch(err error) bool {
+	_, ok := err.(*TokensMismatchError)
+	return ok
+}
+
+// RestoreKeyspaces returns the keyspaces restored from the backup.
+func RestoreKeyspaces(restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) []string {
+	if len(restore.Spec.Keyspaces) > 0 {
+		return restore.Spec.Keyspaces
+	}
+	return backupKeyspaces(manifest)
+}
+
+// ValidateRestore returns an error describing why the backup of the manifest
+// can't be restored on the pods.
+func ValidateRestore(restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest, pods []string) error {
+	backed := map[string]bool{}
+	for _, keyspace := range backupKeyspaces(manifest) {
+		backed[keyspace] = true
+	}
+	for _, keyspace := range restore.Spec.Keyspaces {
+		if !backed[keyspace] {
+			return fmt.Errorf("keyspace %q is not in backup %q", keyspace, manifest.Name)
+		}
+	}
+	// The nodes are restored on the ones with the same position, their
+	// tokens are checked once they're ready.
+	if len(pods) != len(manifest.Nodes) {
+		return fmt.Errorf("cluster %q has %d nodes, backup %q has %d", restore.Spec.ClusterName, len(pods), manifest.Name, len(manifest.Nodes))
+	}
+	return nil
+}
+
+// RestoreTokensName returns the name of the ConfigMap with the initial tokens
+// of the cluster created by the restore.
+func RestoreTokensName(restore *cassandrav1alpha1.CassandraRestore) string {
+	return restore.Name + "-tokens"
+}
+
+// restoreFilesName returns the name of the ConfigMap with the files of the
+// backup downloaded on every pod.
+func restoreFilesName(restore *cassandrav1alpha1.CassandraRestore) string {
+	return restore.Name + "-files"
+}
+
+// restoreStagingPath returns the directory of the data volumes the backup is
+// downloaded into, at <keyspace>/<table>/, before it's moved into the tables.
+func restoreStagingPath(restore *cassandrav1alpha1.CassandraRestore) string {
+	return path.Join(cassandraDataPath, "restore-"+restore.Name)
+}
+
+// ValidateRestoreTokens returns a TokensMismatchError when a node of the
+// cluster doesn't hold the tokens of the backed up node with its position,
+// it would load the data of ranges it doesn't own. The nodes must be ready.
+func (r *CassandraClusterKubeClient) ValidateRestoreTokens(cc *cassandrav1alpha1.CassandraCluster, manifest *BackupManifest) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	if len(pods) != len(manifest.Nodes) {
+		return &TokensMismatchError{msg: fmt.Sprintf("cluster %s has %d nodes, backup %s has %d", cc.Name, len(pods), manifest.Name, len(manifest.Nodes))}
+	}
+
+	for i, pod := range pods {
+		command, err := r.nodetoolCommand(cc, "info", "-T")
+		if err != nil {
+			return err
+		}
+		info, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+		if err != nil {
+			return err
+		}
+		if source := manifest.Nodes[i]; !sameTokens(parseTokens(info), source.Tokens) {
+			return &TokensMismatchError{msg: fmt.Sprintf("node %s doesn't hold the tokens of the backed up node %s, the ring of cluster %s changed since backup %s", pod, source.Pod, cc.Name, manifest.Name)}
+		}
+	}
+	return nil
+}
+
+// sameTokens returns whether both nodes hold the same tokens, in any order.
+func sameTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// EnsureRestoreTokens makes sure the initial tokens ConfigMap of the cluster
+// created by the restore exists, with the tokens of every backed up node for
+// the pod with its position.
+func (r *CassandraClusterKubeClient) EnsureRestoreTokens(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error {
+	tokens := map[string]string{}
+	for i, pod := range ClusterPodNames(cc) {
+		if i < len(manifest.Nodes) {
+			tokens[pod] = strings.Join(manifest.Nodes[i].Tokens, ",")
+		}
+	}
+	err := r.K8SService.CreateConfigMap(restore.Namespace, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RestoreTokensName(restore),
+			Namespace: restore.Namespace,
+			Labels:    restoreLabels(restore),
+			OwnerReferences: []metav1.OwnerReference{
+				restoreOwnerReference(restore),
+			},
+		},
+		Data: tokens,
+	})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// PrepareRestore creates the keyspaces and the schema of the backup missing
+// on the cluster, so the backup can be moved into its tables once it's
+// downloaded.
+func (r *CassandraClusterKubeClient) PrepareRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return err
+	}
+
+	keyspaces := RestoreKeyspaces(restore, manifest)
+	restored := map[string]bool{}
+	for _, keyspace := range keyspaces {
+		restored[keyspace] = true
+		if replication, ok := manifest.Replication[keyspace]; ok {
+			if err := r.execute(session, fmt.Sprintf("create keyspace %s with replication %s", keyspace, cqlMap(replication)),
+				fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = %s", cqlIdentifier(keyspace), cqlMap(replication))); err != nil {
+				return err
+			}
+		}
+	}
+	// The statements of the snapshots create the tables if they don't exist,
+	// with the IDs of the backed up ones.
+	for _, statement := range strings.Split(manifest.Schema, ";") {
+		statement = strings.TrimSpace(statement)
+		if statement == "" || !restored[statementKeyspace(statement)] {
+			continue
+		}
+		if err := r.execute(session, fmt.Sprintf("apply the schema of keyspace %s", statementKeyspace(statement)), statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TruncateRestore truncates the restored tables once the backup is
+// downloaded on every node, so only the data of the backup remains once it's
+// loaded.
+func (r *CassandraClusterKubeClient) TruncateRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return err
+	}
+
+	keyspaces := RestoreKeyspaces(restore, manifest)
+	for _, table := range restoreTables(manifest, keyspaces) {
+		keyspace, name := splitTable(table)
+		if err := r.execute(session, fmt.Sprintf("truncate table %s", table),
+			fmt.Sprintf("TRUNCATE %s.%s", cqlIdentifier(keyspace), cqlIdentifier(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartRestore records the files of the backup restored on every pod of the
+// cluster and creates the jobs downloading them into the staging directory of
+// their data volumes.
+func (r *CassandraClusterKubeClient) StartRestore(cc *cassandrav1alpha1.CassandraCluster, backup *cassandrav1alpha1.CassandraBackup, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	if len(pods) != len(manifest.Nodes) {
+		return fmt.Errorf("cluster %s has %d nodes, backup %s has %d", cc.Name, len(pods), manifest.Name, len(manifest.Nodes))
+	}
+
+	keyspaces := RestoreKeyspaces(restore, manifest)
+	files := map[string]string{}
+	for i, pod := range pods {
+		files[pod] = strings.Join(restoreFiles(manifest.Nodes[i], keyspaces), "\n") + "\n"
+	}
+	name := restoreFilesName(restore)
+	if err := r.K8SService.DeleteConfigMap(restore.Namespace, name); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err := r.K8SService.CreateConfigMap(restore.Namespace, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: restore.Namespace,
+			Labels:    restoreLabels(restore),
+			OwnerReferences: []metav1.OwnerReference{
+				restoreOwnerReference(restore),
+			},
+		},
+		Data: files,
+	}); err != nil {
+		return err
+	}
+
+	for i, pod := range pods {
+		job := generateDownloadJob(backup, restore, manifest.Name, manifest.Nodes[i].Pod, pod, i)
+		if err := r.K8SService.CreateJob(restore.Namespace, job); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	r.logger.Infof("restore of backup %s on %d nodes started", manifest.Name, len(pods))
+	return nil
+}
+
+// RestoreDownloads returns the pods whose backup is downloaded, still being
+// downloaded or failed to be downloaded.
+func (r *CassandraClusterKubeClient) RestoreDownloads(restore *cassandrav1alpha1.CassandraRestore) (downloaded, pending, failed []string, err error) {
+	jobs, err := r.K8SService.ListJobs(restore.Namespace, labels.Set(restoreLabels(restore)))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, job := range jobs {
+		pod := job.Labels["pod"]
+		switch {
+		case job.Status.Succeeded > 0:
+			downloaded = append(downloaded, pod)
+		case jobFailed(&job):
+			failed = append(failed, pod)
+		default:
+			pending = append(pending, pod)
+		}
+	}
+	return downloaded, pending, failed, nil
+}
+
+// FinishRestore moves the downloaded backup into the tables of every node of
+// the cluster and loads them, then deletes the download jobs and their files.
+// The nodes whose backup was moved before are only loaded again.
+func (r *CassandraClusterKubeClient) FinishRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore, manifest *BackupManifest) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	tables := restoreTables(manifest, RestoreKeyspaces(restore, manifest))
+	for _, pod := range pods {
+		if _, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, []string{
+			"/bin/bash", "-c", restoreMoveScript(restore),
+		}); err != nil {
+			return err
+		}
+		for _, table := range tables {
+			keyspace, name := splitTable(table)
+			command, err := r.nodetoolCommand(cc, "refresh", keyspace, name)
+			if err != nil {
+				return err
+			}
+			if _, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.deleteRestoreJobs(restore); err != nil {
+		return err
+	}
+	r.logger.Infof("backup %s restored on %d nodes", manifest.Name, len(pods))
+	return nil
+}
+
+// AbortRestore removes the downloaded backup from every node of the cluster
+// after a failed download, its tables are left untouched, then deletes the
+// download jobs and their files.
+func (r *CassandraClusterKubeClient) AbortRestore(cc *cassandrav1alpha1.CassandraCluster, restore *cassandrav1alpha1.CassandraRestore) error {
+	pods, err := r.ClusterPods(cc)
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if _, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, []string{
+			"rm", "-rf", restoreStagingPath(restore),
+		}); err != nil {
+			return err
+		}
+	}
+	return r.deleteRestoreJobs(restore)
+}
+
+// deleteRestoreJobs deletes the download jobs of the restore and the
+// ConfigMap with their files.
+func (r *CassandraClusterKubeClient) deleteRestoreJobs(restore *cassandrav1alpha1.CassandraRestore) error {
+	jobs, err := r.K8SService.ListJobs(restore.Namespace, labels.Set(restoreLabels(restore)))
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := r.K8SService.DeleteJob(restore.Namespace, job.Name); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if err := r.K8SService.DeleteConfigMap(restore.Namespace, restoreFilesName(restore)); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// restoreMoveScript returns the script moving the downloaded backup of the
+// node into the directories of the tables with the same name, whatever their
+// ID. The sstables are moved under generations above the ones of the table,
+// the ones written since its truncation included, and nodetool refresh gives
+// them new generations again when it loads them. The staging directory is
+// removed once it's empty, so the script does nothing when it runs again.
+func restoreMoveScript(restore *cassandrav1alpha1.CassandraRestore) string {
+	staging := restoreStagingPath(restore)
+	return strings.Join([]string{
+		"set -e",
+		"shopt -s nullglob",
+		// generation prints the generation of the sstable file $1, named
+		// <version>-<generation>-<format>-<component>.
+		`generation() { IFS=- read -r _ gen _ <<< "$(basename "$1")"; [[ $gen =~ ^[0-9]+$ ]] && echo "$gen"; }`,
+		fmt.Sprintf("[ -d %s ] || exit 0", staging),
+		fmt.Sprintf("cd %s", cassandraTablesPath),
+		fmt.Sprintf(`for staged in %s/*/*; do`, staging),
+		fmt.Sprintf(`  table=${staged#%s/}`, staging),
+		`  dir=$(ls -dt "$table"-* 2>/dev/null | head -n 1)`,
+		`  [ -n "$dir" ] || { echo "table $table not found" >&2; exit 1; }`,
+		// The last generation is kept with the staged files, so the
+		// components of an sstable get the same one when the script runs
+		// again after moving a part of them.
+		`  if [ -f "$staged/.last" ]; then last=$(cat "$staged/.last"); else`,
+		`    last=0`,
+		`    for file in "$dir"/*; do`,
+		`      gen=$(generation "$file") || continue`,
+		`      [ "$gen" -le "$last" ] || last=$gen`,
+		`    done`,
+		`    echo "$last" > "$staged/.last"`,
+		`  fi`,
+		`  for file in "$staged"/*; do`,
+		`    gen=$(generation "$file") || { echo "unexpected sstable $file" >&2; exit 1; }`,
+		`    IFS=- read -r version _ rest <<< "$(basename "$file")"`,
+		`    target="$dir/$version-$((gen + last))-$rest"`,
+		`    [ ! -e "$target" ] || { echo "$target already exists" >&2; exit 1; }`,
+		`    mv "$file" "$target"`,
+		`  done`,
+		`done`,
+		fmt.Sprintf("rm -rf %s", staging),
+	}, "\n")
+}
+
+// restoreFiles returns the sstable files of the node in the keyspaces, the
+// snapshot metadata and the files of the secondary indexes are left out.
+func restoreFiles(node BackupNode, keyspaces []string) []string {
+	restored := map[string]bool{}
+	for _, keyspace := range keyspaces {
+		restored[keyspace] = true
+	}
+	var files []string
+	for _, file := range node.Files {
+		parts := strings.Split(file, "/")
+		if len(parts) != 3 || !restored[parts[0]] || parts[2] == "manifest.json" || parts[2] == "schema.cql" {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// restoreTables returns the <keyspace>/<table> tables of the backup in the
+// keyspaces, sorted.
+func restoreTables(manifest *BackupManifest, keyspaces []string) []string {
+	seen := map[string]bool{}
+	var tables []string
+	for _, node := range manifest.Nodes {
+		for _, file := range restoreFiles(node, keyspaces) {
+			// The directory of a table is named <table>-<id>.
+			dir := path.Dir(file)
+			i := strings.LastIndex(dir, "-")
+			if i < 0 {
+				continue
+			}
+			table := dir[:i]
+			if !seen[table] {
+				seen[table] = true
+				tables = append(tables, table)
+			}
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// splitTable returns the keyspace and the name of a <keyspace>/<table> table.
+func splitTable(table string) (string, string) {
+	parts := strings.SplitN(table, "/", 2)
+	return parts[0], parts[1]
+}
+
+// statementKeyspace returns the keyspace of the object of a schema
+// statement, the one of its first qualified name.
+func statementKeyspace(statement string) string {
+	for _, field := range strings.Fields(statement) {
+		if i := strings.Index(field, "."); i > 0 {
+			return strings.Trim(field[:i], `"`)
+		}
+	}
+	return ""
+}
+
+// restoreLabels returns the labels of the resources of the CassandraRestore.
+func restoreLabels(restore *cassandrav1alpha1.CassandraRestore) map[string]string {
+	return map[string]string{
+		"app":     "cassandra-restore",
+		"restore": restore.Name,
+	}
+}
+
+// restoreOwnerReference returns the reference making the CassandraRestore
+// the controller of its resources, they're deleted along with it.
+func restoreOwnerReference(restore *cassandrav1alpha1.CassandraRestore) metav1.OwnerReference {
+	return *metav1.NewControllerRef(restore, schema.GroupVersionKind{
+		Group:   cassandrav1alpha1.SchemeGroupVersion.Group,
+		Version: cassandrav1alpha1.SchemeGroupVersion.Version,
+		Kind:    cassandrav1alpha1.RestoreKind,
+	})
+}
+
+// generateDownloadJob returns the job downloading the files of the backed up
+// node source of the backup name into the staging directory of pod, the
+// index-th node of the cluster. The files are written at <keyspace>/<table>/,
+// without the ID of the table, owned by the owner of the data directory. It
+// runs on the node of the pod to mount its volume.
+func generateDownloadJob(backup *cassandrav1alpha1.CassandraBackup, restore *cassandrav1alpha1.CassandraRestore, name, source, pod string, index int) *batchv1.Job {
+	staging := restoreStagingPath(restore)
+	script := []string{
+		"set -e",
+		backupDownloadFunction(backup),
+		fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s", staging),
+		`while read -r file; do`,
+		`  [ -n "$file" ] || continue`,
+		`  table=$(dirname "$file")`,
+		fmt.Sprintf(`  mkdir -p "%s/${table%%-*}"`, staging),
+		fmt.Sprintf(`  download "%s/$file" "%s/${table%%-*}/$(basename "$file")"`, path.Join(name, source), staging),
+		fmt.Sprintf(`done < %s/%s`, restoreFilesPath, pod),
+		fmt.Sprintf(`chown -R "$(stat -c %%u:%%g %s)" %s`, cassandraTablesPath, staging),
+	}
+	volume, mount := podDataVolume(pod, false)
+	volumes := []corev1.Volume{
+		volume,
+		{
+			Name: "files",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: restoreFilesName(restore)},
+				},
+			},
+		},
+	}
+	mounts := []corev1.VolumeMount{
+		mount,
+		{Name: "files", MountPath: restoreFilesPath, ReadOnly: true},
+	}
+
+	labels := restoreLabels(restore)
+	labels["pod"] = pod
+	job := generateBackupJob(backup, restoreOwnerReference(restore), fmt.Sprintf("%s-%d", restore.Name, index), labels, script, volumes, mounts)
+	job.Spec.Template.Spec.Affinity = podNodeAffinity(pod)
+	return job
+}
+
+// backupDownloadFunction returns the shell function copying the path $1 of
+// the destination to the file $2.
+func backupDownloadFunction(backup *cassandrav1alpha1.CassandraBackup) string {
+	if backup.Spec.Destination.S3 != nil {
+		return fmt.Sprintf(`download() { %s; }`, s3Command("cp", fmt.Sprintf(`"$%s/$1"`, backupURLEnv), `"$2"`))
+	}
+	return fmt.Sprintf(`download() { cp "$%s/$1" "$2"; }`, backupURLEnv)
+}
+
+// applyInitialTokens mounts the initial tokens ConfigMap on the cassandra
+// container of the statefulset. It's optional, the nodes without tokens
+// bootstrap with random ones.
+func applyInitialTokens(cc *cassandrav1alpha1.CassandraCluster, ss *appsv1.StatefulSet) {
+	if cc.Spec.InitialTokensConfigMap == "" {
+		return
+	}
+
+	optional := true
+	template := &ss.Spec.Template
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: initialTokensVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cc.Spec.InitialTokensConfigMap},
+				Optional:             &optional,
+			},
+		},
+	})
+	container := findContainer(template.Spec.Containers, cassandraContainerName)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      initialTokensVolumeName,
+		MountPath: initialTokensPath,
+		ReadOnly:  true,
+	})
+}
+
+// initialTokensCommands returns the commands setting the tokens of the node,
+// picked by its hostname, as its initial tokens. The number of tokens is
+// exported for the image entrypoint, which sets it from the environment.
+// Cassandra ignores them once the node bootstrapped.
+func initialTokensCommands(cc *cassandrav1alpha1.CassandraCluster) []string {
+	if cc.Spec.InitialTokensConfigMap == "" {
+		return nil
+	}
+	tokens := initialTokensPath + "/${HOSTNAME}"
+	return []string{
+		fmt.Sprintf(`if [ -s %[1]s ]; then export CASSANDRA_NUM_TOKENS=$(tr ',' ' ' < %[1]s | wc -w) && sed -ri "s/^(# )?(initial_token:).*/\2 $(cat %[1]s)/" %[2]s; fi`,
+			tokens, cassandraConfigPath),
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+func testManifest() *BackupManifest {
+	return &BackupManifest{
+		Name:    "daily-20180601",
+		Cluster: "test",
+		Nodes: []BackupNode{
+			{
+				Pod:    "cassandra-0",
+				Tokens: []string{"-9223372036854775808", "0"},
+				Files: []string{
+					"app/users-1a2b/mc-1-big-Data.db",
+					"app/users-1a2b/mc-1-big-Index.db",
+					"app/users-1a2b/manifest.json",
+					"app/users-1a2b/schema.cql",
+					"app/users-1a2b/.users_email_idx/mc-1-big-Data.db",
+					"app/orders-3c4d/mc-2-big-Data.db",
+					"system_auth/roles-5e6f/mc-1-big-Data.db",
+				},
+			},
+			{
+				Pod:    "cassandra-1",
+				Tokens: []string{"-4611686018427387904", "4611686018427387904"},
+				Files: []string{
+					"app/users-1a2b/mc-3-big-Data.db",
+					"metrics/events-7a8b/mc-1-big-Data.db",
+				},
+			},
+		},
+	}
+}
+
+func TestRestoreFiles(t *testing.T) {
+	node := testManifest().Nodes[0]
+	tests := []struct {
+		name      string
+		keyspaces []string
+		want      []string
+	}{
+		{
+			name:      "the sstables of the keyspaces without snapshot metadata nor indexes",
+			keyspaces: []string{"app"},
+			want: []string{
+				"app/users-1a2b/mc-1-big-Data.db",
+				"app/users-1a2b/mc-1-big-Index.db",
+				"app/orders-3c4d/mc-2-big-Data.db",
+			},
+		},
+		{
+			name:      "a keyspace without files on the node",
+			keyspaces: []string{"metrics"},
+		},
+		{
+			name: "no keyspace",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := restoreFiles(node, test.keyspaces); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRestoreTables(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyspaces []string
+		want      []string
+	}{
+		{
+			name:      "the tables of every node, sorted",
+			keyspaces: []string{"app", "metrics"},
+			want:      []string{"app/orders", "app/users", "metrics/events"},
+		},
+		{
+			name:      "the tables of the restored keyspaces only",
+			keyspaces: []string{"metrics"},
+			want:      []string{"metrics/events"},
+		},
+		{
+			name:      "a keyspace not in the backup",
+			keyspaces: []string{"other"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := restoreTables(testManifest(), test.keyspaces); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStatementKeyspace(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+	}{
+		{
+			statement: "CREATE TABLE IF NOT EXISTS app.users (id uuid PRIMARY KEY, email text) WITH ID = 1a2b",
+			want:      "app",
+		},
+		{
+			statement: `CREATE TABLE IF NOT EXISTS "App"."Users" (id uuid PRIMARY KEY)`,
+			want:      "App",
+		},
+		{
+			statement: "CREATE TYPE IF NOT EXISTS app.address (street text, city text)",
+			want:      "app",
+		},
+		{
+			statement: "CREATE INDEX IF NOT EXISTS users_email_idx ON app.users (email)",
+			want:      "app",
+		},
+		{
+			statement: "-- comment without statement",
+			want:      "",
+		},
+	}
+
+	for _, test := range tests {
+		if got := statementKeyspace(test.statement); got != test.want {
+			t.Errorf("statementKeyspace(%q) = %q, want %q", test.statement, got, test.want)
+		}
+	}
+}
+
+func TestValidateRestore(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyspaces []string
+		pods      []string
+		valid     bool
+	}{
+		{
+			name:  "every keyspace on as many nodes",
+			pods:  []string{"cassandra-0", "cassandra-1"},
+			valid: true,
+		},
+		{
+			name:      "keyspaces of the backup",
+			keyspaces: []string{"app", "metrics"},
+			pods:      []string{"restored-0", "restored-1"},
+			valid:     true,
+		},
+		{
+			name:      "a system keyspace is not restored",
+			keyspaces: []string{"system_auth"},
+			pods:      []string{"cassandra-0", "cassandra-1"},
+		},
+		{
+			name:      "a keyspace not in the backup",
+			keyspaces: []string{"other"},
+			pods:      []string{"cassandra-0", "cassandra-1"},
+		},
+		{
+			name: "more nodes than the backup",
+			pods: []string{"cassandra-0", "cassandra-1", "cassandra-2"},
+		},
+		{
+			name: "fewer nodes than the backup",
+			pods: []string{"cassandra-0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restore := &cassandrav1alpha1.CassandraRestore{
+				ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "default"},
+				Spec:       cassandrav1alpha1.CassandraRestoreSpec{ClusterName: "test", Keyspaces: test.keyspaces},
+			}
+			if err := ValidateRestore(restore, testManifest(), test.pods); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestSameTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{name: "same order", a: []string{"-1", "1"}, b: []string{"-1", "1"}, want: true},
+		{name: "any order", a: []string{"1", "-1"}, b: []string{"-1", "1"}, want: true},
+		{name: "no tokens", want: true},
+		{name: "other token", a: []string{"-1", "2"}, b: []string{"-1", "1"}},
+		{name: "missing token", a: []string{"-1"}, b: []string{"-1", "1"}},
+		{name: "duplicated token", a: []string{"-1", "-1"}, b: []string{"-1", "1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := append([]string(nil), test.a...)
+			if got := sameTokens(a, test.b); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+			if !reflect.DeepEqual(a, test.a) && len(test.a) > 0 {
+				t.Errorf("tokens reordered to %v", a)
+			}
+		})
+	}
+}
+
+func TestRestoreMoveScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not found")
+	}
+	root, err := ioutil.TempDir("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	restore := &cassandrav1alpha1.CassandraRestore{ObjectMeta: metav1.ObjectMeta{Name: "restore"}}
+	script := strings.Replace(restoreMoveScript(restore), cassandraDataPath, root, -1)
+
+	write := func(files ...string) {
+		for _, file := range files {
+			file = filepath.Join(root, file)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, []byte(filepath.Base(file)), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// The truncated table got new sstables with the generations of the
+	// backup ones.
+	write(
+		"data/app/users-9f9f/mc-1-big-Data.db",
+		"data/app/users-9f9f/mc-2-big-Data.db",
+		"data/app/users-9f9f/mc-2-big-Index.db",
+		"data/app/orders-8e8e/.keep",
+		"restore-restore/app/users/mc-1-big-Data.db",
+		"restore-restore/app/users/mc-1-big-Index.db",
+		"restore-restore/app/users/mc-3-big-Data.db",
+		"restore-restore/app/orders/mc-1-big-Data.db",
+	)
+
+	run := func() {
+		cmd := exec.Command("bash", "-c", script)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("script failed: %s: %s", err, out)
+		}
+	}
+	run()
+
+	var got []string
+	filepath.Walk(filepath.Join(root, "data"), func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(root, file)
+			content, _ := ioutil.ReadFile(file)
+			got = append(got, rel+" <- "+string(content))
+		}
+		return nil
+	})
+	sort.Strings(got)
+	want := []string{
+		"data/app/orders-8e8e/.keep <- .keep",
+		"data/app/orders-8e8e/mc-1-big-Data.db <- mc-1-big-Data.db",
+		"data/app/users-9f9f/mc-1-big-Data.db <- mc-1-big-Data.db",
+		"data/app/users-9f9f/mc-2-big-Data.db <- mc-2-big-Data.db",
+		"data/app/users-9f9f/mc-2-big-Index.db <- mc-2-big-Index.db",
+		"data/app/users-9f9f/mc-3-big-Data.db <- mc-1-big-Data.db",
+		"data/app/users-9f9f/mc-3-big-Index.db <- mc-1-big-Index.db",
+		"data/app/users-9f9f/mc-5-big-Data.db <- mc-3-big-Data.db",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got files\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if _, err := os.Stat(filepath.Join(root, "restore-restore")); !os.IsNotExist(err) {
+		t.Errorf("staging directory not removed: %v", err)
+	}
+
+	// The script does nothing once the backup is moved.
+	run()
+
+	// A run interrupted after moving a part of an sstable moves the rest of
+	// it under the same generation.
+	write(
+		"data/app/events-7a7a/mc-1-big-Data.db",
+		"data/app/events-7a7a/mc-2-big-Data.db",
+		"restore-restore/app/events/mc-1-big-Index.db",
+	)
+	if err := ioutil.WriteFile(filepath.Join(root, "restore-restore/app/events/.last"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run()
+	if _, err := os.Stat(filepath.Join(root, "data/app/events-7a7a/mc-2-big-Index.db")); err != nil {
+		t.Errorf("rest of the sstable not moved under its generation: %v", err)
+	}
+}
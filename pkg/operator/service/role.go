@@ -0,0 +1,266 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
+)
+
+// allPermissions grants every permission that applies to the resource.
+const allPermissions = "ALL"
+
+// dataResourcePrefix is the prefix of the keyspace and table resources on
+// system_auth.role_permissions, like data/keyspace/table.
+const dataResourcePrefix = "data/"
+
+var (
+	// keyspacePermissions are the permissions that apply to keyspaces.
+	keyspacePermissions = []string{"CREATE", "ALTER", "DROP", "SELECT", "MODIFY", "AUTHORIZE"}
+	// tablePermissions are the permissions that apply to tables.
+	tablePermissions = []string{"ALTER", "DROP", "SELECT", "MODIFY", "AUTHORIZE"}
+)
+
+// RoleName returns the name in cassandra of the role.
+func RoleName(role *cassandrav1alpha1.CassandraRole) string {
+	if role.Spec.RoleName != "" {
+		return role.Spec.RoleName
+	}
+	return role.Name
+}
+
+// ValidateRole returns an error describing the invalid grants of the role.
+func ValidateRole(role *cassandrav1alpha1.CassandraRole) error {
+	_, err := rolePermissions(role)
+	return err
+}
+
+// rolePermissions returns the permissions of the role per resource, with ALL
+// expanded to the permissions of the resource.
+func rolePermissions(role *cassandrav1alpha1.CassandraRole) (map[string]map[string]bool, error) {
+	permissions := map[string]map[string]bool{}
+	for _, grant := range role.Spec.Grants {
+		if grant.Keyspace == "" {
+			return nil, fmt.Errorf("grants must have a keyspace")
+		}
+
+		resource := dataResourcePrefix + grant.Keyspace
+		valid := keyspacePermissions
+		if grant.Table != "" {
+			resource += "/" + grant.Table
+			valid = tablePermissions
+		}
+		if permissions[resource] == nil {
+			permissions[resource] = map[string]bool{}
+		}
+
+		for _, permission := range grant.Permissions {
+			permission = strings.ToUpper(permission)
+			switch {
+			case permission == allPermissions:
+				for _, p := range valid {
+					permissions[resource][p] = true
+				}
+			case contains(valid, permission):
+				permissions[resource][permission] = true
+			default:
+				return nil, fmt.Errorf("permission %s doesn't apply to %s", permission, cqlResource(resource))
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// EnsureRole makes sure the role exists on the cluster with the login,
+// superuser and password of its spec, and only the permissions of its grants
+// on keyspaces and tables. The cluster must have the authentication ready.
+func (r *CassandraClusterKubeClient) EnsureRole(cc *cassandrav1alpha1.CassandraCluster, role *cassandrav1alpha1.CassandraRole) error {
+	permissions, err := rolePermissions(role)
+	if err != nil {
+		return err
+	}
+	password, err := r.rolePassword(role)
+	if err != nil {
+		return err
+	}
+
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return err
+	}
+
+	name := RoleName(role)
+	if err := r.ensureRole(session, name, role.Spec, password); err != nil {
+		return err
+	}
+	return r.ensurePermissions(session, name, permissions)
+}
+
+// DeleteRole drops the role from the cluster.
+func (r *CassandraClusterKubeClient) DeleteRole(cc *cassandrav1alpha1.CassandraCluster, role *cassandrav1alpha1.CassandraRole) error {
+	session, err := r.superuserSession(cc)
+	if err != nil {
+		return err
+	}
+
+	name := RoleName(role)
+	return r.execute(session, fmt.Sprintf("drop role %s", name), fmt.Sprintf("DROP ROLE IF EXISTS %s", cqlString(name)))
+}
+
+// rolePassword returns the password of the secret key referenced by the
+// role, empty when it references none.
+func (r *CassandraClusterKubeClient) rolePassword(role *cassandrav1alpha1.CassandraRole) (string, error) {
+	ref := role.Spec.PasswordSecretRef
+	if ref == nil {
+		return "", nil
+	}
+
+	secret, err := r.K8SService.GetSecret(role.Namespace, ref.Name)
+	if err != nil {
+		return "", err
+	}
+	password := string(secret.Data[ref.Key])
+	if password == "" {
+		return "", fmt.Errorf("secret %s/%s has no %s key", role.Namespace, ref.Name, ref.Key)
+	}
+	return password, nil
+}
+
+// superuserSession returns a session to the cluster logged in as its
+// superuser, or anonymous when the cluster has no authentication.
+func (r *CassandraClusterKubeClient) superuserSession(cc *cassandrav1alpha1.CassandraCluster) (cql.Session, error) {
+	if cc.Spec.Auth == nil {
+		return r.cqlSession(cc, cql.Credentials{})
+	}
+	superuser, err := r.superuserCredentials(cc)
+	if err != nil {
+		return nil, err
+	}
+	return r.cqlSession(cc, superuser)
+}
+
+// ensureRole creates the role or alters it when its options differ from the
+// spec. The password is never removed from an existing role.
+func (r *CassandraClusterKubeClient) ensureRole(session cql.Session, name string, spec cassandrav1alpha1.CassandraRoleSpec, password string) error {
+	options := fmt.Sprintf("LOGIN = %t AND SUPERUSER = %t", spec.Login, spec.Superuser)
+	if password != "" {
+		options += " AND PASSWORD = " + cqlString(password)
+	}
+
+	var canLogin, isSuperuser bool
+	var saltedHash string
+	err := session.Query("SELECT can_login, is_superuser, salted_hash FROM system_auth.roles WHERE role = ?", name).Scan(&canLogin, &isSuperuser, &saltedHash)
+	if err == cql.ErrNotFound {
+		return r.execute(session, fmt.Sprintf("create role %s", name), fmt.Sprintf("CREATE ROLE %s WITH %s", cqlString(name), options))
+	}
+	if err != nil {
+		return err
+	}
+
+	if canLogin == spec.Login && isSuperuser == spec.Superuser && passwordMatches(saltedHash, password) {
+		return nil
+	}
+	return r.execute(session, fmt.Sprintf("alter role %s", name), fmt.Sprintf("ALTER ROLE %s WITH %s", cqlString(name), options))
+}
+
+// passwordMatches returns whether the password hashed by cassandra is
+// password, an empty password always matches.
+func passwordMatches(saltedHash, password string) bool {
+	if password == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(saltedHash), []byte(password)) == nil
+}
+
+// ensurePermissions grants the missing permissions to the role and revokes
+// the ones it has on keyspaces and tables that are not desired.
+func (r *CassandraClusterKubeClient) ensurePermissions(session cql.Session, name string, desired map[string]map[string]bool) error {
+	current := map[string]map[string]bool{}
+	iter := session.Query("SELECT resource, permissions FROM system_auth.role_permissions WHERE role = ?", name).Iter()
+	var resource string
+	var permissions []string
+	for iter.Scan(&resource, &permissions) {
+		if !strings.HasPrefix(resource, dataResourcePrefix) {
+			continue
+		}
+		current[resource] = map[string]bool{}
+		for _, permission := range permissions {
+			current[resource][permission] = true
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	for _, resource := range sortedResources(desired) {
+		for _, permission := range sortedPermissions(desired[resource]) {
+			if current[resource][permission] {
+				continue
+			}
+			if err := r.execute(session, fmt.Sprintf("grant %s on %s to %s", permission, cqlResource(resource), name),
+				fmt.Sprintf("GRANT %s ON %s TO %s", permission, cqlResource(resource), cqlString(name))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, resource := range sortedResources(current) {
+		for _, permission := range sortedPermissions(current[resource]) {
+			if desired[resource][permission] {
+				continue
+			}
+			if err := r.execute(session, fmt.Sprintf("revoke %s on %s from %s", permission, cqlResource(resource), name),
+				fmt.Sprintf("REVOKE %s ON %s FROM %s", permission, cqlResource(resource), cqlString(name))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cqlResource returns the CQL resource of a data resource name, like
+// KEYSPACE "keyspace" for data/keyspace.
+func cqlResource(resource string) string {
+	parts := strings.SplitN(strings.TrimPrefix(resource, dataResourcePrefix), "/", 2)
+	if len(parts) == 1 {
+		return "KEYSPACE " + cqlIdentifier(parts[0])
+	}
+	return "TABLE " + cqlIdentifier(parts[0]) + "." + cqlIdentifier(parts[1])
+}
+
+// cqlIdentifier returns name as a quoted CQL identifier, keeping its case.
+func cqlIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// sortedResources returns the resources of the permissions sorted.
+func sortedResources(permissions map[string]map[string]bool) []string {
+	resources := make([]string, 0, len(permissions))
+	for resource := range permissions {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
+
+// sortedPermissions returns the permissions of the set sorted.
+func sortedPermissions(set map[string]bool) []string {
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	hostnameTopologyKey = "kubernetes.io/hostname"
+	// rackDatacenter is the datacenter of the nodes of the racks, the one
+	// the SimpleSnitch of the nodes of a cluster without racks reports.
+	rackDatacenter = "datacenter1"
+)
+
+// clusterLabels returns the labels shared by all the pods of a cassandra cluster.
+func clusterLabels(cc *cassandrav1alpha1.CassandraCluster) map[string]string {
+	return map[string]string{
+		"app":        "cassandra",
+		"controller": cc.Name,
+	}
+}
+
+// rackLabels returns the labels of the pods of a rack, they are also used as
+// the selector of the rack statefulset.
+func rackLabels(cc *cassandrav1alpha1.CassandraCluster, rack cassandrav1alpha1.RackSpec) map[string]string {
+	labels := clusterLabels(cc)
+	if rack.Name != "" {
+		labels["rack"] = rack.Name
+	}
+	return labels
+}
+
+// clusterRacks returns the racks of the cluster with their replicas defaulted.
+// A cluster without racks is handled as a single unnamed rack. The replicas of
+// the cluster not set on a rack are split across the racks without replicas,
+// the first ones get one more when they don't divide evenly.
+func clusterRacks(cc *cassandrav1alpha1.CassandraCluster) []cassandrav1alpha1.RackSpec {
+	if len(cc.Spec.Racks) == 0 {
+		return []cassandrav1alpha1.RackSpec{{Replicas: cc.Spec.Replicas}}
+	}
+
+	var unset, remaining int32
+	if cc.Spec.Replicas != nil {
+		remaining = *cc.Spec.Replicas
+	}
+	for _, rack := range cc.Spec.Racks {
+		if rack.Replicas == nil {
+			unset++
+			continue
+		}
+		remaining -= *rack.Replicas
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	racks := make([]cassandrav1alpha1.RackSpec, 0, len(cc.Spec.Racks))
+	var defaulted int32
+	for _, rack := range cc.Spec.Racks {
+		rack := *rack.DeepCopy()
+		if rack.Replicas == nil && cc.Spec.Replicas != nil {
+			share := remaining / unset
+			if defaulted < remaining%unset {
+				share++
+			}
+			defaulted++
+			rack.Replicas = &share
+		}
+		racks = append(racks, rack)
+	}
+	return racks
+}
+
+// ClusterPodNames returns the names of the pods of the cluster as defined by
+// its spec, in the order of ClusterPods.
+func ClusterPodNames(cc *cassandrav1alpha1.CassandraCluster) []string {
+	var pods []string
+	for _, rack := range clusterRacks(cc) {
+		replicas := int32(1)
+		if rack.Replicas != nil {
+			replicas = *rack.Replicas
+		}
+		for i := int32(0); i < replicas; i++ {
+			pods = append(pods, fmt.Sprintf("%s-%d", rackStatefulSetName(cc, rack), i))
+		}
+	}
+	return pods
+}
+
+// validateRacks returns an error describing the invalid racks of the cluster,
+// their names are part of the names of their statefulsets and pods.
+func validateRacks(cc *cassandrav1alpha1.CassandraCluster) error {
+	names := make(map[string]bool, len(cc.Spec.Racks))
+	for _, rack := range cc.Spec.Racks {
+		if errs := validation.IsDNS1123Label(rack.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid rack name %q: %s", rack.Name, strings.Join(errs, ", "))
+		}
+		if names[rack.Name] {
+			return fmt.Errorf("duplicated rack name %q", rack.Name)
+		}
+		names[rack.Name] = true
+	}
+	return nil
+}
+
+// applyRack sets the datacenter and rack of the nodes of a named rack, the
+// image writes them on cassandra-rackdc.properties and switches to the
+// GossipingPropertyFileSnitch. The nodes of a cluster without racks keep the
+// SimpleSnitch of the image.
+func applyRack(rack cassandrav1alpha1.RackSpec, container *corev1.Container) {
+	if rack.Name == "" {
+		return
+	}
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "CASSANDRA_DC", Value: rackDatacenter},
+		corev1.EnvVar{Name: "CASSANDRA_RACK", Value: rack.Name},
+	)
+}
+
+// rackStatefulSetName returns the name of the statefulset of a rack.
+func rackStatefulSetName(cc *cassandrav1alpha1.CassandraCluster, rack cassandrav1alpha1.RackSpec) string {
+	if rack.Name == "" {
+		return cc.Spec.StatefulSetName
+	}
+	return cc.Spec.StatefulSetName + "-" + rack.Name
+}
+
+// clusterSeeds returns the seed of the cluster, the first pod of the first rack.
+func clusterSeeds(cc *cassandrav1alpha1.CassandraCluster) string {
+	first := rackStatefulSetName(cc, clusterRacks(cc)[0])
+	return first + "-0." + cc.Spec.StatefulSetName + "-unready." + cc.Namespace + ".svc.cluster.local"
+}
+
+// podScheduling merges the rack scheduling constraints over the cluster ones.
+// The rack affinity and priority class replace the cluster ones while the
+// tolerations and the node selector are added to them.
+func podScheduling(cc *cassandrav1alpha1.CassandraCluster, rack cassandrav1alpha1.RackSpec) cassandrav1alpha1.SchedulingSpec {
+	scheduling := *cc.Spec.SchedulingSpec.DeepCopy()
+
+	if rack.Affinity != nil {
+		scheduling.Affinity = rack.Affinity.DeepCopy()
+	}
+	for _, toleration := range rack.Tolerations {
+		scheduling.Tolerations = append(scheduling.Tolerations, *toleration.DeepCopy())
+	}
+	if len(rack.NodeSelector) > 0 && scheduling.NodeSelector == nil {
+		scheduling.NodeSelector = make(map[string]string, len(rack.NodeSelector))
+	}
+	for key, value := range rack.NodeSelector {
+		scheduling.NodeSelector[key] = value
+	}
+	if rack.PriorityClassName != "" {
+		scheduling.PriorityClassName = rack.PriorityClassName
+	}
+	return scheduling
+}
+
+// defaultAffinity spreads the pods of a cluster across nodes, two cassandra
+// nodes of the same cluster never share a kubernetes node. It's used when
+// neither the cluster nor the rack have an affinity.
+func defaultAffinity(cc *cassandrav1alpha1.CassandraCluster) *corev1.Affinity {
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+				{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: clusterLabels(cc),
+					},
+					TopologyKey: hostnameTopologyKey,
+				},
+			},
+		},
+	}
+}
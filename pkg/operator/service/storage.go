@@ -0,0 +1,57 @@
+package service
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	// cassandraDataVolumeName is the name of the volume of the cassandra data.
+	cassandraDataVolumeName = "cassandra-data"
+	// cassandraDataPath is where the cassandra image stores its data.
+	cassandraDataPath = "/cassandra_data"
+)
+
+// clusterResources returns the resources of the cassandra containers.
+func clusterResources(cc *cassandrav1alpha1.CassandraCluster) corev1.ResourceRequirements {
+	if cc.Spec.Resources == nil {
+		return corev1.ResourceRequirements{}
+	}
+	return *cc.Spec.Resources.DeepCopy()
+}
+
+// applyStorage claims a persistent volume for the data of every cassandra
+// node of the statefulset when the cluster has storage.
+func applyStorage(cc *cassandrav1alpha1.CassandraCluster, ss *appsv1.StatefulSet) {
+	storage := cc.Spec.Storage
+	if storage == nil {
+		return
+	}
+
+	ss.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   cassandraDataVolumeName,
+				Labels: clusterLabels(cc),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: storage.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: storage.Size,
+					},
+				},
+			},
+		},
+	}
+
+	container := findContainer(ss.Spec.Template.Spec.Containers, cassandraContainerName)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      cassandraDataVolumeName,
+		MountPath: cassandraDataPath,
+	})
+}
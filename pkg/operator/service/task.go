@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+)
+
+const (
+	defaultTaskConcurrency = 1
+	// taskOutputLength bounds the output of an operation kept on the status
+	// of its node.
+	taskOutputLength = 512
+)
+
+// taskCommands are the nodetool commands of the task operations.
+var taskCommands = map[cassandrav1alpha1.TaskOperation]string{
+	cassandrav1alpha1.TaskCleanup:        "cleanup",
+	cassandrav1alpha1.TaskCompaction:     "compact",
+	cassandrav1alpha1.TaskGarbageCollect: "garbagecollect",
+	cassandrav1alpha1.TaskFlush:          "flush",
+	cassandrav1alpha1.TaskRebuild:        "rebuild",
+}
+
+// ValidateTask returns an error describing the invalid spec of the task on
+// the cluster.
+func ValidateTask(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask) error {
+	spec := task.Spec
+	if _, ok := taskCommands[spec.Operation]; !ok {
+		return fmt.Errorf("unknown operation %q, it must be one of Cleanup, Compaction, GarbageCollect, Flush or Rebuild", spec.Operation)
+	}
+	// The options could point nodetool to other hosts or credentials.
+	for _, arg := range spec.Arguments {
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("argument %q is an option, only the arguments of the operation are allowed", arg)
+		}
+	}
+	if spec.Operation == cassandrav1alpha1.TaskRebuild && len(spec.Arguments) != 1 {
+		return fmt.Errorf("the Rebuild operation requires the source datacenter as its only argument")
+	}
+	if spec.Concurrency < 0 {
+		return fmt.Errorf("concurrency can't be negative")
+	}
+	if spec.TTLSecondsAfterFinished != nil && *spec.TTLSecondsAfterFinished < 0 {
+		return fmt.Errorf("ttlSecondsAfterFinished can't be negative")
+	}
+	if spec.Rack != "" && !hasRack(cc, spec.Rack) {
+		return fmt.Errorf("CassandraCluster %q has no rack %q", cc.Name, spec.Rack)
+	}
+	return nil
+}
+
+// hasRack returns whether the cluster has the rack name.
+func hasRack(cc *cassandrav1alpha1.CassandraCluster, name string) bool {
+	for _, rack := range cc.Spec.Racks {
+		if rack.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskConcurrency returns the number of nodes running the operation of the
+// task at the same time.
+func TaskConcurrency(task *cassandrav1alpha1.CassandraTask) int {
+	if task.Spec.Concurrency == 0 {
+		return defaultTaskConcurrency
+	}
+	return int(task.Spec.Concurrency)
+}
+
+// TaskPods returns the pods of the cluster targeted by the task, the ones of
+// its rack and datacenter when set. The datacenter of a node is read from
+// nodetool info.
+func (r *CassandraClusterKubeClient) TaskPods(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask) ([]string, error) {
+	statefulSets, err := r.GetStatefulSets(cc)
+	if err != nil {
+		return nil, err
+	}
+	rackStatefulSet := ""
+	if task.Spec.Rack != "" {
+		rackStatefulSet = rackStatefulSetName(cc, cassandrav1alpha1.RackSpec{Name: task.Spec.Rack})
+	}
+
+	var pods []string
+	for _, ss := range statefulSets {
+		if rackStatefulSet != "" && ss.Name != rackStatefulSet {
+			continue
+		}
+		replicas := int32(1)
+		if ss.Spec.Replicas != nil {
+			replicas = *ss.Spec.Replicas
+		}
+		for i := int32(0); i < replicas; i++ {
+			pods = append(pods, fmt.Sprintf("%s-%d", ss.Name, i))
+		}
+	}
+	if task.Spec.Datacenter == "" {
+		return pods, nil
+	}
+
+	command, err := r.nodetoolCommand(cc, "info")
+	if err != nil {
+		return nil, err
+	}
+	var targeted []string
+	for _, pod := range pods {
+		info, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the datacenter of pod %s/%s: %s", cc.Namespace, pod, err)
+		}
+		if infoField(info, "Data Center") == task.Spec.Datacenter {
+			targeted = append(targeted, pod)
+		}
+	}
+	return targeted, nil
+}
+
+// infoField returns the value of the field of the output of nodetool info.
+func infoField(info, name string) string {
+	for _, line := range strings.Split(info, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == name {
+			return strings.TrimSpace(fields[1])
+		}
+	}
+	return ""
+}
+
+// RunTask runs the operation of the task on the node of pod, returning the
+// end of its output.
+func (r *CassandraClusterKubeClient) RunTask(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask, pod string) (string, error) {
+	args := append([]string{taskCommands[task.Spec.Operation]}, task.Spec.Arguments...)
+	command, err := r.nodetoolCommand(cc, args...)
+	if err != nil {
+		return "", err
+	}
+	output, err := r.K8SService.ExecPod(cc.Namespace, pod, cassandraContainerName, command)
+	if err != nil {
+		return "", err
+	}
+	if r.config.DryRun {
+		return "", nil
+	}
+	r.logger.Infof("operation %s of task %s ran on pod %s/%s", task.Spec.Operation, task.Name, cc.Namespace, pod)
+	return TaskOutput(output), nil
+}
+
+// TaskOutput returns the end of the output of an operation, the part kept on
+// the status of its node. It's cut at the start of a rune, so a multi-byte
+// character is never split.
+func TaskOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) <= taskOutputLength {
+		return output
+	}
+	start := len(output) - taskOutputLength
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+	return "..." + output[start:]
+}
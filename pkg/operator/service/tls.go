@@ -0,0 +1,516 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/cql"
+)
+
+const (
+	// TLSRotationAnnotation is set on the certificates secret and the pod
+	// templates with the time the certificates of the existing nodes were
+	// last renewed, changing it restarts the nodes so they load them.
+	TLSRotationAnnotation = "cassandra.databases.camilocot/tls-rotation"
+
+	// caCertificateKey is the key of the certificates secret with the CA
+	// certificate, the certificate and key of a node are <pod>.crt and
+	// <pod>.key.
+	caCertificateKey = "ca.crt"
+
+	tlsVolumeName = "cassandra-tls"
+	// tlsCertificatesPath is where the certificates secret is mounted.
+	tlsCertificatesPath = "/etc/cassandra/certs"
+	keystorePath        = "/etc/cassandra/keystore.jks"
+	truststorePath      = "/etc/cassandra/truststore.jks"
+	// storePassword protects the keystores generated from the mounted
+	// certificates when the nodes start, they're as readable as the
+	// certificates they're generated from.
+	storePassword = "cassandra"
+
+	caValidity          = 10 * 365 * 24 * time.Hour
+	certificateValidity = 365 * 24 * time.Hour
+	// certificateRenewBefore is the time left before the expiry of a node
+	// certificate when it's renewed.
+	certificateRenewBefore = 30 * 24 * time.Hour
+	// certificateBackdate tolerates the clock skew between the operator and
+	// the nodes.
+	certificateBackdate = time.Hour
+	rsaKeySize          = 2048
+)
+
+// tlsEnabled returns whether the cluster encrypts any of its traffic.
+func tlsEnabled(cc *cassandrav1alpha1.CassandraCluster) bool {
+	return cc.Spec.TLS != nil && (cc.Spec.TLS.Internode || cc.Spec.TLS.Client)
+}
+
+// CASecretName returns the name of the secret with the CA of the cluster.
+func CASecretName(cc *cassandrav1alpha1.CassandraCluster) string {
+	if cc.Spec.TLS != nil && cc.Spec.TLS.CASecretName != "" {
+		return cc.Spec.TLS.CASecretName
+	}
+	return cc.Spec.StatefulSetName + "-ca"
+}
+
+// TLSSecretName returns the name of the secret with the CA certificate and
+// the certificates of the nodes of the cluster.
+func TLSSecretName(cc *cassandrav1alpha1.CassandraCluster) string {
+	if cc.Spec.TLS != nil && cc.Spec.TLS.NodeSecretName != "" {
+		return cc.Spec.TLS.NodeSecretName
+	}
+	return cc.Spec.StatefulSetName + "-tls"
+}
+
+// nodeCertificateKeys returns the keys of the certificates secret with the
+// certificate and the key of the node of the pod.
+func nodeCertificateKeys(pod string) (string, string) {
+	return pod + ".crt", pod + ".key"
+}
+
+// clusterCA is the CA signing the certificates of the nodes of a cluster.
+type clusterCA struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// EnsureTLS makes sure the CA of the cluster exists, generating it when it
+// doesn't, and that the certificates secret holds a valid certificate for
+// every node, valid for the name of its pod. The certificates signed by
+// another CA, or about to expire, are renewed, and the rotation annotation is
+// updated so the nodes restart. The certificates of a secret provided by the
+// user are only checked. It returns whether the certificates of running
+// nodes were renewed.
+func (r *CassandraClusterKubeClient) EnsureTLS(cc *cassandrav1alpha1.CassandraCluster) (bool, error) {
+	if !tlsEnabled(cc) {
+		return false, nil
+	}
+	if cc.Spec.TLS.NodeSecretName != "" {
+		return false, r.checkNodeSecret(cc)
+	}
+
+	ca, err := r.ensureCA(cc)
+	if err != nil {
+		return false, err
+	}
+
+	name := TLSSecretName(cc)
+	stored, err := r.K8SService.GetSecret(cc.Namespace, name)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	exists := err == nil
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cc.Namespace,
+			Labels:    clusterLabels(cc),
+			OwnerReferences: []metav1.OwnerReference{
+				clusterOwnerReference(cc),
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	if exists {
+		secret = stored.DeepCopy()
+	}
+	secret.Data = map[string][]byte{caCertificateKey: ca.certPEM}
+
+	now := time.Now()
+	renewed := false
+	for _, pod := range ClusterPodNames(cc) {
+		certKey, keyKey := nodeCertificateKeys(pod)
+		dnsNames := nodeDNSNames(cc, pod)
+		if exists && certificateValid(stored.Data[certKey], ca, dnsNames, now) {
+			secret.Data[certKey], secret.Data[keyKey] = stored.Data[certKey], stored.Data[keyKey]
+			continue
+		}
+
+		certPEM, keyPEM, err := issueCertificate(ca, pod, dnsNames, now)
+		if err != nil {
+			return false, err
+		}
+		secret.Data[certKey], secret.Data[keyKey] = certPEM, keyPEM
+		// The nodes without certificate are not running yet, they load it
+		// when they start.
+		if exists && len(stored.Data[certKey]) > 0 {
+			renewed = true
+		}
+	}
+
+	if !exists {
+		return false, r.K8SService.CreateSecret(cc.Namespace, secret)
+	}
+	if renewed {
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[TLSRotationAnnotation] = now.UTC().Format(time.RFC3339)
+	}
+	if secretDataEqual(stored.Data, secret.Data) {
+		return false, nil
+	}
+	return renewed, r.K8SService.UpdateSecret(cc.Namespace, secret)
+}
+
+// checkNodeSecret returns an error when the certificates secret provided by
+// the user lacks the CA certificate or the certificate of a node. The secret
+// is never modified.
+func (r *CassandraClusterKubeClient) checkNodeSecret(cc *cassandrav1alpha1.CassandraCluster) error {
+	name := TLSSecretName(cc)
+	secret, err := r.K8SService.GetSecret(cc.Namespace, name)
+	if err != nil {
+		return err
+	}
+	keys := []string{caCertificateKey}
+	for _, pod := range ClusterPodNames(cc) {
+		certKey, keyKey := nodeCertificateKeys(pod)
+		keys = append(keys, certKey, keyKey)
+	}
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			return fmt.Errorf("secret %s/%s has no %s key", cc.Namespace, name, key)
+		}
+	}
+	return nil
+}
+
+// ensureCA returns the CA of the cluster secret, the secret is generated when
+// it doesn't exist. An existing secret is never updated.
+func (r *CassandraClusterKubeClient) ensureCA(cc *cassandrav1alpha1.CassandraCluster) (*clusterCA, error) {
+	name := CASecretName(cc)
+	secret, err := r.K8SService.GetSecret(cc.Namespace, name)
+	if err == nil {
+		ca, err := parseCA(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA in secret %s/%s: %s", cc.Namespace, name, err)
+		}
+		return ca, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := generateCA(cc, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := r.K8SService.CreateSecret(cc.Namespace, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cc.Namespace,
+			Labels:    clusterLabels(cc),
+			OwnerReferences: []metav1.OwnerReference{
+				clusterOwnerReference(cc),
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return parseCA(certPEM, keyPEM)
+}
+
+// generateCA returns the PEM encoded certificate and key of a new self signed
+// CA for the cluster.
+func generateCA(cc *cassandrav1alpha1.CassandraCluster, now time.Time) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s/%s CA", cc.Namespace, cc.Name)},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(der), encodeRSAKey(key), nil
+}
+
+// issueCertificate returns the PEM encoded certificate and key of a node,
+// signed by the CA. The certificate authenticates the node both as a server
+// and as a client of the other nodes.
+func issueCertificate(ca *clusterCA, commonName string, dnsNames []string, now time.Time) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-certificateBackdate),
+		NotAfter:     now.Add(certificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodeCertificate(der), encodeRSAKey(key), nil
+}
+
+// certificateValid returns whether the PEM encoded certificate is signed by
+// the CA, has the DNS names and doesn't have to be renewed yet.
+func certificateValid(certPEM []byte, ca *clusterCA, dnsNames []string, now time.Time) bool {
+	cert, err := parseCertificate(certPEM)
+	if err != nil || cert.CheckSignatureFrom(ca.cert) != nil {
+		return false
+	}
+	if now.Add(certificateRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	current := append([]string(nil), cert.DNSNames...)
+	sort.Strings(current)
+	desired := append([]string(nil), dnsNames...)
+	sort.Strings(desired)
+	return strings.Join(current, ",") == strings.Join(desired, ",")
+}
+
+// parseCA returns the CA of its PEM encoded certificate and key, the key may
+// be PKCS#1 or PKCS#8 encoded.
+func parseCA(certPEM, keyPEM []byte) (*clusterCA, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("certificate %q is not a CA", cert.Subject.CommonName)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+	var key interface{}
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("unsupported key: %s", err)
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return &clusterCA{cert: cert, certPEM: certPEM, key: signer}, nil
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeRSAKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// serialNumber returns a random 128 bits certificate serial number.
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if !bytes.Equal(b[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterHost returns the DNS name of the headless service of the cluster.
+func clusterHost(cc *cassandrav1alpha1.CassandraCluster) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", cc.Spec.StatefulSetName, cc.Namespace)
+}
+
+// nodeDNSNames returns the DNS names of the certificate of a pod: the ones of
+// the pod through the service governing the statefulsets and the ones of the
+// headless service the clients connect to.
+func nodeDNSNames(cc *cassandrav1alpha1.CassandraCluster, pod string) []string {
+	service := cc.Spec.StatefulSetName + "-unready"
+	return []string{
+		pod,
+		fmt.Sprintf("%s.%s.%s.svc.cluster.local", pod, service, cc.Namespace),
+		cc.Spec.StatefulSetName,
+		fmt.Sprintf("%s.%s", cc.Spec.StatefulSetName, cc.Namespace),
+		clusterHost(cc),
+	}
+}
+
+// tlsRotation returns the last rotation of the certificates of the cluster,
+// empty when they were never renewed.
+func (r *CassandraClusterKubeClient) tlsRotation(cc *cassandrav1alpha1.CassandraCluster) (string, error) {
+	if !tlsEnabled(cc) {
+		return "", nil
+	}
+	secret, err := r.K8SService.GetSecret(cc.Namespace, TLSSecretName(cc))
+	if errors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret.Annotations[TLSRotationAnnotation], nil
+}
+
+// applyTLS mounts the certificates secret on the cassandra container of the
+// statefulset. The rotation is set on the pod template, so the nodes are
+// restarted one by one when their certificates are renewed.
+func applyTLS(cc *cassandrav1alpha1.CassandraCluster, ss *appsv1.StatefulSet, rotation string) {
+	if !tlsEnabled(cc) {
+		return
+	}
+
+	template := &ss.Spec.Template
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: tlsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: TLSSecretName(cc),
+			},
+		},
+	})
+	container := findContainer(template.Spec.Containers, cassandraContainerName)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      tlsVolumeName,
+		MountPath: tlsCertificatesPath,
+		ReadOnly:  true,
+	})
+
+	if rotation != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[TLSRotationAnnotation] = rotation
+	}
+}
+
+// checkInternodeEncryption returns an error when the statefulset would
+// enable or disable the internode encryption of running nodes. The nodes are
+// restarted one by one, and the restarted ones can't reach the others, which
+// would split the cluster until all of them rolled. The nodes must be scaled
+// to zero before, so they start again together.
+func checkInternodeEncryption(cc *cassandrav1alpha1.CassandraCluster, stored *appsv1.StatefulSet) error {
+	if stored.Spec.Replicas != nil && *stored.Spec.Replicas == 0 && stored.Status.Replicas == 0 {
+		return nil
+	}
+	encrypted := false
+	if container := findContainer(stored.Spec.Template.Spec.Containers, cassandraContainerName); container != nil {
+		encrypted = strings.Contains(strings.Join(container.Command, " "), "internode_encryption")
+	}
+	desired := cc.Spec.TLS != nil && cc.Spec.TLS.Internode
+	if encrypted == desired {
+		return nil
+	}
+	return fmt.Errorf("the internode encryption of statefulset %s/%s can't change while it runs nodes, scale it to zero replicas first", stored.Namespace, stored.Name)
+}
+
+// tlsCommands returns the commands converting the mounted certificate of
+// the node, picked by its hostname, into the JKS keystore and truststore
+// cassandra expects.
+func tlsCommands(cc *cassandrav1alpha1.CassandraCluster) []string {
+	if !tlsEnabled(cc) {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("rm -f %s %s /tmp/node.p12", keystorePath, truststorePath),
+		fmt.Sprintf("openssl pkcs12 -export -name node -in %[1]s/${HOSTNAME}.crt -inkey %[1]s/${HOSTNAME}.key -out /tmp/node.p12 -passout pass:%[2]s", tlsCertificatesPath, storePassword),
+		fmt.Sprintf("keytool -importkeystore -noprompt -srckeystore /tmp/node.p12 -srcstoretype PKCS12 -srcstorepass %[2]s -destkeystore %[1]s -deststoretype JKS -deststorepass %[2]s", keystorePath, storePassword),
+		fmt.Sprintf("keytool -importcert -noprompt -alias ca -file %s/%s -keystore %s -storetype JKS -storepass %s", tlsCertificatesPath, caCertificateKey, truststorePath, storePassword),
+		"rm -f /tmp/node.p12",
+	}
+}
+
+// tlsSettings returns the encryption options of cassandra.yaml.
+func tlsSettings(cc *cassandrav1alpha1.CassandraCluster) []cassandraSetting {
+	tls := cc.Spec.TLS
+	if !tlsEnabled(cc) {
+		return nil
+	}
+
+	stores := []cassandraSetting{
+		{name: "keystore", value: keystorePath},
+		{name: "keystore_password", value: storePassword},
+		{name: "truststore", value: truststorePath},
+		{name: "truststore_password", value: storePassword},
+	}
+	var settings []cassandraSetting
+	if tls.Internode {
+		settings = append(settings, cassandraSetting{
+			name:    "server_encryption_options",
+			options: append([]cassandraSetting{{name: "internode_encryption", value: "all"}}, stores...),
+		})
+	}
+	if tls.Client {
+		settings = append(settings, cassandraSetting{
+			name:    "client_encryption_options",
+			options: append([]cassandraSetting{{name: "enabled", value: "true"}, {name: "optional", value: "false"}}, stores...),
+		})
+	}
+	return settings
+}
+
+// cqlTLS returns the encryption of the CQL sessions of the operator, nil
+// when the cluster doesn't encrypt the client connections.
+func (r *CassandraClusterKubeClient) cqlTLS(cc *cassandrav1alpha1.CassandraCluster) (*cql.TLSConfig, error) {
+	if cc.Spec.TLS == nil || !cc.Spec.TLS.Client {
+		return nil, nil
+	}
+	secret, err := r.K8SService.GetSecret(cc.Namespace, TLSSecretName(cc))
+	if err != nil {
+		return nil, err
+	}
+	return &cql.TLSConfig{
+		CACert:     secret.Data[caCertificateKey],
+		ServerName: clusterHost(cc),
+	}, nil
+}
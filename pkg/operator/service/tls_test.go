@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto/x509"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	"github.com/camilocot/cassandra-crd/pkg/operator/service/k8s"
+)
+
+func TestEnsureTLS(t *testing.T) {
+	cc := testCluster()
+	cc.Spec.TLS = &cassandrav1alpha1.TLSSpec{Internode: true, Client: true}
+	client := NewCassandraClusterClient(k8s.New(fake.NewSimpleClientset(), nil, testLogger()), nil, Config{}, testLogger())
+
+	if renewed, err := client.EnsureTLS(cc); err != nil || renewed {
+		t.Fatalf("got renewed %t, error %v, want the certificates created", renewed, err)
+	}
+	secret, err := client.K8SService.GetSecret(cc.Namespace, TLSSecretName(cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data[caCertificateKey]) {
+		t.Fatal("no CA certificate in the secret")
+	}
+
+	// Every node has its own key, with a certificate for the name of its pod.
+	keys := map[string]bool{}
+	for _, pod := range ClusterPodNames(cc) {
+		certKey, keyKey := nodeCertificateKeys(pod)
+		if keys[string(secret.Data[keyKey])] {
+			t.Errorf("node %s shares its key", pod)
+		}
+		keys[string(secret.Data[keyKey])] = true
+
+		cert, err := parseCertificate(secret.Data[certKey])
+		if err != nil {
+			t.Fatalf("certificate of %s: %s", pod, err)
+		}
+		opts := x509.VerifyOptions{
+			DNSName:   pod + ".cassandra-unready.default.svc.cluster.local",
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if _, err := cert.Verify(opts); err != nil {
+			t.Errorf("certificate of %s: %s", pod, err)
+		}
+		opts.DNSName = "cassandra-9.cassandra-unready.default.svc.cluster.local"
+		if _, err := cert.Verify(opts); err == nil {
+			t.Errorf("certificate of %s valid for another pod", pod)
+		}
+	}
+
+	// The valid certificates are kept, the new nodes get theirs without
+	// restarting the running ones.
+	replicas := int32(4)
+	cc.Spec.Replicas = &replicas
+	if renewed, err := client.EnsureTLS(cc); err != nil || renewed {
+		t.Fatalf("got renewed %t, error %v, want the certificate of the new node added", renewed, err)
+	}
+	scaled, err := client.K8SService.GetSecret(cc.Namespace, TLSSecretName(cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range ClusterPodNames(cc)[:3] {
+		certKey, _ := nodeCertificateKeys(pod)
+		if string(scaled.Data[certKey]) != string(secret.Data[certKey]) {
+			t.Errorf("certificate of %s renewed", pod)
+		}
+	}
+	if certKey, _ := nodeCertificateKeys("cassandra-3"); len(scaled.Data[certKey]) == 0 {
+		t.Errorf("no certificate for the new node")
+	}
+}
+
+func TestEnsureTLSNodeSecret(t *testing.T) {
+	cc := testCluster()
+	cc.Spec.TLS = &cassandrav1alpha1.TLSSpec{Internode: true, NodeSecretName: "my-certs"}
+	data := map[string][]byte{caCertificateKey: []byte("ca")}
+	for _, pod := range ClusterPodNames(cc)[:2] {
+		certKey, keyKey := nodeCertificateKeys(pod)
+		data[certKey], data[keyKey] = []byte("cert"), []byte("key")
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-certs", Namespace: cc.Namespace}, Data: data}
+	kubeCli := fake.NewSimpleClientset(secret)
+	client := NewCassandraClusterClient(k8s.New(kubeCli, nil, testLogger()), nil, Config{}, testLogger())
+
+	// The secret lacks the certificate of the third node.
+	if _, err := client.EnsureTLS(cc); err == nil {
+		t.Fatal("got no error for a secret without the certificate of every node")
+	}
+
+	certKey, keyKey := nodeCertificateKeys("cassandra-2")
+	data[certKey], data[keyKey] = []byte("cert"), []byte("key")
+	if _, err := kubeCli.CoreV1().Secrets(cc.Namespace).Update(secret); err != nil {
+		t.Fatal(err)
+	}
+	kubeCli.ClearActions()
+	if _, err := client.EnsureTLS(cc); err != nil {
+		t.Fatal(err)
+	}
+	// The provided secret is used as is, no CA is generated.
+	for _, action := range kubeCli.Actions() {
+		if verb := action.GetVerb(); verb != "get" {
+			t.Errorf("unexpected %s of %s", verb, action.GetResource().Resource)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/camilocot/cassandra-crd/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+
+	cassandrav1alpha1 "github.com/camilocot/cassandra-crd/pkg/apis/cassandra/v1alpha1"
+	cassandracli "github.com/camilocot/cassandra-crd/pkg/client/clientset/versioned"
+	ccsvc "github.com/camilocot/cassandra-crd/pkg/operator/service"
+)
+
+const (
+	// NoTargetNodes is used as part of the condition 'reason' when no node of the cluster of a CassandraTask is targeted
+	NoTargetNodes = "NoTargetNodes"
+	// TaskStarted is used as part of the Event 'reason' when the operation of a CassandraTask starts
+	TaskStarted = "TaskStarted"
+	// TaskSucceeded is used as part of the Event 'reason' when the operation of a CassandraTask succeeds on every node
+	TaskSucceeded = "TaskSucceeded"
+	// TaskFailed is used as part of the Event 'reason' when the operation of a CassandraTask fails on a node
+	TaskFailed = "TaskFailed"
+
+	// MessageNoTargetNodes is the message used for conditions when no node of the cluster of a CassandraTask is targeted
+	MessageNoTargetNodes = "No node of CassandraCluster %q is targeted by the task"
+	// MessageTaskStarted is the message used for an Event fired when the operation of a CassandraTask starts
+	MessageTaskStarted = "Operation %s started on %d nodes of CassandraCluster %q"
+	// MessageTaskInProgress is the message used for conditions while the operation of a CassandraTask runs
+	MessageTaskInProgress = "Operation %s ran on %d of %d nodes"
+	// MessageTaskSucceeded is the message used for an Event fired when the operation of a CassandraTask succeeds on every node
+	MessageTaskSucceeded = "Operation %s succeeded on %d nodes"
+	// MessageTaskFailed is the message used for an Event fired when the operation of a CassandraTask fails on a node
+	MessageTaskFailed = "Operation %s failed on %s"
+)
+
+// taskHandler is the cassandra task handler that will handle the events
+// received from kubernetes.
+type taskHandler struct {
+	ccCli    cassandracli.Interface
+	ccSvc    ccsvc.CassandraClusterClient
+	recorder record.EventRecorder
+	// dryRun only logs the operations, the tasks are neither run nor
+	// deleted.
+	dryRun bool
+	logger log.Logger
+}
+
+// newTaskHandler returns a new task handler.
+func newTaskHandler(ccCli cassandracli.Interface, ccSvc ccsvc.CassandraClusterClient, recorder record.EventRecorder, dryRun bool, logger log.Logger) *taskHandler {
+	return &taskHandler{
+		ccCli:    ccCli,
+		ccSvc:    ccSvc,
+		recorder: recorder,
+		dryRun:   dryRun,
+		logger:   logger,
+	}
+}
+
+func (h *taskHandler) Add(obj runtime.Object) error {
+	task, ok := obj.(*cassandrav1alpha1.CassandraTask)
+	if !ok {
+		return fmt.Errorf("%v is not a cassandra task object", obj.GetObjectKind())
+	}
+
+	logger := h.logger.With("namespace", task.Namespace, "task", task.Name, "reconcile", rand.String(8))
+	return h.withLogger(logger).Ensure(task)
+}
+
+// withLogger returns a copy of the handler whose messages and the ones of its
+// services are logged with logger.
+func (h *taskHandler) withLogger(logger log.Logger) *taskHandler {
+	return newTaskHandler(h.ccCli, h.ccSvc.WithLogger(logger), h.recorder, h.dryRun, logger)
+}
+
+// Delete is called when a cassandra task is deleted, the operations already
+// started on the nodes are not interrupted.
+func (h *taskHandler) Delete(name string) error {
+	h.logger.Infof("cassandra task %s deleted", name)
+	return nil
+}
+
+func (h *taskHandler) Ensure(task *cassandrav1alpha1.CassandraTask) error {
+	if taskFinished(task.Status.Phase) {
+		return h.expireTask(task)
+	}
+
+	status := task.Status.DeepCopy()
+	err := h.ensureTask(task, status)
+	if h.dryRun {
+		// The status is not written on dry run.
+		return err
+	}
+	if updateErr := h.updateStatus(task, status); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return err
+}
+
+// ensureTask runs the operation of the task on the next nodes of its cluster,
+// up to its concurrency per reconciliation. The update of the status requeues
+// the task until every node ran it. An operation interrupted by a restart of
+// the operator runs again on its nodes.
+func (h *taskHandler) ensureTask(task *cassandrav1alpha1.CassandraTask, status *cassandrav1alpha1.CassandraTaskStatus) error {
+	clusterName := task.Spec.ClusterName
+	cc, err := h.ccCli.CassandraV1alpha1().CassandraClusters(task.Namespace).Get(clusterName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, ClusterNotFound, fmt.Sprintf(MessageClusterNotFound, clusterName))
+		return nil
+	case err != nil:
+		return err
+	case cc.Spec.Paused:
+		// The operation goes on once the cluster is resumed, the task is
+		// requeued when its cluster changes.
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, ClusterPaused, fmt.Sprintf(MessageClusterPaused, clusterName))
+		return nil
+	}
+
+	// An invalid spec is not retried, the task is requeued when it changes.
+	if err := ccsvc.ValidateTask(cc, task); err != nil {
+		h.recorder.Event(task, corev1.EventTypeWarning, InvalidSpec, err.Error())
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, InvalidSpec, err.Error())
+		return nil
+	}
+
+	// The operations wait for every node to be ready, the task is requeued
+	// when the statefulsets of its cluster change.
+	statefulSets, err := h.ccSvc.GetStatefulSets(cc)
+	if err != nil {
+		return err
+	}
+	if len(statefulSets) == 0 || !statefulSetsReady(statefulSets) {
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, WaitingForNodes, MessageWaitingForNodes)
+		return nil
+	}
+
+	if status.Phase == "" {
+		return h.start(cc, task, status)
+	}
+	h.runBatch(cc, task, status)
+	h.finish(task, status)
+	return nil
+}
+
+// start records the nodes targeted by the task as pending, the operation
+// runs on them from the next reconciliation.
+func (h *taskHandler) start(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask, status *cassandrav1alpha1.CassandraTaskStatus) error {
+	pods, err := h.ccSvc.TaskPods(cc, task)
+	if err != nil {
+		h.recorder.Eventf(task, corev1.EventTypeWarning, ErrSyncFailed, MessageSyncFailed, "task nodes", err)
+		return err
+	}
+	if len(pods) == 0 {
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, NoTargetNodes, fmt.Sprintf(MessageNoTargetNodes, cc.Name))
+		return nil
+	}
+
+	now := metav1.Now()
+	status.StartTime = &now
+	status.Phase = cassandrav1alpha1.TaskRunning
+	status.Nodes = make([]cassandrav1alpha1.TaskNodeStatus, 0, len(pods))
+	for _, pod := range pods {
+		status.Nodes = append(status.Nodes, cassandrav1alpha1.TaskNodeStatus{Pod: pod, Phase: cassandrav1alpha1.TaskPending})
+	}
+	h.recorder.Eventf(task, corev1.EventTypeNormal, TaskStarted, MessageTaskStarted, task.Spec.Operation, len(pods), cc.Name)
+	status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, TaskStarted, fmt.Sprintf(MessageTaskInProgress, task.Spec.Operation, 0, len(pods)))
+	return nil
+}
+
+// runBatch runs the operation at the same time on the next pending nodes, up
+// to the concurrency of the task, recording the result of every node.
+func (h *taskHandler) runBatch(cc *cassandrav1alpha1.CassandraCluster, task *cassandrav1alpha1.CassandraTask, status *cassandrav1alpha1.CassandraTaskStatus) {
+	var batch []*cassandrav1alpha1.TaskNodeStatus
+	for i := range status.Nodes {
+		if len(batch) == ccsvc.TaskConcurrency(task) {
+			break
+		}
+		if node := &status.Nodes[i]; node.Phase != cassandrav1alpha1.TaskSucceeded && node.Phase != cassandrav1alpha1.TaskFailed {
+			batch = append(batch, node)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, node := range batch {
+		start := metav1.Now()
+		node.StartTime = &start
+		node.Phase = cassandrav1alpha1.TaskRunning
+		wg.Add(1)
+		go func(node *cassandrav1alpha1.TaskNodeStatus) {
+			defer wg.Done()
+			output, err := h.ccSvc.RunTask(cc, task, node.Pod)
+			completion := metav1.Now()
+			node.CompletionTime = &completion
+			if err != nil {
+				node.Phase = cassandrav1alpha1.TaskFailed
+				node.Message = ccsvc.TaskOutput(err.Error())
+				return
+			}
+			node.Phase = cassandrav1alpha1.TaskSucceeded
+			node.Message = output
+		}(node)
+	}
+	wg.Wait()
+}
+
+// finish completes the task once the operation ran on every node, reporting
+// the progress on the complete condition until then.
+func (h *taskHandler) finish(task *cassandrav1alpha1.CassandraTask, status *cassandrav1alpha1.CassandraTaskStatus) {
+	var done int
+	var failed []string
+	for _, node := range status.Nodes {
+		switch node.Phase {
+		case cassandrav1alpha1.TaskSucceeded:
+			done++
+		case cassandrav1alpha1.TaskFailed:
+			done++
+			failed = append(failed, node.Pod)
+		}
+	}
+	if done < len(status.Nodes) {
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionFalse, TaskStarted, fmt.Sprintf(MessageTaskInProgress, task.Spec.Operation, done, len(status.Nodes)))
+		return
+	}
+
+	now := metav1.Now()
+	status.CompletionTime = &now
+	if len(failed) > 0 {
+		msg := fmt.Sprintf(MessageTaskFailed, task.Spec.Operation, strings.Join(failed, ", "))
+		status.Phase = cassandrav1alpha1.TaskFailed
+		h.recorder.Event(task, corev1.EventTypeWarning, TaskFailed, msg)
+		status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionTrue, TaskFailed, msg)
+		return
+	}
+	msg := fmt.Sprintf(MessageTaskSucceeded, task.Spec.Operation, len(status.Nodes))
+	status.Phase = cassandrav1alpha1.TaskSucceeded
+	h.recorder.Event(task, corev1.EventTypeNormal, TaskSucceeded, msg)
+	status.SetCondition(cassandrav1alpha1.TaskComplete, corev1.ConditionTrue, TaskSucceeded, msg)
+}
+
+// expireTask deletes the finished task once its TTL elapsed. The TTL is
+// checked on every resync of the task.
+func (h *taskHandler) expireTask(task *cassandrav1alpha1.CassandraTask) error {
+	ttl := task.Spec.TTLSecondsAfterFinished
+	if ttl == nil || task.Status.CompletionTime == nil {
+		return nil
+	}
+	expiration := task.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second)
+	if time.Now().Before(expiration) {
+		return nil
+	}
+	if h.dryRun {
+		h.logger.Infof("dry-run: would delete expired cassandra task %s/%s", task.Namespace, task.Name)
+		return nil
+	}
+	err := h.ccCli.CassandraV1alpha1().CassandraTasks(task.Namespace).Delete(task.Name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	h.logger.Infof("cassandra task %s/%s expired, deleted", task.Namespace, task.Name)
+	return nil
+}
+
+// taskFinished returns whether the task with the phase finished.
+func taskFinished(phase cassandrav1alpha1.TaskPhase) bool {
+	return phase == cassandrav1alpha1.TaskSucceeded || phase == cassandrav1alpha1.TaskFailed
+}
+
+// updateStatus updates the status block of the CassandraTask resource when
+// it differs from the stored one.
+func (h *taskHandler) updateStatus(task *cassandrav1alpha1.CassandraTask, status *cassandrav1alpha1.CassandraTaskStatus) error {
+	if equality.Semantic.DeepEqual(&task.Status, status) {
+		return nil
+	}
+
+	taskCopy := task.DeepCopy()
+	taskCopy.Status = *status
+	// UpdateStatus will not allow changes to the Spec of the resource. If
+	// the CRD has no status subresource, the status endpoint is not found
+	// and we must use Update instead.
+	_, err := h.ccCli.CassandraV1alpha1().CassandraTasks(task.Namespace).UpdateStatus(taskCopy)
+	if errors.IsNotFound(err) {
+		_, err = h.ccCli.CassandraV1alpha1().CassandraTasks(task.Namespace).Update(taskCopy)
+	}
+	return err
+}